@@ -3,6 +3,7 @@ module github.com/DawnKosmos/gotzer
 go 1.25.1
 
 require (
+	filippo.io/age v1.2.1
 	github.com/hetznercloud/hcloud-go/v2 v2.36.0
 	github.com/spf13/cobra v1.10.2
 	golang.org/x/crypto v0.47.0
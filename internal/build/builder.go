@@ -7,6 +7,8 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+
+	"github.com/DawnKosmos/gotzer/internal/report"
 )
 
 // Builder handles Go cross-compilation
@@ -20,6 +22,8 @@ type Builder struct {
 	GOARCH  string
 	LDFlags string
 	Env     map[string]string
+
+	Reporter report.Reporter
 }
 
 // NewBuilder creates a new builder for the target architecture
@@ -31,6 +35,8 @@ func NewBuilder(buildType, mainPkg, output, goarch string) *Builder {
 		GOOS:    "linux",
 		GOARCH:  goarch,
 		LDFlags: "-s -w",
+
+		Reporter: report.Discard,
 	}
 }
 
@@ -43,12 +49,12 @@ func (b *Builder) Build(ctx context.Context) (string, error) {
 	}
 
 	if b.Type == "static" {
-		fmt.Printf("Building static project...\n")
-		fmt.Printf("  → %s\n", b.Command)
+		report.Info(b.Reporter, "Building static project: %s", b.Command)
 
+		output := report.Writer(b.Reporter, report.SourceLocal)
 		cmd := exec.CommandContext(ctx, "sh", "-c", b.Command)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		cmd.Stdout = output
+		cmd.Stderr = output
 		cmd.Env = os.Environ()
 		for k, v := range b.Env {
 			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
@@ -76,9 +82,10 @@ func (b *Builder) Build(ctx context.Context) (string, error) {
 	}
 	args = append(args, "-o", outputPath, b.MainPkg)
 
+	output := report.Writer(b.Reporter, report.SourceLocal)
 	cmd := exec.CommandContext(ctx, "go", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stdout = output
+	cmd.Stderr = output
 
 	// Set environment
 	env := os.Environ()
@@ -91,8 +98,7 @@ func (b *Builder) Build(ctx context.Context) (string, error) {
 	}
 	cmd.Env = env
 
-	fmt.Printf("Building for %s/%s...\n", b.GOOS, b.GOARCH)
-	fmt.Printf("  → go %s\n", strings.Join(args, " "))
+	report.Info(b.Reporter, "Building for %s/%s: go %s", b.GOOS, b.GOARCH, strings.Join(args, " "))
 
 	if err := cmd.Run(); err != nil {
 		return "", fmt.Errorf("build failed: %w", err)
@@ -104,7 +110,7 @@ func (b *Builder) Build(ctx context.Context) (string, error) {
 		return "", fmt.Errorf("failed to stat binary: %w", err)
 	}
 
-	fmt.Printf("  → Built %s (%.2f MB)\n", b.Output, float64(info.Size())/(1024*1024))
+	report.Info(b.Reporter, "Built %s (%.2f MB)", b.Output, float64(info.Size())/(1024*1024))
 
 	return outputPath, nil
 }
@@ -7,7 +7,9 @@ import (
 	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/DawnKosmos/gotzer/internal/hetzner"
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
 	"gopkg.in/yaml.v3"
@@ -30,8 +32,35 @@ func init() {
 }
 
 type globalConfig struct {
-	Token         string `yaml:"token"`
-	DefaultSSHKey string `yaml:"default_ssh_key,omitempty"`
+	Token         string    `yaml:"token"`
+	DefaultSSHKey string    `yaml:"default_ssh_key,omitempty"`
+	API           apiConfig `yaml:"api,omitempty"`
+}
+
+// apiConfig tunes how gotzer talks to the Hetzner API
+type apiConfig struct {
+	MaxRetries int `yaml:"max_retries,omitempty"` // default 5, -1 disables retries
+	// Wait for actions by command, e.g. create_image: 1h; "default" applies to the others
+	ActionTimeouts map[string]time.Duration `yaml:"action_timeouts,omitempty"`
+}
+
+// options returns the Hetzner client options of the settings
+func (a apiConfig) options() []hetzner.Option {
+	opts := []hetzner.Option{hetzner.WithReporter(reporter)}
+	if a.MaxRetries != 0 {
+		policy := hetzner.DefaultRetryPolicy
+		policy.MaxRetries = max(a.MaxRetries, 0)
+		opts = append(opts, hetzner.WithRetryPolicy(policy))
+	}
+	for command, timeout := range a.ActionTimeouts {
+		opts = append(opts, hetzner.WithActionTimeout(command, timeout))
+	}
+	return opts
+}
+
+// newHetznerClient creates an API client with the settings of the global config
+func newHetznerClient(globalCfg *globalConfig) *hetzner.Client {
+	return hetzner.NewClient(globalCfg.Token, globalCfg.API.options()...)
 }
 
 func runAuth(cmd *cobra.Command, args []string) error {
@@ -79,6 +108,10 @@ func runAuth(cmd *cobra.Command, args []string) error {
 		Token:         token,
 		DefaultSSHKey: "~/.ssh/id_ed25519",
 	}
+	// A new token keeps the API settings
+	if existing, err := loadGlobalConfig(); err == nil {
+		config.API = existing.API
+	}
 
 	data, err := yaml.Marshal(&config)
 	if err != nil {
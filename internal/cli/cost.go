@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/hetzner"
+	"github.com/spf13/cobra"
+)
+
+var costCmd = &cobra.Command{
+	Use:   "cost",
+	Short: "Estimate the monthly cost of the config",
+	Long: `Prices everything .gotzer.yaml describes with the current Hetzner price
+list: servers and their IPv4 addresses, backups, volumes, the floating IP and
+the load balancer. It also lists what the app's running resources (labelled
+gotzer/app) cost now, including unassigned primary IPs and snapshots.
+
+Prices are net, excluding VAT. Traffic beyond the included volume is not counted.`,
+	Args: cobra.NoArgs,
+	RunE: runCost,
+}
+
+func runCost(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	// Load configs
+	cfg, err := config.Load(cfgFile, envName)
+	if err != nil {
+		return err
+	}
+
+	globalCfg, err := loadGlobalConfig()
+	if err != nil {
+		return err
+	}
+
+	hc := newHetznerClient(globalCfg)
+	prices, err := hc.GetPrices(ctx)
+	if err != nil {
+		return err
+	}
+	estimate, err := hetzner.EstimateCost(cfg, prices)
+	if err != nil {
+		return err
+	}
+	running, err := hc.RunningCost(ctx, cfg.LabelSelector(), prices)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput() {
+		reportResult(struct {
+			Estimate *hetzner.Cost `json:"estimate"`
+			Running  *hetzner.Cost `json:"running"`
+		}{estimate, running})
+		return nil
+	}
+
+	printCost(os.Stdout, fmt.Sprintf("Estimated cost of %s", cfgFileName()), estimate)
+	if len(running.Items) == 0 {
+		fmt.Println("\nNothing is running yet.")
+	} else {
+		printCost(os.Stdout, "Running resources", running)
+	}
+	fmt.Println()
+	return nil
+}
+
+// printCost writes a cost breakdown with its totals
+func printCost(w io.Writer, title string, cost *hetzner.Cost) {
+	fmt.Fprintf(w, "\n💶 %s (%s, excl. VAT)\n", title, cost.Currency)
+	fmt.Fprintln(w, "────────────────────────────────────")
+	width := len("Total")
+	for _, item := range cost.Items {
+		width = max(width, len(item.Resource))
+	}
+	for _, item := range cost.Items {
+		fmt.Fprintf(w, "  %-*s  %8.4f/h  %8.2f/mo\n", width, item.Resource, item.Hourly, item.Monthly)
+	}
+	fmt.Fprintf(w, "  %s\n", strings.Repeat("─", width+26))
+	fmt.Fprintf(w, "  %-*s  %8.4f/h  %8.2f/mo\n", width, "Total", cost.Hourly, cost.Monthly)
+	for _, note := range cost.Notes {
+		fmt.Fprintf(w, "  Note: %s\n", note)
+	}
+}
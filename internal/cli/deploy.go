@@ -3,11 +3,14 @@ package cli
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/DawnKosmos/gotzer/internal/config"
 	"github.com/DawnKosmos/gotzer/internal/deploy"
 	"github.com/DawnKosmos/gotzer/internal/hetzner"
-	"github.com/DawnKosmos/gotzer/internal/ssh"
+	"github.com/DawnKosmos/gotzer/internal/plan"
+	"github.com/DawnKosmos/gotzer/internal/report"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"github.com/spf13/cobra"
 )
 
@@ -16,19 +19,38 @@ var deployCmd = &cobra.Command{
 	Short: "Build and deploy the Go application",
 	Long: `Builds the Go application for the target architecture and deploys it:
   1. Cross-compiles for Linux (ARM64 or AMD64)
-  2. Stops the systemd service
-  3. Uploads the binary via SCP
-  4. Starts the systemd service
+  2. Uploads the binary via SCP into <remote_path>/releases/<id>
+  3. Stops the systemd service
+  4. Points <remote_path>/current at the new release
+  5. Starts the systemd service
+  6. Runs deploy.health_check (if configured) and restores the previous
+     release on failure
+
+Old releases are kept (deploy.keep_releases, default 5) for 'gotzer rollback'.
+
+Server groups are deployed in batches (deploy.rollout). With a load_balancer,
+each server is taken out of rotation while it is deployed.
 
 This is the default command and only updates the Go app, not Docker services.`,
 	RunE: runDeploy,
 }
 
+var deployDryRun bool
+
+func init() {
+	deployCmd.Flags().BoolVar(&deployDryRun, "dry-run", false, "Show what deploy would change without building or uploading")
+	deployCmd.Flags().StringVar(&serverFlag, "server", "", "Only deploy to this server of a server group")
+}
+
 func runDeploy(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
 
+	if deployDryRun {
+		return runPlan(ctx, plan.ScopeDeploy)
+	}
+
 	// Load configs
-	cfg, err := config.Load(cfgFile)
+	cfg, err := config.Load(cfgFile, envName)
 	if err != nil {
 		return err
 	}
@@ -38,28 +60,111 @@ func runDeploy(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	secrets, err := loadSecrets(cfg)
+	if err != nil {
+		return err
+	}
+
 	// Get server info
-	hc := hetzner.NewClient(globalCfg.Token)
-	server, err := hc.GetServer(ctx, cfg.Server.Name)
+	hc := newHetznerClient(globalCfg)
+	servers, err := targetServers(ctx, hc, cfg)
+	if err != nil {
+		return err
+	}
+	if _, err := resolveNetwork(ctx, hc, cfg); err != nil {
+		return err
+	}
+
+	// Connect to every server before building so an unreachable one fails early
+	var targets []deploy.Target
+	for _, server := range servers {
+		ip := serverIP(server)
+		printInfo(fmt.Sprintf("Deploying to %s (%s)", server.Name, ip))
+
+		sshClient := newSSHClient(globalCfg, server)
+		if err := sshClient.Connect(ctx); err != nil {
+			return fmt.Errorf("SSH connection to %s failed: %w", server.Name, err)
+		}
+		defer sshClient.Close()
+		targets = append(targets, deploy.Target{Name: server.Name, SSHClient: sshClient})
+	}
+	if err := addDraining(ctx, hc, cfg, servers, targets, cfg.Deploy.Rollout.BatchSize); err != nil {
+		return err
+	}
+
+	// Build once and roll out
+	res, err := deploy.Rollout(ctx, cfg, secrets, targets, reporter)
 	if err != nil {
+		if res != nil && len(servers) > 1 {
+			reportResult(result{Status: "error", ReleaseID: res.ReleaseID, Servers: res.Deployed, Error: err.Error()})
+			return &exitError{code: 1, msg: err.Error()}
+		}
 		return err
 	}
-	if server == nil {
-		return fmt.Errorf("server %s not found. Run 'gotzer provision' first", cfg.Server.Name)
+
+	out := result{Status: "success", ReleaseID: res.ReleaseID}
+	if len(servers) == 1 {
+		out.ServerIP = serverIP(servers[0])
+	} else {
+		out.Servers = res.Deployed
 	}
+	reportResult(out)
+	return nil
+}
 
-	serverIP := server.PublicNet.IPv4.IP.String()
-	printInfo(fmt.Sprintf("Deploying to %s (%s)", cfg.Server.Name, serverIP))
+// addDraining sets up the targets to be taken out of the load balancer while
+// they are deployed, concurrency at a time. Servers are only drained if others
+// keep serving traffic.
+func addDraining(ctx context.Context, hc *hetzner.Client, cfg *config.Config, servers []*hcloud.Server, targets []deploy.Target, concurrency int) error {
+	lbc := cfg.LoadBalancer
+	if lbc == nil {
+		return nil
+	}
+	if lbc.Selector != "" {
+		report.Warn(reporter, "Servers targeted by load_balancer.selector cannot be drained; they keep receiving traffic while deployed")
+		return nil
+	}
 
-	// Connect via SSH
-	sshKeyPath := config.ExpandPath(globalCfg.DefaultSSHKey)
-	sshClient := ssh.NewClient(serverIP, "root", sshKeyPath)
-	if err := sshClient.Connect(ctx); err != nil {
-		return fmt.Errorf("SSH connection failed: %w", err)
+	lb, err := hc.GetLoadBalancer(ctx, lbc.Name)
+	if err != nil {
+		return err
+	}
+	if lb == nil {
+		return nil
+	}
+	inRotation := 0
+	for _, t := range lb.Targets {
+		if t.Type == hcloud.LoadBalancerTargetTypeServer {
+			inRotation++
+		}
+	}
+	// Draining a whole batch must leave servers in rotation
+	if inRotation <= concurrency {
+		return nil
 	}
-	defer sshClient.Close()
 
-	// Deploy
-	deployer := deploy.NewDeployer(cfg, sshClient)
-	return deployer.Deploy(ctx)
+	for i, server := range servers {
+		if !hetzner.HasServerTarget(lb, server.ID) {
+			continue
+		}
+		targets[i].Drain = func(ctx context.Context) error {
+			if err := hc.RemoveLoadBalancerTarget(ctx, lb, server); err != nil {
+				return err
+			}
+			// Let in-flight requests finish
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(lbc.Drain):
+				return nil
+			}
+		}
+		targets[i].Restore = func(ctx context.Context) error {
+			if err := hc.AddLoadBalancerTarget(ctx, lb, server); err != nil {
+				return err
+			}
+			return hc.WaitForTargetHealthy(ctx, lb, server, 2*time.Minute)
+		}
+	}
+	return nil
 }
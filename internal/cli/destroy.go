@@ -6,32 +6,49 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/docker"
 	"github.com/DawnKosmos/gotzer/internal/hetzner"
+	"github.com/DawnKosmos/gotzer/internal/report"
+	"github.com/DawnKosmos/gotzer/internal/ssh"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"github.com/spf13/cobra"
 )
 
 var destroyForce bool
+var destroyDeleteVolumes bool
+var destroySnapshot bool
 
 var destroyCmd = &cobra.Command{
 	Use:   "destroy",
 	Short: "Destroy the Hetzner server",
 	Long: `Permanently deletes the Hetzner server and all associated data.
 
-WARNING: This action cannot be undone. All data on the server will be lost.`,
+WARNING: This action cannot be undone. All data on the server will be lost.
+
+Volumes from server.volumes are detached and kept, so a new server can pick up
+their data; pass --delete-volumes to delete them as well. The floating or
+primary IP is kept too, so the next server gets the same address.
+
+Unless --force is given, gotzer offers to snapshot the servers first.
+--snapshot takes the snapshot without asking.`,
 	RunE: runDestroy,
 }
 
 func init() {
 	destroyCmd.Flags().BoolVarP(&destroyForce, "force", "f", false, "Skip confirmation prompt")
+	destroyCmd.Flags().StringVar(&serverFlag, "server", "", "Only destroy this server of a server group")
+	destroyCmd.Flags().BoolVar(&destroyDeleteVolumes, "delete-volumes", false, "Also delete the servers' volumes and their data")
+	destroyCmd.Flags().BoolVar(&destroySnapshot, "snapshot", false, "Snapshot the servers before destroying them")
 }
 
 func runDestroy(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
 
 	// Load configs
-	cfg, err := config.Load(cfgFile)
+	cfg, err := config.Load(cfgFile, envName)
 	if err != nil {
 		return err
 	}
@@ -42,23 +59,62 @@ func runDestroy(cmd *cobra.Command, args []string) error {
 	}
 
 	// Get server info
-	hc := hetzner.NewClient(globalCfg.Token)
-	server, err := hc.GetServer(ctx, cfg.Server.Name)
-	if err != nil {
-		return err
+	hc := newHetznerClient(globalCfg)
+	var servers []*hcloud.Server
+	if serverFlag != "" {
+		servers, err = targetServers(ctx, hc, cfg)
+		if err != nil {
+			return err
+		}
+	} else {
+		var missing []string
+		servers, missing, err = findServers(ctx, hc, cfg)
+		if err != nil {
+			return err
+		}
+		for _, name := range missing {
+			printInfo(fmt.Sprintf("Server %s does not exist", name))
+		}
+		for _, server := range servers {
+			if err := checkEnvironment(cfg, server); err != nil {
+				return err
+			}
+		}
 	}
-	if server == nil {
-		printInfo(fmt.Sprintf("Server %s does not exist", cfg.Server.Name))
+	if len(servers) == 0 {
 		return nil
 	}
 
-	serverIP := server.PublicNet.IPv4.IP.String()
-
 	// Confirmation
 	if !destroyForce {
-		fmt.Printf("⚠️  WARNING: This will permanently destroy server '%s' (%s)\n", cfg.Server.Name, serverIP)
-		fmt.Printf("   All data will be lost. This cannot be undone.\n\n")
-		fmt.Print("Type the server name to confirm: ")
+		if cfg.LoadBalancer != nil && serverFlag == "" {
+			fmt.Fprintf(os.Stderr, "⚠️  Load balancer '%s' will be deleted as well\n", cfg.LoadBalancer.Name)
+		}
+		if cfg.Firewall != nil && serverFlag == "" {
+			fmt.Fprintf(os.Stderr, "⚠️  Firewall '%s' will be deleted as well\n", cfg.Firewall.Name)
+		}
+		if cfg.Network != nil && serverFlag == "" {
+			fmt.Fprintf(os.Stderr, "⚠️  Network '%s' will be deleted as well, unless other servers use it\n", cfg.Network.Name)
+		}
+		if len(cfg.Server.Volumes) > 0 {
+			if destroyDeleteVolumes {
+				fmt.Fprintln(os.Stderr, "⚠️  The servers' volumes will be deleted with all their data")
+			} else {
+				fmt.Fprintln(os.Stderr, "   Volumes are detached and kept (use --delete-volumes to delete them)")
+			}
+		}
+		// A single server is confirmed by its name, a group by the app name
+		confirm := servers[0].Name
+		if len(servers) == 1 {
+			fmt.Fprintf(os.Stderr, "⚠️  WARNING: This will permanently destroy server '%s' (%s)\n", servers[0].Name, serverIP(servers[0]))
+			fmt.Fprint(os.Stderr, "   All data will be lost. This cannot be undone.\n\n")
+			fmt.Fprint(os.Stderr, "Type the server name to confirm: ")
+		} else {
+			confirm = cfg.Name
+			fmt.Fprintf(os.Stderr, "⚠️  WARNING: This will permanently destroy %d servers: %s\n", len(servers), strings.Join(serverNames(servers), ", "))
+			fmt.Fprint(os.Stderr, "   All data will be lost. This cannot be undone.\n\n")
+			fmt.Fprint(os.Stderr, "Type the app name to confirm: ")
+		}
 
 		reader := bufio.NewReader(os.Stdin)
 		input, err := reader.ReadString('\n')
@@ -66,18 +122,128 @@ func runDestroy(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("failed to read input: %w", err)
 		}
 
-		if strings.TrimSpace(input) != cfg.Server.Name {
-			fmt.Println("Aborted.")
+		if strings.TrimSpace(input) != confirm {
+			printInfo("Aborted.")
 			return nil
 		}
+
+		if !destroySnapshot {
+			fmt.Fprint(os.Stderr, "Create a snapshot first? [y/N]: ")
+			input, err := reader.ReadString('\n')
+			if err != nil {
+				return fmt.Errorf("failed to read input: %w", err)
+			}
+			answer := strings.ToLower(strings.TrimSpace(input))
+			destroySnapshot = answer == "y" || answer == "yes"
+		}
 	}
 
-	printInfo(fmt.Sprintf("Destroying server %s...", cfg.Server.Name))
+	if destroySnapshot {
+		for _, server := range servers {
+			if _, err := createSnapshot(ctx, hc, cfg, server, fmt.Sprintf("%s before destroy %s", server.Name, time.Now().Format("2006-01-02 15:04"))); err != nil {
+				return err
+			}
+		}
+	}
 
-	if err := hc.DeleteServer(ctx, cfg.Server.Name); err != nil {
-		return err
+	for _, server := range servers {
+		if len(cfg.Server.Volumes) > 0 {
+			if err := detachVolumes(ctx, hc, globalCfg, cfg, server); err != nil {
+				return err
+			}
+		}
+
+		printInfo(fmt.Sprintf("Destroying server %s...", server.Name))
+
+		if err := hc.DeleteServer(ctx, server.Name); err != nil {
+			return err
+		}
+
+		if destroyDeleteVolumes {
+			for _, v := range cfg.Server.Volumes {
+				if err := hc.DeleteVolume(ctx, v.VolumeName(server.Name)); err != nil {
+					return err
+				}
+				printInfo(fmt.Sprintf("Deleted volume %s", v.VolumeName(server.Name)))
+			}
+		}
+
+		if _, err := ssh.DefaultKnownHosts().Remove(server.ID, publicIP(server)); err != nil {
+			printError(fmt.Sprintf("Failed to remove host key: %v", err))
+		}
+
+		printSuccess(fmt.Sprintf("Server %s has been destroyed", server.Name))
+	}
+
+	// The load balancer, firewall and network go with the last of the servers
+	if cfg.LoadBalancer != nil && serverFlag == "" {
+		printInfo(fmt.Sprintf("Deleting load balancer %s...", cfg.LoadBalancer.Name))
+		if err := hc.DeleteLoadBalancer(ctx, cfg.LoadBalancer.Name); err != nil {
+			return err
+		}
+		printSuccess(fmt.Sprintf("Load balancer %s has been deleted", cfg.LoadBalancer.Name))
+	}
+	if cfg.Firewall != nil && serverFlag == "" {
+		printInfo(fmt.Sprintf("Deleting firewall %s...", cfg.Firewall.Name))
+		if err := hc.DeleteFirewall(ctx, cfg.Firewall.Name); err != nil {
+			return err
+		}
+		printSuccess(fmt.Sprintf("Firewall %s has been deleted", cfg.Firewall.Name))
+	}
+	if cfg.Network != nil && serverFlag == "" {
+		deleted, err := hc.DeleteNetwork(ctx, cfg.Network.Name)
+		if err != nil {
+			return err
+		}
+		if deleted {
+			printSuccess(fmt.Sprintf("Network %s has been deleted", cfg.Network.Name))
+		} else {
+			printInfo(fmt.Sprintf("Network %s is kept; other servers are still attached", cfg.Network.Name))
+		}
+	}
+	if cfg.Server.PlacementGroup != "" && serverFlag == "" {
+		name := cfg.Server.PlacementGroupName()
+		deleted, err := hc.DeletePlacementGroup(ctx, name)
+		if err != nil {
+			return err
+		}
+		if deleted {
+			printSuccess(fmt.Sprintf("Placement group %s has been deleted", name))
+		}
 	}
+	for _, name := range []string{cfg.Server.FloatingIP, cfg.Server.PrimaryIP} {
+		if name != "" {
+			printInfo(fmt.Sprintf("IP %s is kept for the next server; delete it in the Hetzner Console if it is no longer needed", name))
+		}
+	}
+	return nil
+}
 
-	printSuccess(fmt.Sprintf("Server %s has been destroyed", cfg.Server.Name))
+// detachVolumes stops the services and unmounts the server's volumes, so
+// their filesystems are clean, then detaches them. Unmounting is best effort
+// since the server may be unreachable.
+func detachVolumes(ctx context.Context, hc *hetzner.Client, globalCfg *globalConfig, cfg *config.Config, server *hcloud.Server) error {
+	sshClient := newSSHClient(globalCfg, server)
+	if err := sshClient.Connect(ctx); err != nil {
+		report.Warn(reporter, "Could not connect to %s to unmount volumes: %v", server.Name, err)
+	} else {
+		var script strings.Builder
+		script.WriteString(fmt.Sprintf("sudo systemctl stop '%s*' 2>/dev/null\n", cfg.Deploy.ServiceName))
+		script.WriteString(fmt.Sprintf("[ -f %s ] && sudo docker compose -f %s down\n", docker.ComposePath(cfg), docker.ComposePath(cfg)))
+		for _, v := range cfg.Server.Volumes {
+			script.WriteString(fmt.Sprintf("sudo umount %s\n", v.MountPoint))
+		}
+		if _, err := sshClient.Run(ctx, script.String()); err != nil {
+			report.Warn(reporter, "Unmounting volumes on %s: %v", server.Name, err)
+		}
+		sshClient.Close()
+	}
+
+	for _, v := range cfg.Server.Volumes {
+		if err := hc.DetachVolume(ctx, v.VolumeName(server.Name)); err != nil {
+			return err
+		}
+		printInfo(fmt.Sprintf("Detached volume %s", v.VolumeName(server.Name)))
+	}
 	return nil
 }
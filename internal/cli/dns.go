@@ -0,0 +1,266 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/hetzner"
+	"github.com/DawnKosmos/gotzer/internal/report"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/spf13/cobra"
+)
+
+var dnsCmd = &cobra.Command{
+	Use:   "dns",
+	Short: "Manage the app's DNS records",
+	Long: `Keeps the A and AAAA records listed in the dns section pointing at the
+app: at the load balancer if there is one, else at the floating IP, else at
+every app server. The zone must be hosted by Hetzner in the project of the
+API token.
+
+'gotzer provision' and 'gotzer ip reassign' update the records as well.
+Set GOTZER_DNS_ENDPOINT to send the DNS requests to another API URL, e.g. a
+local stand-in.`,
+}
+
+var dnsSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Create or update the DNS records",
+	Args:  cobra.NoArgs,
+	RunE:  runDNSSync,
+}
+
+var dnsShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Compare the DNS records with the app's addresses",
+	Args:  cobra.NoArgs,
+	RunE:  runDNSShow,
+}
+
+func init() {
+	dnsCmd.AddCommand(dnsSyncCmd)
+	dnsCmd.AddCommand(dnsShowCmd)
+}
+
+// dnsRecordStatus is a record shown by `gotzer dns show`
+type dnsRecordStatus struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	TTL    int      `json:"ttl"`
+	Want   []string `json:"want"`
+	Have   []string `json:"have"`
+	InSync bool     `json:"in_sync"`
+}
+
+func runDNSSync(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	cfg, hc, dc, err := loadDNSConfig()
+	if err != nil {
+		return err
+	}
+	servers, _, err := findServers(ctx, hc, cfg)
+	if err != nil {
+		return err
+	}
+	if err := syncDNS(ctx, hc, dc, cfg, servers); err != nil {
+		return err
+	}
+	printSuccess(fmt.Sprintf("DNS records in %s are up to date", cfg.DNS.Zone))
+	reportResult(result{Status: "success"})
+	return nil
+}
+
+func runDNSShow(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	cfg, hc, dc, err := loadDNSConfig()
+	if err != nil {
+		return err
+	}
+	servers, _, err := findServers(ctx, hc, cfg)
+	if err != nil {
+		return err
+	}
+	zone, err := getDNSZone(ctx, dc, cfg)
+	if err != nil {
+		return err
+	}
+	records, err := dnsRecords(ctx, hc, cfg, servers)
+	if err != nil {
+		return err
+	}
+
+	statuses := make([]dnsRecordStatus, 0, len(records))
+	for _, want := range records {
+		have, err := dc.GetDNSRecord(ctx, zone, want.Name, want.Type)
+		if err != nil {
+			return err
+		}
+		status := dnsRecordStatus{Name: hetzner.FQDN(want.Name, cfg.DNS.Zone), Type: want.Type, TTL: want.TTL, Want: want.Values, Have: []string{}}
+		if have != nil {
+			status.Have = have.Values
+			status.InSync = slices.Equal(have.Values, want.Values) && have.TTL == want.TTL
+		} else {
+			status.InSync = len(want.Values) == 0
+		}
+		statuses = append(statuses, status)
+	}
+
+	if jsonOutput() {
+		reportResult(statuses)
+		return nil
+	}
+	fmt.Printf("\n🌍 DNS zone %s\n", cfg.DNS.Zone)
+	fmt.Println("────────────────────────────────────")
+	for _, s := range statuses {
+		want := strings.Join(s.Want, ", ")
+		if want == "" {
+			want = "(none)"
+		}
+		if s.InSync {
+			fmt.Printf("  ✅ %-5s %s → %s\n", s.Type, s.Name, want)
+			continue
+		}
+		have := strings.Join(s.Have, ", ")
+		if have == "" {
+			have = "(missing)"
+		}
+		fmt.Printf("  ⚠️  %-5s %s → %s (currently %s)\n", s.Type, s.Name, want, have)
+	}
+	fmt.Println()
+	return nil
+}
+
+// loadDNSConfig loads the configs and checks that a dns section is set. The
+// second client talks to the DNS API.
+func loadDNSConfig() (*config.Config, *hetzner.Client, *hetzner.Client, error) {
+	cfg, err := config.Load(cfgFile, envName)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if cfg.DNS == nil {
+		return nil, nil, nil, fmt.Errorf("no dns section in %s", cfgFileName())
+	}
+	globalCfg, err := loadGlobalConfig()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return cfg, newHetznerClient(globalCfg), newDNSClient(globalCfg), nil
+}
+
+// newDNSClient creates the client for the DNS API, honouring GOTZER_DNS_ENDPOINT
+func newDNSClient(globalCfg *globalConfig) *hetzner.Client {
+	return hetzner.NewDNSClient(globalCfg.Token, os.Getenv("GOTZER_DNS_ENDPOINT"), globalCfg.API.options()...)
+}
+
+// syncDNS brings the records of the dns section in line with the app's addresses
+func syncDNS(ctx context.Context, hc, dc *hetzner.Client, cfg *config.Config, servers []*hcloud.Server) error {
+	step := report.Start(reporter, "dns", "🌍", fmt.Sprintf("Updating DNS records in %s...", cfg.DNS.Zone))
+	zone, err := getDNSZone(ctx, dc, cfg)
+	if err != nil {
+		return step.Fail(err)
+	}
+	records, err := dnsRecords(ctx, hc, cfg, servers)
+	if err != nil {
+		return step.Fail(err)
+	}
+
+	var changes []string
+	for _, record := range records {
+		changed, err := dc.EnsureDNSRecord(ctx, zone, record, cfg.Labels())
+		if err != nil {
+			return step.Fail(err)
+		}
+		changes = append(changes, changed...)
+	}
+	for _, change := range changes {
+		report.Info(reporter, "%s", change)
+	}
+	if len(changes) == 0 {
+		report.Info(reporter, "DNS records are up to date")
+	}
+	step.Done()
+	return nil
+}
+
+func getDNSZone(ctx context.Context, dc *hetzner.Client, cfg *config.Config) (*hcloud.Zone, error) {
+	zone, err := dc.GetZone(ctx, cfg.DNS.Zone)
+	if err != nil {
+		return nil, err
+	}
+	if zone == nil {
+		return nil, fmt.Errorf("DNS zone %s not found; create it in the Hetzner Console first", cfg.DNS.Zone)
+	}
+	return zone, nil
+}
+
+// dnsRecords returns the wanted record sets of the dns section
+func dnsRecords(ctx context.Context, hc *hetzner.Client, cfg *config.Config, servers []*hcloud.Server) ([]hetzner.DNSRecord, error) {
+	ipv4, ipv6, err := dnsTargets(ctx, hc, cfg, servers)
+	if err != nil {
+		return nil, err
+	}
+	var records []hetzner.DNSRecord
+	for _, name := range cfg.DNS.Records {
+		records = append(records, hetzner.DNSRecord{Name: name, Type: "A", TTL: cfg.DNS.TTL, Values: ipv4})
+		if cfg.DNS.IPv6Enabled() {
+			records = append(records, hetzner.DNSRecord{Name: name, Type: "AAAA", TTL: cfg.DNS.TTL, Values: ipv6})
+		}
+	}
+	return records, nil
+}
+
+// dnsTargets returns the addresses the records point at: the load balancer,
+// else the floating IP and the IPv6 address of the server holding it, else
+// every server
+func dnsTargets(ctx context.Context, hc *hetzner.Client, cfg *config.Config, servers []*hcloud.Server) (ipv4, ipv6 []string, err error) {
+	if cfg.LoadBalancer != nil {
+		lb, err := hc.GetLoadBalancer(ctx, cfg.LoadBalancer.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if lb != nil {
+			return addrs(lb.PublicNet.IPv4.IP), addrs(lb.PublicNet.IPv6.IP), nil
+		}
+	}
+
+	if cfg.Server.FloatingIP != "" {
+		ip, err := hc.GetFloatingIP(ctx, cfg.Server.FloatingIP)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ip != nil && ip.Server != nil {
+			holder, err := hc.GetServerByID(ctx, ip.Server.ID)
+			if err != nil {
+				return nil, nil, err
+			}
+			ipv4 = addrs(ip.IP)
+			if holder != nil {
+				ipv6 = addrs(hetzner.ServerIPv6(holder))
+			}
+			return ipv4, ipv6, nil
+		}
+	}
+
+	for _, server := range servers {
+		ipv4 = append(ipv4, addrs(server.PublicNet.IPv4.IP)...)
+		ipv6 = append(ipv6, addrs(hetzner.ServerIPv6(server))...)
+	}
+	slices.Sort(ipv4)
+	slices.Sort(ipv6)
+	return ipv4, ipv6, nil
+}
+
+// addrs returns the address as a record value, or nothing if it is unset
+func addrs(ip net.IP) []string {
+	if ip == nil || ip.IsUnspecified() {
+		return nil
+	}
+	return []string{ip.String()}
+}
@@ -0,0 +1,202 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/hetzner"
+	"github.com/DawnKosmos/gotzer/internal/plan"
+	"github.com/DawnKosmos/gotzer/internal/report"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/spf13/cobra"
+)
+
+var firewallCmd = &cobra.Command{
+	Use:   "firewall",
+	Short: "Manage the Hetzner Cloud Firewall",
+	Long: `Manages the Hetzner Cloud Firewall described by the firewall section of
+.gotzer.yaml. The cloud firewall filters traffic before it reaches the server,
+so it also covers ports that Docker publishes past UFW.
+
+'gotzer provision' applies it as well; new servers get it from their first boot.`,
+}
+
+var firewallShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the firewall and how it differs from the config",
+	Args:  cobra.NoArgs,
+	RunE:  runFirewallShow,
+}
+
+var firewallApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Create or update the firewall and apply it to the servers",
+	Args:  cobra.NoArgs,
+	RunE:  runFirewallApply,
+}
+
+func init() {
+	firewallCmd.AddCommand(firewallShowCmd)
+	firewallCmd.AddCommand(firewallApplyCmd)
+}
+
+// firewallStatus is the information shown by `gotzer firewall show`
+type firewallStatus struct {
+	Name      string   `json:"name"`
+	Exists    bool     `json:"exists"`
+	Rules     []string `json:"rules,omitempty"`
+	AppliedTo []string `json:"applied_to,omitempty"`
+	Missing   []string `json:"missing,omitempty"` // app servers without the firewall
+	InSync    bool     `json:"in_sync"`
+	Diff      string   `json:"diff,omitempty"`
+}
+
+func runFirewallShow(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	cfg, hc, err := loadFirewallConfig()
+	if err != nil {
+		return err
+	}
+
+	fw, err := hc.GetFirewall(ctx, cfg.Firewall.Name)
+	if err != nil {
+		return err
+	}
+	servers, _, err := findServers(ctx, hc, cfg)
+	if err != nil {
+		return err
+	}
+	rules, err := hetzner.FirewallRules(cfg.Firewall)
+	if err != nil {
+		return err
+	}
+
+	status := firewallStatus{Name: cfg.Firewall.Name}
+	current := ""
+	if fw != nil {
+		status.Exists = true
+		current = hetzner.RenderFirewallRules(fw.Rules)
+		status.Rules = strings.Split(strings.TrimSuffix(current, "\n"), "\n")
+		for _, res := range fw.AppliedTo {
+			if res.Type == hcloud.FirewallResourceTypeServer {
+				status.AppliedTo = append(status.AppliedTo, serverName(servers, res.Server.ID))
+			}
+		}
+	}
+	for _, server := range servers {
+		if fw == nil || !hetzner.FirewallAppliedTo(fw, server.ID) {
+			status.Missing = append(status.Missing, server.Name)
+		}
+	}
+	status.Diff = plan.UnifiedDiff(cfg.Firewall.Name+" (current)", cfg.Firewall.Name+" (gotzer)", current, hetzner.RenderFirewallRules(rules))
+	status.InSync = status.Diff == "" && len(status.Missing) == 0
+
+	if jsonOutput() {
+		reportResult(status)
+		return nil
+	}
+
+	if !status.Exists {
+		printInfo(fmt.Sprintf("Firewall %s does not exist yet. Run 'gotzer firewall apply' to create it", status.Name))
+		return nil
+	}
+
+	fmt.Printf("\n🔥 Firewall %s\n", status.Name)
+	fmt.Println("────────────────────────────────────")
+	for _, rule := range status.Rules {
+		fmt.Printf("  %s\n", rule)
+	}
+	if len(status.AppliedTo) > 0 {
+		fmt.Printf("\n  Applied to:     %s\n", strings.Join(status.AppliedTo, ", "))
+	}
+	if len(status.Missing) > 0 {
+		fmt.Printf("  Not applied to: %s\n", strings.Join(status.Missing, ", "))
+	}
+	if status.Diff != "" {
+		fmt.Printf("\n  ~ rules differ from %s\n%s\n", cfgFileName(), status.Diff)
+	}
+	if !status.InSync {
+		fmt.Println("\nRun 'gotzer firewall apply' to update it.")
+	}
+	fmt.Println()
+	return nil
+}
+
+func runFirewallApply(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	cfg, hc, err := loadFirewallConfig()
+	if err != nil {
+		return err
+	}
+
+	servers, missing, err := findServers(ctx, hc, cfg)
+	if err != nil {
+		return err
+	}
+	for _, server := range servers {
+		if err := checkEnvironment(cfg, server); err != nil {
+			return err
+		}
+	}
+	for _, name := range missing {
+		report.Warn(reporter, "Server %s does not exist yet; it gets the firewall when provisioned", name)
+	}
+
+	fw, err := ensureFirewall(ctx, hc, cfg, servers)
+	if err != nil {
+		return err
+	}
+
+	printSuccess(fmt.Sprintf("Firewall %s applied to %d server(s)", fw.Name, len(servers)))
+	reportResult(result{Status: "success", Servers: serverNames(servers)})
+	return nil
+}
+
+// loadFirewallConfig loads the configs and fails if no firewall is configured
+func loadFirewallConfig() (*config.Config, *hetzner.Client, error) {
+	cfg, err := config.Load(cfgFile, envName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.Firewall == nil {
+		return nil, nil, fmt.Errorf("%s has no firewall section", cfgFileName())
+	}
+
+	globalCfg, err := loadGlobalConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, newHetznerClient(globalCfg), nil
+}
+
+// ensureFirewall creates or updates the cloud firewall and applies it to the servers
+func ensureFirewall(ctx context.Context, hc *hetzner.Client, cfg *config.Config, servers []*hcloud.Server) (*hcloud.Firewall, error) {
+	step := report.Start(reporter, "cloud_firewall", "🔥", fmt.Sprintf("Configuring cloud firewall %s...", cfg.Firewall.Name))
+	fw, changes, err := hc.EnsureFirewall(ctx, cfg.Firewall, cfg.Labels(), servers)
+	if err != nil {
+		return nil, step.Fail(err)
+	}
+	for _, change := range changes {
+		report.Info(reporter, "%s", change)
+	}
+	if len(changes) == 0 {
+		report.Info(reporter, "Firewall is up to date")
+	}
+	step.Done()
+	return fw, nil
+}
+
+// serverName returns the name of the server with the given ID, or its ID if
+// it is not one of the servers
+func serverName(servers []*hcloud.Server, id int64) string {
+	for _, server := range servers {
+		if server.ID == id {
+			return server.Name
+		}
+	}
+	return fmt.Sprintf("server #%d", id)
+}
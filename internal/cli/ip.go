@@ -0,0 +1,346 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/hetzner"
+	"github.com/DawnKosmos/gotzer/internal/provision"
+	"github.com/DawnKosmos/gotzer/internal/report"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/spf13/cobra"
+)
+
+var ipCmd = &cobra.Command{
+	Use:   "ip",
+	Short: "Manage the floating or primary IP",
+	Long: `Manages the public IPv4 address configured with server.floating_ip or
+server.primary_ip. The address outlives the server, so DNS records keep
+working when a server is destroyed and provisioned again.
+
+'gotzer provision' creates the address and assigns it to the first server.`,
+}
+
+var ipShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the address and the server it is assigned to",
+	Args:  cobra.NoArgs,
+	RunE:  runIPShow,
+}
+
+var ipReassignCmd = &cobra.Command{
+	Use:   "reassign",
+	Short: "Move the address to another server, e.g. a replacement",
+	Long: `Moves the floating or primary IP to the server chosen with --server (or
+the only server).
+
+A floating IP moves without downtime; provision has already configured it
+on every app server. A primary IP can only change while both servers are
+off: the server holding it is shut down and left off, and the target server
+is shut down, gets the address and is powered on again.`,
+	Args: cobra.NoArgs,
+	RunE: runIPReassign,
+}
+
+var ipReassignYes bool
+
+func init() {
+	ipCmd.AddCommand(ipShowCmd)
+	ipCmd.AddCommand(ipReassignCmd)
+
+	ipReassignCmd.Flags().StringVar(&serverFlag, "server", "", "Server to move the address to")
+	ipReassignCmd.Flags().BoolVarP(&ipReassignYes, "yes", "y", false, "Skip confirmation prompt")
+}
+
+// ipStatus is the information shown by `gotzer ip show`
+type ipStatus struct {
+	Name   string `json:"name"`
+	Kind   string `json:"kind"` // floating or primary
+	Exists bool   `json:"exists"`
+	IP     string `json:"ip,omitempty"`
+	Server string `json:"server,omitempty"`
+}
+
+func runIPShow(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	cfg, hc, err := loadIPConfig()
+	if err != nil {
+		return err
+	}
+	servers, _, err := findServers(ctx, hc, cfg)
+	if err != nil {
+		return err
+	}
+	serverName := func(id int64) string {
+		for _, server := range servers {
+			if server.ID == id {
+				return server.Name
+			}
+		}
+		return fmt.Sprintf("server %d (not an app server)", id)
+	}
+
+	var status ipStatus
+	if cfg.Server.FloatingIP != "" {
+		status = ipStatus{Name: cfg.Server.FloatingIP, Kind: "floating"}
+		ip, err := hc.GetFloatingIP(ctx, status.Name)
+		if err != nil {
+			return err
+		}
+		if ip != nil {
+			status.Exists, status.IP = true, ip.IP.String()
+			if ip.Server != nil {
+				status.Server = serverName(ip.Server.ID)
+			}
+		}
+	} else {
+		status = ipStatus{Name: cfg.Server.PrimaryIP, Kind: "primary"}
+		ip, err := hc.GetPrimaryIP(ctx, status.Name)
+		if err != nil {
+			return err
+		}
+		if ip != nil {
+			status.Exists, status.IP = true, ip.IP.String()
+			if ip.AssigneeID != 0 {
+				status.Server = serverName(ip.AssigneeID)
+			}
+		}
+	}
+
+	if jsonOutput() {
+		reportResult(status)
+		return nil
+	}
+	fmt.Printf("\n🌐 %s IP %s\n", strings.ToUpper(status.Kind[:1])+status.Kind[1:], status.Name)
+	fmt.Println("────────────────────────────────────")
+	if !status.Exists {
+		fmt.Println("  Not created yet. Run 'gotzer provision' to create it.")
+		fmt.Println()
+		return nil
+	}
+	fmt.Printf("  Address:  %s\n", status.IP)
+	if status.Server == "" {
+		status.Server = "unassigned"
+	}
+	fmt.Printf("  Server:   %s\n", status.Server)
+	fmt.Println()
+	return nil
+}
+
+func runIPReassign(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	cfg, hc, err := loadIPConfig()
+	if err != nil {
+		return err
+	}
+	globalCfg, err := loadGlobalConfig()
+	if err != nil {
+		return err
+	}
+	servers, err := targetServers(ctx, hc, cfg)
+	if err != nil {
+		return err
+	}
+	if len(servers) > 1 {
+		return fmt.Errorf("choose the server to move the address to with --server (%s)", strings.Join(serverNames(servers), ", "))
+	}
+	target := servers[0]
+
+	if cfg.Server.FloatingIP != "" {
+		err = reassignFloatingIP(ctx, hc, globalCfg, cfg, target)
+	} else {
+		err = reassignPrimaryIP(ctx, hc, globalCfg, cfg, target)
+	}
+	if err != nil || cfg.DNS == nil {
+		return err
+	}
+	// AAAA records follow the server holding the address
+	servers, _, err = findServers(ctx, hc, cfg)
+	if err != nil {
+		return err
+	}
+	return syncDNS(ctx, hc, newDNSClient(globalCfg), cfg, servers)
+}
+
+// reassignFloatingIP configures the floating IP on the target and routes it there
+func reassignFloatingIP(ctx context.Context, hc *hetzner.Client, globalCfg *globalConfig, cfg *config.Config, target *hcloud.Server) error {
+	ip, err := hc.GetFloatingIP(ctx, cfg.Server.FloatingIP)
+	if err != nil {
+		return err
+	}
+	if ip == nil {
+		return fmt.Errorf("floating IP %s does not exist. Run 'gotzer provision' first", cfg.Server.FloatingIP)
+	}
+	if ip.Server != nil && ip.Server.ID == target.ID {
+		printSuccess(fmt.Sprintf("Floating IP %s is already assigned to %s", ip.IP, target.Name))
+		reportResult(result{Status: "success", ServerIP: ip.IP.String()})
+		return nil
+	}
+
+	step := report.Start(reporter, "floating_ip", "📌", fmt.Sprintf("Moving floating IP %s to %s...", ip.IP, target.Name))
+	// The target may predate server.floating_ip, so make sure it accepts the address
+	sshClient := newSSHClient(globalCfg, target)
+	if err := sshClient.Connect(ctx); err != nil {
+		return step.Fail(fmt.Errorf("SSH connection failed: %w", err))
+	}
+	defer sshClient.Close()
+	if err := provision.ConfigureFloatingIP(ctx, sshClient, ip.IP.String()); err != nil {
+		return step.Fail(err)
+	}
+	if err := hc.AssignFloatingIP(ctx, ip, target); err != nil {
+		return step.Fail(err)
+	}
+	step.Done()
+
+	printSuccess(fmt.Sprintf("Floating IP %s now routes to %s", ip.IP, target.Name))
+	reportResult(result{Status: "success", ServerIP: ip.IP.String()})
+	return nil
+}
+
+// reassignPrimaryIP moves the primary IP to the target, shutting down the
+// server holding it and restarting the target
+func reassignPrimaryIP(ctx context.Context, hc *hetzner.Client, globalCfg *globalConfig, cfg *config.Config, target *hcloud.Server) error {
+	ip, err := hc.GetPrimaryIP(ctx, cfg.Server.PrimaryIP)
+	if err != nil {
+		return err
+	}
+	if ip == nil {
+		return fmt.Errorf("primary IP %s does not exist. Run 'gotzer provision' first", cfg.Server.PrimaryIP)
+	}
+	if ip.AssigneeID == target.ID {
+		printSuccess(fmt.Sprintf("Primary IP %s is already assigned to %s", ip.IP, target.Name))
+		reportResult(result{Status: "success", ServerIP: ip.IP.String()})
+		return nil
+	}
+
+	var holder *hcloud.Server
+	if ip.AssigneeID != 0 {
+		if holder, err = hc.GetServerByID(ctx, ip.AssigneeID); err != nil {
+			return err
+		}
+	}
+
+	if !ipReassignYes {
+		if holder != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  %s is shut down and left off without its IPv4 address %s.\n", holder.Name, ip.IP)
+		}
+		fmt.Fprintf(os.Stderr, "⚠️  %s is shut down while its IPv4 address %s is replaced by %s.\n", target.Name, target.PublicNet.IPv4.IP, ip.IP)
+		fmt.Fprint(os.Stderr, "Continue? [y/N]: ")
+		input, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+		if answer := strings.ToLower(strings.TrimSpace(input)); answer != "y" && answer != "yes" {
+			printInfo("Aborted.")
+			return nil
+		}
+	}
+
+	step := report.Start(reporter, "primary_ip", "🌐", fmt.Sprintf("Moving primary IP %s to %s...", ip.IP, target.Name))
+	if holder != nil {
+		report.Info(reporter, "Shutting down %s...", holder.Name)
+		if err := hc.ShutdownServer(ctx, holder, 2*time.Minute); err != nil {
+			return step.Fail(err)
+		}
+		if err := hc.UnassignPrimaryIP(ctx, ip); err != nil {
+			return step.Fail(err)
+		}
+	}
+	report.Info(reporter, "Shutting down %s...", target.Name)
+	if err := hc.ShutdownServer(ctx, target, 2*time.Minute); err != nil {
+		return step.Fail(err)
+	}
+	if err := hc.AssignPrimaryIP(ctx, ip, target); err != nil {
+		return step.Fail(err)
+	}
+	report.Info(reporter, "Powering on %s...", target.Name)
+	if err := hc.PowerOnServer(ctx, target); err != nil {
+		return step.Fail(err)
+	}
+	step.Done()
+
+	// Host keys stay recorded under the server ID
+	target.PublicNet.IPv4.IP = ip.IP
+	step = report.Start(reporter, "verify", "🩺", "Checking the app came back...")
+	if err := verifyServer(ctx, globalCfg, cfg, target, reporter); err != nil {
+		return step.Fail(err)
+	}
+	step.Done()
+
+	if holder != nil {
+		printInfo(fmt.Sprintf("%s is off; destroy it or power it on in the Hetzner Console", holder.Name))
+	}
+	printSuccess(fmt.Sprintf("Primary IP %s is now the address of %s", ip.IP, target.Name))
+	reportResult(result{Status: "success", ServerIP: ip.IP.String()})
+	return nil
+}
+
+// loadIPConfig loads the configs and checks that an IP is configured
+func loadIPConfig() (*config.Config, *hetzner.Client, error) {
+	cfg, hc, err := loadSnapshotConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.Server.FloatingIP == "" && cfg.Server.PrimaryIP == "" {
+		return nil, nil, fmt.Errorf("neither server.floating_ip nor server.primary_ip is set in %s", cfgFileName())
+	}
+	return cfg, hc, nil
+}
+
+// ensureFloatingIP creates or adopts server.floating_ip and assigns it to the
+// first server if it is not assigned yet
+func ensureFloatingIP(ctx context.Context, hc *hetzner.Client, cfg *config.Config, servers []*hcloud.Server) (*hcloud.FloatingIP, error) {
+	step := report.Start(reporter, "floating_ip", "📌", fmt.Sprintf("Configuring floating IP %s...", cfg.Server.FloatingIP))
+	ip, changes, err := hc.EnsureFloatingIP(ctx, cfg.Server.FloatingIP, cfg.Server.Location, cfg.Labels())
+	if err != nil {
+		return nil, step.Fail(err)
+	}
+	if ip.Server == nil && len(servers) > 0 {
+		if err := hc.AssignFloatingIP(ctx, ip, servers[0]); err != nil {
+			return nil, step.Fail(err)
+		}
+		changes = append(changes, fmt.Sprintf("assigned floating IP %s to %s", ip.IP, servers[0].Name))
+	}
+	for _, change := range changes {
+		report.Info(reporter, "%s", change)
+	}
+	if len(changes) == 0 {
+		report.Info(reporter, "Floating IP %s is up to date", ip.IP)
+	}
+	step.Done()
+	return ip, nil
+}
+
+// ensurePrimaryIP creates or adopts server.primary_ip. It returns the address
+// if the first server is about to be created and can get it.
+func ensurePrimaryIP(ctx context.Context, hc *hetzner.Client, cfg *config.Config, existing []*hcloud.Server) (*hcloud.PrimaryIP, error) {
+	step := report.Start(reporter, "primary_ip", "🌐", fmt.Sprintf("Configuring primary IP %s...", cfg.Server.PrimaryIP))
+	ip, changes, err := hc.EnsurePrimaryIP(ctx, cfg.Server.PrimaryIP, cfg.Server.Location, cfg.Labels())
+	if err != nil {
+		return nil, step.Fail(err)
+	}
+	for _, change := range changes {
+		report.Info(reporter, "%s", change)
+	}
+	if len(changes) == 0 {
+		report.Info(reporter, "Primary IP %s is up to date", ip.IP)
+	}
+	step.Done()
+
+	if ip.AssigneeID != 0 {
+		return nil, nil
+	}
+	// Existing servers only get it while they are off
+	if len(existing) > 0 {
+		report.Warn(reporter, "Primary IP %s is not assigned; run 'gotzer ip reassign' to give it to %s (the server restarts)", ip.IP, existing[0].Name)
+		return nil, nil
+	}
+	return ip, nil
+}
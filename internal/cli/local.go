@@ -7,6 +7,7 @@ import (
 
 	"github.com/DawnKosmos/gotzer/internal/config"
 	"github.com/DawnKosmos/gotzer/internal/docker"
+	"github.com/DawnKosmos/gotzer/internal/report"
 	"github.com/spf13/cobra"
 )
 
@@ -49,9 +50,10 @@ func runLocalUp(cmd *cobra.Command, args []string) error {
 	}
 
 	// 2. Run docker compose up -d
+	output := report.Writer(reporter, report.SourceLocal)
 	c := exec.Command("docker", "compose", "up", "-d")
-	c.Stdout = os.Stdout
-	c.Stderr = os.Stderr
+	c.Stdout = output
+	c.Stderr = output
 	if err := c.Run(); err != nil {
 		return fmt.Errorf("failed to start services: %w", err)
 	}
@@ -63,9 +65,10 @@ func runLocalUp(cmd *cobra.Command, args []string) error {
 func runLocalDown(cmd *cobra.Command, args []string) error {
 	printInfo("Stopping local services...")
 
+	output := report.Writer(reporter, report.SourceLocal)
 	c := exec.Command("docker", "compose", "down")
-	c.Stdout = os.Stdout
-	c.Stderr = os.Stderr
+	c.Stdout = output
+	c.Stderr = output
 	if err := c.Run(); err != nil {
 		return fmt.Errorf("failed to stop services: %w", err)
 	}
@@ -85,7 +88,7 @@ func runLocalGen(cmd *cobra.Command, args []string) error {
 
 func generateLocalCompose() error {
 	// Load config
-	cfg, err := config.Load(cfgFile)
+	cfg, err := config.Load(cfgFile, envName)
 	if err != nil {
 		return err
 	}
@@ -1,15 +1,20 @@
 package cli
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 
 	"github.com/DawnKosmos/gotzer/internal/config"
-	"github.com/DawnKosmos/gotzer/internal/hetzner"
-	"github.com/DawnKosmos/gotzer/internal/ssh"
+	"github.com/DawnKosmos/gotzer/internal/deploy"
+	"github.com/DawnKosmos/gotzer/internal/report"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"github.com/spf13/cobra"
 )
 
@@ -26,6 +31,7 @@ var logsCmd = &cobra.Command{
 func init() {
 	logsCmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "Follow log output")
 	logsCmd.Flags().IntVarP(&logsLines, "lines", "n", 50, "Number of lines to show")
+	logsCmd.Flags().StringVar(&serverFlag, "server", "", "Only show logs of this server of a server group")
 }
 
 func runLogs(cmd *cobra.Command, args []string) error {
@@ -41,7 +47,7 @@ func runLogs(cmd *cobra.Command, args []string) error {
 	}()
 
 	// Load configs
-	cfg, err := config.Load(cfgFile)
+	cfg, err := config.Load(cfgFile, envName)
 	if err != nil {
 		return err
 	}
@@ -52,32 +58,101 @@ func runLogs(cmd *cobra.Command, args []string) error {
 	}
 
 	// Get server info
-	hc := hetzner.NewClient(globalCfg.Token)
-	server, err := hc.GetServer(ctx, cfg.Server.Name)
+	hc := newHetznerClient(globalCfg)
+	servers, err := targetServers(ctx, hc, cfg)
 	if err != nil {
 		return err
 	}
-	if server == nil {
-		return fmt.Errorf("server %s not found", cfg.Server.Name)
+
+	if len(servers) == 1 {
+		return streamLogs(ctx, globalCfg, cfg, servers[0], reporter, nil)
+	}
+
+	// Without --follow the servers are shown one after another; when
+	// following, all of them are streamed at once with prefixed lines
+	if !logsFollow {
+		for _, server := range servers {
+			if !jsonOutput() {
+				fmt.Printf("\n==> %s <==\n", server.Name)
+			}
+			if err := streamLogs(ctx, globalCfg, cfg, server, report.WithServer(reporter, server.Name), os.Stdout); err != nil {
+				return fmt.Errorf("%s: %w", server.Name, err)
+			}
+		}
+		return nil
 	}
 
-	serverIP := server.PublicNet.IPv4.IP.String()
+	var mu sync.Mutex
+	errs := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := &prefixWriter{mu: &mu, out: os.Stdout, prefix: "[" + server.Name + "] "}
+			if err := streamLogs(ctx, globalCfg, cfg, server, report.WithServer(reporter, server.Name), w); err != nil && ctx.Err() == nil {
+				errs[i] = fmt.Errorf("%s: %w", server.Name, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
 
+// streamLogs runs journalctl for the app's active unit on one server. Output
+// goes to w, or to the interactive terminal when w is nil.
+func streamLogs(ctx context.Context, globalCfg *globalConfig, cfg *config.Config, server *hcloud.Server, r report.Reporter, w io.Writer) error {
 	// Connect via SSH
-	sshKeyPath := config.ExpandPath(globalCfg.DefaultSSHKey)
-	sshClient := ssh.NewClient(serverIP, "root", sshKeyPath)
+	sshClient := newSSHClient(globalCfg, server)
 	if err := sshClient.Connect(ctx); err != nil {
 		return fmt.Errorf("SSH connection failed: %w", err)
 	}
 	defer sshClient.Close()
 
+	unit, err := deploy.ActiveUnit(ctx, sshClient, cfg)
+	if err != nil {
+		return err
+	}
+
 	// Build journalctl command
-	journalCmd := fmt.Sprintf("journalctl -u %s -n %d --no-pager", cfg.Deploy.ServiceName, logsLines)
+	journalCmd := fmt.Sprintf("journalctl -u %s -n %d --no-pager", unit, logsLines)
 	if logsFollow {
 		journalCmd += " -f"
 	}
 
-	printInfo(fmt.Sprintf("Streaming logs from %s...", cfg.Deploy.ServiceName))
+	report.Info(r, "Streaming logs from %s...", unit)
 
+	if jsonOutput() {
+		return sshClient.RunStream(ctx, journalCmd, report.Writer(r, report.SourceRemote))
+	}
+	if w != nil {
+		return sshClient.RunStream(ctx, journalCmd, w)
+	}
 	return sshClient.RunInteractive(ctx, journalCmd)
 }
+
+// prefixWriter writes complete lines to out, each starting with prefix, so
+// that logs streamed from several servers do not interleave mid-line
+type prefixWriter struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.mu.Lock()
+		_, err := fmt.Fprintf(w.out, "%s%s", w.prefix, w.buf[:i+1])
+		w.mu.Unlock()
+		w.buf = w.buf[i+1:]
+		if err != nil {
+			return len(p), err
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/DawnKosmos/gotzer/internal/hetzner"
+	"github.com/spf13/cobra"
+)
+
+var lsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the resources gotzer manages in the Hetzner project",
+	Long: `Lists servers, volumes, load balancers, firewalls, networks, floating and
+primary IPs, snapshots, SSH keys and certificates labelled with gotzer/app,
+grouped by app and environment. Resources of every app in the project are
+listed unless --app is given. No .gotzer.yaml is needed.`,
+	Args: cobra.NoArgs,
+	RunE: runLs,
+}
+
+var lsApp string
+
+func init() {
+	lsCmd.Flags().StringVar(&lsApp, "app", "", "Only list the resources of this app")
+}
+
+func runLs(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	globalCfg, err := loadGlobalConfig()
+	if err != nil {
+		return err
+	}
+
+	selector := "gotzer/app"
+	if lsApp != "" {
+		selector = "gotzer/app=" + lsApp
+	}
+	hc := newHetznerClient(globalCfg)
+	resources, err := hc.ListResources(ctx, selector)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput() {
+		if resources == nil {
+			resources = []hetzner.Resource{}
+		}
+		reportResult(resources)
+		return nil
+	}
+
+	if len(resources) == 0 {
+		printInfo("No resources labelled gotzer/app found")
+		return nil
+	}
+	group := ""
+	for _, res := range resources {
+		name := res.App
+		if res.Env != "" {
+			name += " (" + res.Env + ")"
+		}
+		if name != group {
+			group = name
+			fmt.Printf("\n📋 %s\n", name)
+			fmt.Println("────────────────────────────────────")
+		}
+		fmt.Printf("  %-15s %-10d %-28s %s\n", res.Kind, res.ID, res.Name, res.Detail)
+	}
+	fmt.Println()
+	return nil
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/hetzner"
+	"github.com/DawnKosmos/gotzer/internal/report"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// ensureNetwork creates or updates the private network and attaches the servers to it
+func ensureNetwork(ctx context.Context, hc *hetzner.Client, cfg *config.Config, servers []*hcloud.Server) (*hcloud.Network, error) {
+	step := report.Start(reporter, "private_network", "🔗", fmt.Sprintf("Configuring private network %s...", cfg.Network.Name))
+	network, changes, err := hc.EnsureNetwork(ctx, cfg.Network, cfg.Labels(), servers)
+	if err != nil {
+		return nil, step.Fail(err)
+	}
+	for _, change := range changes {
+		report.Info(reporter, "%s", change)
+	}
+	if len(changes) == 0 {
+		report.Info(reporter, "Network is up to date")
+	}
+	step.Done()
+	return network, nil
+}
+
+// resolveNetwork looks up the private IPs of the servers in the network and
+// expands the private_ip templates in deploy.env with them. It returns the
+// IPs by server name; without a network section it does nothing.
+func resolveNetwork(ctx context.Context, hc *hetzner.Client, cfg *config.Config, pending ...string) (map[string]string, error) {
+	if cfg.Network == nil {
+		return nil, nil
+	}
+
+	ips := make(map[string]string)
+	network, err := hc.GetNetwork(ctx, cfg.Network.Name)
+	if err != nil {
+		return nil, err
+	}
+	if network != nil {
+		if ips, err = hc.PrivateIPs(ctx, network); err != nil {
+			return nil, err
+		}
+	}
+	// Servers about to be created only get their IPs then
+	for _, name := range pending {
+		if _, ok := ips[name]; !ok {
+			ips[name] = "<private IP of " + name + ">"
+		}
+	}
+	return ips, cfg.ExpandPrivateIPs(ips)
+}
@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/plan"
+	"github.com/DawnKosmos/gotzer/internal/secrets"
+	"github.com/DawnKosmos/gotzer/internal/ssh"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/spf13/cobra"
+)
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show what provision and deploy would change",
+	Long: `Connects to the server and prints a unified diff between its current
+state and what gotzer would write: Hetzner server attributes, docker-compose.yml,
+UFW rules, the systemd unit, the environment file (values hashed) and the
+Caddyfile. Nothing is changed.
+
+Exits with status 2 when changes are pending, so CI can gate on drift.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runPlan(context.Background(), plan.ScopeAll)
+	},
+}
+
+func init() {
+	planCmd.Flags().StringVar(&serverFlag, "server", "", "Only plan this server of a server group")
+}
+
+// runPlan computes and prints the plan for the given scope. It returns an
+// exitError with status 2 if anything would change.
+func runPlan(ctx context.Context, scope plan.Scope) error {
+	// Load configs
+	cfg, err := config.Load(cfgFile, envName)
+	if err != nil {
+		return err
+	}
+
+	globalCfg, err := loadGlobalConfig()
+	if err != nil {
+		return err
+	}
+
+	secrets, err := loadSecrets(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Get server info
+	hc := newHetznerClient(globalCfg)
+	var servers []*hcloud.Server
+	var missing []string
+	if serverFlag != "" {
+		servers, err = targetServers(ctx, hc, cfg)
+	} else {
+		servers, missing, err = findServers(ctx, hc, cfg)
+	}
+	if err != nil {
+		return err
+	}
+
+	ips, err := resolveNetwork(ctx, hc, cfg, missing...)
+	if err != nil {
+		return err
+	}
+
+	// Every member of a server group is planned with its own name
+	var plans []serverPlan
+	for _, server := range servers {
+		p, err := computePlan(ctx, globalCfg, cfg.WithPrivateIP(ips[server.Name]), server.Name, server, secrets, scope)
+		if err != nil {
+			return err
+		}
+		plans = append(plans, serverPlan{server.Name, p})
+	}
+	for _, name := range missing {
+		p, err := computePlan(ctx, globalCfg, cfg.WithPrivateIP(ips[name]), name, nil, secrets, scope)
+		if err != nil {
+			return err
+		}
+		plans = append(plans, serverPlan{name, p})
+	}
+	if len(plans) == 0 {
+		return fmt.Errorf("no servers match selector %q", cfg.Server.Selector)
+	}
+
+	if jsonOutput() {
+		reportPlan(plans)
+	} else {
+		for _, sp := range plans {
+			if len(plans) > 1 {
+				fmt.Printf("\n🖥️  %s\n", sp.server)
+			}
+			sp.plan.Print(os.Stdout)
+		}
+	}
+	for _, sp := range plans {
+		if sp.plan.HasChanges() {
+			return &exitError{code: 2, msg: "changes pending"}
+		}
+	}
+	return nil
+}
+
+// serverPlan is the plan for one server of the app
+type serverPlan struct {
+	server string
+	plan   *plan.Plan
+}
+
+// computePlan compares one server, which may be nil if it does not exist yet,
+// against the configuration
+func computePlan(ctx context.Context, globalCfg *globalConfig, cfg *config.Config, name string, server *hcloud.Server, s *secrets.Secrets, scope plan.Scope) (*plan.Plan, error) {
+	memberCfg := *cfg
+	memberCfg.Server.Name = name
+	memberCfg.Server.Location = cfg.Server.ServerLocation(name)
+
+	var sshClient *ssh.Client
+	if server != nil {
+		printInfo(fmt.Sprintf("Comparing %s (%s) with %s...", name, serverIP(server), cfgFileName()))
+		sshClient = newSSHClient(globalCfg, server)
+		if err := sshClient.Connect(ctx); err != nil {
+			return nil, fmt.Errorf("SSH connection to %s failed: %w", name, err)
+		}
+		defer sshClient.Close()
+	} else {
+		printInfo(fmt.Sprintf("Server %s does not exist yet; everything would be created", name))
+	}
+
+	return plan.Compute(ctx, &memberCfg, server, sshClient, s, scope)
+}
+
+// planChange is a single resource in the JSON plan result
+type planChange struct {
+	Server  string `json:"server"`
+	Name    string `json:"name"`
+	Changed bool   `json:"changed"`
+	Diff    string `json:"diff,omitempty"`
+}
+
+// reportPlan emits the plans as the command result
+func reportPlan(plans []serverPlan) {
+	changes := []planChange{}
+	status := "up_to_date"
+	for _, sp := range plans {
+		for _, c := range sp.plan.Changes {
+			diff := c.Diff()
+			changes = append(changes, planChange{Server: sp.server, Name: c.Name, Changed: diff != "", Diff: diff})
+		}
+		if sp.plan.HasChanges() {
+			status = "changes_pending"
+		}
+	}
+	reportResult(struct {
+		Status  string       `json:"status"`
+		Changes []planChange `json:"changes"`
+	}{status, changes})
+}
+
+// cfgFileName returns the config file name for messages
+func cfgFileName() string {
+	if cfgFile == "" {
+		return ".gotzer.yaml"
+	}
+	return cfgFile
+}
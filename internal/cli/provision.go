@@ -1,16 +1,24 @@
 package cli
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/DawnKosmos/gotzer/internal/config"
 	"github.com/DawnKosmos/gotzer/internal/hetzner"
+	"github.com/DawnKosmos/gotzer/internal/plan"
 	"github.com/DawnKosmos/gotzer/internal/provision"
+	"github.com/DawnKosmos/gotzer/internal/report"
+	"github.com/DawnKosmos/gotzer/internal/secrets"
 	"github.com/DawnKosmos/gotzer/internal/ssh"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"github.com/spf13/cobra"
 )
 
@@ -18,27 +26,38 @@ var provisionCmd = &cobra.Command{
 	Use:   "provision",
 	Short: "Provision a new Hetzner server with all services",
 	Long: `Creates a new Hetzner Cloud server and sets up:
-  - Docker and Docker Compose
-  - Application user and directories
+  - System updates, Docker, the app user and directories and UFW, through
+    cloud-init on the first boot (over SSH for existing servers)
   - Systemd service for your app
   - PostgreSQL, Typesense, and other Docker services (if enabled)
-  - UFW firewall rules`,
+  - Caddy reverse proxy with automatic HTTPS (if configured)
+  - Hetzner Load Balancer, Cloud Firewall and private network (if configured)`,
 	RunE: runProvision,
 }
 
 var sshKeyName string
 var provisionUpdate bool
+var provisionDryRun bool
+var provisionFromSnapshot int64
+var provisionYes bool
 
 func init() {
 	provisionCmd.Flags().StringVar(&sshKeyName, "ssh-key", "", "SSH key name in Hetzner (uses first available if not set)")
 	provisionCmd.Flags().BoolVar(&provisionUpdate, "update", false, "Update an existing server (sync configuration and services)")
+	provisionCmd.Flags().BoolVar(&provisionDryRun, "dry-run", false, "Show what provision would change without changing anything")
+	provisionCmd.Flags().BoolVarP(&provisionYes, "yes", "y", false, "Skip the cost estimate confirmation")
+	provisionCmd.Flags().Int64Var(&provisionFromSnapshot, "from-snapshot", 0, "Create the new servers from this snapshot ID instead of server.image")
 }
 
 func runProvision(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
 
+	if provisionDryRun {
+		return runPlan(ctx, plan.ScopeAll)
+	}
+
 	// Load configs
-	cfg, err := config.Load(cfgFile)
+	cfg, err := config.Load(cfgFile, envName)
 	if err != nil {
 		return err
 	}
@@ -48,27 +67,68 @@ func runProvision(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	secrets, err := loadSecrets(cfg)
+	if err != nil {
+		return err
+	}
+
 	// Create Hetzner client
-	hc := hetzner.NewClient(globalCfg.Token)
+	hc := newHetznerClient(globalCfg)
 
-	// Check if server already exists
-	existing, err := hc.GetServer(ctx, cfg.Server.Name)
+	// Check which servers already exist
+	existing, missing, err := findServers(ctx, hc, cfg)
 	if err != nil {
 		return err
 	}
-
-	var serverIP string
-	if existing != nil {
+	if cfg.Server.Selector != "" {
+		if len(existing) == 0 {
+			return fmt.Errorf("no servers match selector %q; servers selected by label must be created outside gotzer", cfg.Server.Selector)
+		}
 		if !provisionUpdate {
+			return fmt.Errorf("servers selected by label already exist. Use 'gotzer provision --update' to sync services")
+		}
+	}
+	if len(existing) > 0 && !provisionUpdate {
+		if len(existing) == 1 && len(missing) == 0 {
 			return fmt.Errorf("server %s already exists (IP: %s). Use 'gotzer provision --update' to sync services",
-				cfg.Server.Name, existing.PublicNet.IPv4.IP.String())
+				existing[0].Name, serverIP(existing[0]))
 		}
-		serverIP = existing.PublicNet.IPv4.IP.String()
-		printInfo(fmt.Sprintf("Using existing server %s (IP: %s)...", cfg.Server.Name, serverIP))
-	} else {
-		// New server creation logic...
-		// Get SSH key
-		var sshKeys []string
+		return fmt.Errorf("servers %s already exist. Use 'gotzer provision --update' to sync services and create the missing ones",
+			strings.Join(serverNames(existing), ", "))
+	}
+	for _, server := range existing {
+		if err := checkEnvironment(cfg, server); err != nil {
+			return err
+		}
+	}
+
+	if provisionFromSnapshot != 0 {
+		if len(missing) == 0 {
+			return fmt.Errorf("--from-snapshot only applies to new servers, and all servers already exist")
+		}
+		// Snapshots of another environment are fine, that is how it is cloned
+		snapshot, err := getAppSnapshot(ctx, hc, cfg, strconv.FormatInt(provisionFromSnapshot, 10))
+		if err != nil {
+			return err
+		}
+		printInfo(fmt.Sprintf("Creating %s from snapshot %d (%s)", strings.Join(missing, ", "), snapshot.ID, snapshot.Description))
+	}
+
+	// New servers cost money, so show what the config costs first
+	if len(missing) > 0 && !provisionYes {
+		ok, err := confirmCost(ctx, hc, cfg, missing)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			printInfo("Aborted.")
+			return nil
+		}
+	}
+
+	// Get SSH key for the servers to be created
+	var sshKeys []string
+	if len(missing) > 0 {
 		if sshKeyName != "" {
 			sshKeys = []string{sshKeyName}
 		} else {
@@ -77,39 +137,337 @@ func runProvision(cmd *cobra.Command, args []string) error {
 				return fmt.Errorf("failed to list SSH keys: %w", err)
 			}
 			if len(keys) == 0 {
-				return fmt.Errorf("no SSH keys found")
+				key, err := uploadSSHKey(ctx, hc, globalCfg, cfg)
+				if err != nil {
+					return err
+				}
+				keys = append(keys, key)
 			}
 			sshKeys = []string{keys[0].Name}
 			printInfo(fmt.Sprintf("Using SSH key: %s", keys[0].Name))
 		}
+	}
+
+	// The cloud firewall is in place before new servers boot
+	var firewalls []int64
+	if cfg.Firewall != nil {
+		fw, err := ensureFirewall(ctx, hc, cfg, existing)
+		if err != nil {
+			return err
+		}
+		firewalls = append(firewalls, fw.ID)
+	}
+
+	// The private network exists before new servers are created in it
+	var networks []int64
+	if cfg.Network != nil {
+		network, err := ensureNetwork(ctx, hc, cfg, existing)
+		if err != nil {
+			return err
+		}
+		networks = append(networks, network.ID)
+	}
 
-		printInfo(fmt.Sprintf("Creating server %s (%s in %s)...",
-			cfg.Server.Name, cfg.Server.Type, cfg.Server.Location))
+	// New servers are created in the placement group
+	var placementGroup int64
+	if cfg.Server.PlacementGroup != "" {
+		pg, err := ensurePlacementGroup(ctx, hc, cfg, existing)
+		if err != nil {
+			return err
+		}
+		placementGroup = pg.ID
+	}
+
+	// The primary IP exists before the first server is created with it
+	var primaryIP *hcloud.PrimaryIP
+	if cfg.Server.PrimaryIP != "" && len(missing) > 0 {
+		if primaryIP, err = ensurePrimaryIP(ctx, hc, cfg, existing); err != nil {
+			return err
+		}
+	}
+
+	group := len(existing)+len(missing) > 1
+	serverReporter := func(name string) report.Reporter {
+		if group {
+			return report.WithServer(reporter, name)
+		}
+		return reporter
+	}
+
+	// New servers are created before any server is set up, so that deploy.env
+	// can reference the private IP of every one of them
+	servers := existing
+	renamed := renames(cfg, existing)
+	for _, server := range existing {
+		if name, ok := renamed[server]; ok {
+			if err := renameServer(ctx, hc, cfg, server, name, serverReporter(name)); err != nil {
+				return err
+			}
+		}
+		if err := hc.EnsureServerLabels(ctx, server, cfg.Labels()); err != nil {
+			return err
+		}
+		if err := ensureBackups(ctx, hc, cfg, server, serverReporter(server.Name)); err != nil {
+			return err
+		}
+		if location := cfg.Server.ServerLocation(server.Name); server.Datacenter.Location.Name != location {
+			report.Warn(serverReporter(server.Name), "%s is in %s but the config places it in %s; servers cannot move, destroy and provision it to recreate it there",
+				server.Name, server.Datacenter.Location.Name, location)
+		}
+		// Changing the type needs a restart, which provision does not do
+		if server.ServerType.Name != cfg.Server.Type {
+			report.Warn(serverReporter(server.Name), "%s is a %s but server.type is %s; run 'gotzer rescale' to change it (the server restarts)",
+				server.Name, server.ServerType.Name, cfg.Server.Type)
+		}
+	}
+	for _, name := range missing {
+		// Primary IPs are bound to their location
+		var primaryIPID int64
+		if primaryIP != nil && cfg.Server.ServerLocation(name) == cfg.Server.Location {
+			primaryIPID, primaryIP = primaryIP.ID, nil
+		}
+		server, err := createServer(ctx, hc, cfg, name, sshKeys, firewalls, networks, primaryIPID, placementGroup, serverReporter(name))
+		if err != nil {
+			return err
+		}
+		if err := ensureBackups(ctx, hc, cfg, server, serverReporter(name)); err != nil {
+			return err
+		}
+		servers = append(servers, server)
+	}
+	privateIPs, err := resolveNetwork(ctx, hc, cfg)
+	if err != nil {
+		return err
+	}
+
+	// The floating IP is configured on every server so it can be moved freely
+	var floatingIP *hcloud.FloatingIP
+	var floatingAddr string
+	if cfg.Server.FloatingIP != "" {
+		if floatingIP, err = ensureFloatingIP(ctx, hc, cfg, servers); err != nil {
+			return err
+		}
+		floatingAddr = floatingIP.IP.String()
+	}
+
+	// Servers are set up one after another, existing ones first
+	var ready []*hcloud.Server
+	for i, server := range servers {
+		r := serverReporter(server.Name)
+		if i < len(existing) {
+			report.Info(r, "Using existing server %s (IP: %s)...", server.Name, publicIP(server))
+		}
+		// New servers were set up by cloud-init on their first boot
+		cloudInit := i >= len(existing)
+		if err := setupServer(ctx, hc, globalCfg, cfg.WithPrivateIP(privateIPs[server.Name]), secrets, server, cloudInit, floatingAddr, r); err != nil {
+			return err
+		}
+		ready = append(ready, server)
+	}
 
-		server, err := hc.CreateServer(ctx, hetzner.ServerOpts{
-			Name:        cfg.Server.Name,
-			Location:    cfg.Server.Location,
-			ServerType:  cfg.Server.Type,
-			Image:       cfg.Server.Image,
-			SSHKeyNames: sshKeys,
-		})
+	out := result{Status: "success"}
+	if cfg.LoadBalancer != nil {
+		lbIP, err := ensureLoadBalancer(ctx, hc, cfg, ready)
 		if err != nil {
 			return err
 		}
-		serverIP = server.PublicNet.IPv4.IP.String()
-		printSuccess(fmt.Sprintf("Server created! IP: %s", serverIP))
+		out.LoadBalancerIP = lbIP
+	}
+	if cfg.DNS != nil {
+		if err := syncDNS(ctx, hc, newDNSClient(globalCfg), cfg, ready); err != nil {
+			return err
+		}
+	}
+
+	ips := make([]string, len(ready))
+	for i, server := range ready {
+		ips[i] = publicIP(server)
+	}
+	if group {
+		printSuccess(fmt.Sprintf("%d servers ready! Run 'gotzer deploy' to deploy your app.", len(ips)))
+		printInfo(fmt.Sprintf("Server IPs: %s", strings.Join(ips, ", ")))
+		out.Servers = serverNames(ready)
+	} else {
+		printSuccess("Server ready! Run 'gotzer deploy' to deploy your app.")
+		printInfo(fmt.Sprintf("Server IP: %s", ips[0]))
+		out.ServerIP = ips[0]
+	}
+	if out.LoadBalancerIP != "" {
+		printInfo(fmt.Sprintf("Load balancer IP: %s", out.LoadBalancerIP))
+	}
+	if floatingIP != nil {
+		printInfo(fmt.Sprintf("Floating IP: %s", floatingAddr))
+		if cfg.Proxy != nil && len(cfg.Proxy.Domains) > 0 {
+			printInfo(fmt.Sprintf("Point %s at %s", strings.Join(cfg.Proxy.Domains, ", "), floatingAddr))
+		}
+		if !group {
+			out.ServerIP = floatingAddr
+		}
+	}
+	reportResult(out)
+
+	return nil
+}
+
+// ensureLoadBalancer creates or updates the load balancer in front of the
+// servers and returns its public IP
+func ensureLoadBalancer(ctx context.Context, hc *hetzner.Client, cfg *config.Config, servers []*hcloud.Server) (string, error) {
+	step := report.Start(reporter, "load_balancer", "🔀", fmt.Sprintf("Configuring load balancer %s...", cfg.LoadBalancer.Name))
+	lb, changes, err := hc.EnsureLoadBalancer(ctx, cfg.LoadBalancer, cfg.Labels(), servers)
+	if err != nil {
+		return "", step.Fail(err)
+	}
+	for _, change := range changes {
+		report.Info(reporter, "%s", change)
+	}
+	if len(changes) == 0 {
+		report.Info(reporter, "Load balancer is up to date")
+	}
+	step.Done()
+
+	if len(cfg.LoadBalancer.Domains) > 0 {
+		report.Info(reporter, "Point %s at %s; the certificate is issued once DNS resolves",
+			strings.Join(cfg.LoadBalancer.Domains, ", "), lb.PublicNet.IPv4.IP)
+	}
+	return lb.PublicNet.IPv4.IP.String(), nil
+}
+
+// ensurePlacementGroup creates or adopts the servers' spread placement group.
+// Existing servers can only join it while they are off, which provision does
+// not do.
+func ensurePlacementGroup(ctx context.Context, hc *hetzner.Client, cfg *config.Config, existing []*hcloud.Server) (*hcloud.PlacementGroup, error) {
+	name := cfg.Server.PlacementGroupName()
+	step := report.Start(reporter, "placement_group", "🧩", fmt.Sprintf("Configuring placement group %s...", name))
+	pg, changes, err := hc.EnsurePlacementGroup(ctx, name, cfg.Labels())
+	if err != nil {
+		return nil, step.Fail(err)
+	}
+	for _, change := range changes {
+		report.Info(reporter, "%s", change)
+	}
+	if len(changes) == 0 {
+		report.Info(reporter, "Placement group is up to date")
+	}
+	step.Done()
+
+	for _, server := range existing {
+		if !slices.Contains(pg.Servers, server.ID) {
+			report.Warn(reporter, "%s is not in placement group %s; servers only join it when they are created", server.Name, name)
+		}
+	}
+	return pg, nil
+}
+
+// createServer creates a new app server named name in its location, with the
+// Primary IP primaryIP as its IPv4 address and in the placement group
+// placementGroup if they are not zero
+func createServer(ctx context.Context, hc *hetzner.Client, cfg *config.Config, name string, sshKeys []string, firewalls, networks []int64, primaryIP, placementGroup int64, r report.Reporter) (*hcloud.Server, error) {
+	location := cfg.Server.ServerLocation(name)
+	report.Info(r, "Creating server %s (%s in %s)...", name, cfg.Server.Type, location)
+
+	userData, err := provision.UserData(cfg)
+	if err != nil {
+		return nil, err
+	}
+	server, err := hc.CreateServer(ctx, hetzner.ServerOpts{
+		Name:           name,
+		Location:       location,
+		ServerType:     cfg.Server.Type,
+		Image:          cfg.Server.Image,
+		SnapshotID:     provisionFromSnapshot,
+		PrimaryIPv4:    primaryIP,
+		NoIPv4:         !cfg.Server.IPv4Enabled(),
+		PlacementGroup: placementGroup,
+		SSHKeyNames:    sshKeys,
+		Labels:         cfg.Labels(),
+		Firewalls:      firewalls,
+		Networks:       networks,
+		UserData:       userData,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ip := publicIP(server)
+	report.Success(r, "", "Server created! IP: %s", ip)
+
+	// Hetzner reuses IPs, so forget keys recorded for previous servers on this address.
+	// The new host key is recorded on first connect.
+	if _, err := ssh.DefaultKnownHosts().Remove(0, ip); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// confirmCost prints the estimated cost of the config and asks whether to
+// create the missing servers
+func confirmCost(ctx context.Context, hc *hetzner.Client, cfg *config.Config, missing []string) (bool, error) {
+	prices, err := hc.GetPrices(ctx)
+	if err == nil {
+		var estimate *hetzner.Cost
+		if estimate, err = hetzner.EstimateCost(cfg, prices); err == nil {
+			printCost(os.Stderr, fmt.Sprintf("Estimated cost of %s", cfgFileName()), estimate)
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+	if err != nil {
+		report.Warn(reporter, "Could not estimate the cost: %v", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Create %s? [y/N]: ", strings.Join(missing, ", "))
+	input, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, fmt.Errorf("failed to read input: %w", err)
+	}
+	answer := strings.ToLower(strings.TrimSpace(input))
+	return answer == "y" || answer == "yes", nil
+}
+
+// renameServer renames a server found by its labels, and its volumes, to
+// the name it has in the config
+func renameServer(ctx context.Context, hc *hetzner.Client, cfg *config.Config, server *hcloud.Server, name string, r report.Reporter) error {
+	report.Info(r, "Renaming server %s to %s...", server.Name, name)
+	for _, v := range cfg.Server.Volumes {
+		if err := hc.RenameVolume(ctx, v.VolumeName(server.Name), v.VolumeName(name)); err != nil {
+			return err
+		}
+	}
+	return hc.RenameServer(ctx, server, name)
+}
+
+// ensureBackups enables Hetzner's automatic backups if server.backups is set.
+// Backups are never disabled here, since that deletes the existing ones.
+func ensureBackups(ctx context.Context, hc *hetzner.Client, cfg *config.Config, server *hcloud.Server, r report.Reporter) error {
+	if !cfg.Server.BackupsEnabled() {
+		if server.BackupWindow != "" && cfg.Server.Backups != nil {
+			report.Warn(r, "Backups are enabled for %s; disable them in the Hetzner Console to delete its backups", server.Name)
+		}
+		return nil
+	}
+	if server.BackupWindow != "" {
+		return nil
+	}
+	report.Info(r, "Enabling automatic backups for %s...", server.Name)
+	return hc.EnableBackups(ctx, server)
+}
+
+// setupServer attaches the server's volumes, waits for SSH and runs the
+// provisioner. With cloudInit it waits for the first-boot setup instead of
+// installing the base system over SSH; a floatingIP is configured on the host.
+func setupServer(ctx context.Context, hc *hetzner.Client, globalCfg *globalConfig, cfg *config.Config, s *secrets.Secrets, server *hcloud.Server, cloudInit bool, floatingIP string, r report.Reporter) error {
+	devices, err := ensureVolumes(ctx, hc, cfg, server, r)
+	if err != nil {
+		return err
 	}
 
 	// Wait for SSH to be available
-	printInfo("Waiting for SSH to be available...")
-	if err := ssh.WaitForSSH(ctx, serverIP, 2*time.Minute); err != nil {
+	report.Info(r, "Waiting for SSH to be available...")
+	if err := ssh.WaitForSSH(ctx, serverIP(server), 2*time.Minute); err != nil {
 		return fmt.Errorf("SSH not available: %w", err)
 	}
-	printSuccess("SSH is ready")
+	report.Success(r, "", "SSH is ready")
 
 	// Connect via SSH
-	sshKeyPath := config.ExpandPath(globalCfg.DefaultSSHKey)
-	sshClient := ssh.NewClient(serverIP, "root", sshKeyPath)
+	sshClient := newSSHClient(globalCfg, server)
 	if err := sshClient.Connect(ctx); err != nil {
 		return fmt.Errorf("SSH connection failed: %w", err)
 	}
@@ -117,14 +475,50 @@ func runProvision(cmd *cobra.Command, args []string) error {
 
 	// Run provisioning
 	prov := provision.NewProvisioner(cfg, sshClient)
-	if err := prov.Setup(ctx); err != nil {
-		return err
+	prov.Secrets = s
+	prov.Reporter = r
+	prov.Volumes = devices
+	prov.CloudInit = cloudInit
+	prov.FloatingIP = floatingIP
+	return prov.Setup(ctx)
+}
+
+// ensureVolumes creates or attaches the server's volumes and returns their
+// Linux devices by configured name
+func ensureVolumes(ctx context.Context, hc *hetzner.Client, cfg *config.Config, server *hcloud.Server, r report.Reporter) (map[string]string, error) {
+	if len(cfg.Server.Volumes) == 0 {
+		return nil, nil
 	}
 
-	printSuccess("\n✅ Server ready! Run 'gotzer deploy' to deploy your app.")
-	printInfo(fmt.Sprintf("Server IP: %s", serverIP))
+	step := report.Start(r, "attach_volumes", "💽", "Attaching volumes...")
+	devices := make(map[string]string, len(cfg.Server.Volumes))
+	for _, v := range cfg.Server.Volumes {
+		volume, changes, err := hc.EnsureVolume(ctx, v.VolumeName(server.Name), v.Size, server, cfg.Labels())
+		if err != nil {
+			return nil, step.Fail(err)
+		}
+		for _, change := range changes {
+			report.Info(r, "%s", change)
+		}
+		if volume.Size > v.Size {
+			report.Warn(r, "Volume %s is %d GB, more than the configured %d GB; volumes cannot shrink", volume.Name, volume.Size, v.Size)
+		}
+		devices[v.Name] = volume.LinuxDevice
+	}
+	step.Done()
+	return devices, nil
+}
 
-	return nil
+// uploadSSHKey adds the public half of the default SSH key to the Hetzner
+// project, for projects that have no SSH keys yet
+func uploadSSHKey(ctx context.Context, hc *hetzner.Client, globalCfg *globalConfig, cfg *config.Config) (*hcloud.SSHKey, error) {
+	pubPath := config.ExpandPath(globalCfg.DefaultSSHKey) + ".pub"
+	publicKey, err := os.ReadFile(pubPath)
+	if err != nil {
+		return nil, fmt.Errorf("no SSH keys found in the Hetzner project, and %s cannot be uploaded: %w", pubPath, err)
+	}
+	printInfo(fmt.Sprintf("Uploading SSH key %s...", pubPath))
+	return hc.CreateSSHKey(ctx, "gotzer-"+cfg.Name, strings.TrimSpace(string(publicKey)), cfg.Labels())
 }
 
 // findSSHKey looks for an SSH key file
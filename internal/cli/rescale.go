@@ -0,0 +1,241 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/deploy"
+	"github.com/DawnKosmos/gotzer/internal/hetzner"
+	"github.com/DawnKosmos/gotzer/internal/report"
+	"github.com/DawnKosmos/gotzer/internal/ssh"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/spf13/cobra"
+)
+
+var rescaleCmd = &cobra.Command{
+	Use:   "rescale",
+	Short: "Change the servers to the configured server.type",
+	Long: `Compares each server's type with server.type and changes the ones that
+differ. Servers are rescaled one at a time:
+  1. Takes the server out of the load balancer (if configured)
+  2. Shuts it down gracefully
+  3. Changes the server type
+  4. Powers it on and waits for SSH
+  5. Checks the app service (and deploy.health_check) came back
+
+The disk grows with the new type unless --keep-disk is given. Keeping it lets
+you go back to a smaller type later.`,
+	Args: cobra.NoArgs,
+	RunE: runRescale,
+}
+
+var rescaleKeepDisk bool
+var rescaleYes bool
+
+func init() {
+	rescaleCmd.Flags().BoolVar(&rescaleKeepDisk, "keep-disk", false, "Keep the disk size so the server can be downgraded again")
+	rescaleCmd.Flags().BoolVarP(&rescaleYes, "yes", "y", false, "Skip confirmation prompt")
+	rescaleCmd.Flags().StringVar(&serverFlag, "server", "", "Only rescale this server of a server group")
+}
+
+func runRescale(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	// Load configs
+	cfg, err := config.Load(cfgFile, envName)
+	if err != nil {
+		return err
+	}
+
+	globalCfg, err := loadGlobalConfig()
+	if err != nil {
+		return err
+	}
+
+	hc := newHetznerClient(globalCfg)
+	servers, err := targetServers(ctx, hc, cfg)
+	if err != nil {
+		return err
+	}
+
+	// Check every change before stopping anything
+	var rescale []*hcloud.Server
+	var serverType *hcloud.ServerType
+	for _, server := range servers {
+		if err := checkEnvironment(cfg, server); err != nil {
+			return err
+		}
+		if server.ServerType.Name == cfg.Server.Type {
+			continue
+		}
+		if serverType, err = hc.CheckServerType(ctx, server, cfg.Server.Type); err != nil {
+			return err
+		}
+		rescale = append(rescale, server)
+	}
+	if len(rescale) == 0 {
+		printSuccess(fmt.Sprintf("All servers are already %s", cfg.Server.Type))
+		reportResult(result{Status: "success"})
+		return nil
+	}
+
+	if !rescaleYes {
+		for _, server := range rescale {
+			fmt.Fprintf(os.Stderr, "  %s: %s → %s\n", server.Name, server.ServerType.Name, cfg.Server.Type)
+		}
+		fmt.Fprint(os.Stderr, "⚠️  Each server is shut down while it is rescaled, which takes a few minutes.\n")
+		if !rescaleKeepDisk {
+			fmt.Fprint(os.Stderr, "   The disk grows with the new type, so it cannot be downgraded later (see --keep-disk).\n")
+		}
+		fmt.Fprint(os.Stderr, "Continue? [y/N]: ")
+		input, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+		if answer := strings.ToLower(strings.TrimSpace(input)); answer != "y" && answer != "yes" {
+			printInfo("Aborted.")
+			return nil
+		}
+	}
+
+	// Servers behind the load balancer are taken out of rotation, one at a time
+	targets := make([]deploy.Target, len(rescale))
+	for i, server := range rescale {
+		targets[i].Name = server.Name
+	}
+	if err := addDraining(ctx, hc, cfg, rescale, targets, 1); err != nil {
+		return err
+	}
+
+	group := len(servers) > 1
+	for i, server := range rescale {
+		r := reporter
+		if group {
+			r = report.WithServer(reporter, server.Name)
+		}
+		if err := rescaleServer(ctx, hc, globalCfg, cfg, server, serverType, targets[i], r); err != nil {
+			return err
+		}
+	}
+
+	printSuccess(fmt.Sprintf("Rescaled %s to %s", strings.Join(serverNames(rescale), ", "), cfg.Server.Type))
+	reportResult(result{Status: "success", Servers: serverNames(rescale)})
+	return nil
+}
+
+// rescaleServer changes the type of one server and checks the app came back.
+// A drained server is returned to the load balancer even if that fails.
+func rescaleServer(ctx context.Context, hc *hetzner.Client, globalCfg *globalConfig, cfg *config.Config, server *hcloud.Server, serverType *hcloud.ServerType, t deploy.Target, r report.Reporter) error {
+	if t.Drain != nil {
+		step := report.Start(r, "drain", "🚦", "Removing from load balancer...")
+		if err := t.Drain(ctx); err != nil {
+			return step.Fail(err)
+		}
+		step.Done()
+	}
+
+	err := changeServerType(ctx, hc, server, serverType, r)
+	if err == nil {
+		step := report.Start(r, "verify", "🩺", "Checking the app came back...")
+		if err = verifyServer(ctx, globalCfg, cfg, server, r); err != nil {
+			step.Fail(err)
+		} else {
+			step.Done()
+		}
+	}
+
+	if t.Restore != nil {
+		step := report.Start(r, "restore", "🔀", "Adding back to load balancer...")
+		if rerr := t.Restore(ctx); rerr != nil {
+			return errors.Join(err, step.Fail(rerr))
+		}
+		step.Done()
+	}
+	return err
+}
+
+// changeServerType stops the server, changes its type and starts it again.
+// If the type change fails the server is started with its old type.
+func changeServerType(ctx context.Context, hc *hetzner.Client, server *hcloud.Server, serverType *hcloud.ServerType, r report.Reporter) error {
+	step := report.Start(r, "rescale", "📐", fmt.Sprintf("Rescaling %s from %s to %s...", server.Name, server.ServerType.Name, serverType.Name))
+	report.Info(r, "Shutting down...")
+	if err := hc.ShutdownServer(ctx, server, 2*time.Minute); err != nil {
+		return step.Fail(err)
+	}
+	report.Info(r, "Changing server type...")
+	if err := hc.ChangeServerType(ctx, server, serverType, !rescaleKeepDisk); err != nil {
+		report.Info(r, "Powering on with the old type...")
+		return step.Fail(errors.Join(err, hc.PowerOnServer(ctx, server)))
+	}
+	report.Info(r, "Powering on...")
+	if err := hc.PowerOnServer(ctx, server); err != nil {
+		return step.Fail(err)
+	}
+	step.Done()
+	return nil
+}
+
+// verifyServer waits for SSH and checks that the app service is running and,
+// if configured, healthy
+func verifyServer(ctx context.Context, globalCfg *globalConfig, cfg *config.Config, server *hcloud.Server, r report.Reporter) error {
+	if err := ssh.WaitForSSH(ctx, serverIP(server), 5*time.Minute); err != nil {
+		return fmt.Errorf("SSH not available: %w", err)
+	}
+	report.Info(r, "SSH is ready")
+
+	sshClient := newSSHClient(globalCfg, server)
+	if err := sshClient.Connect(ctx); err != nil {
+		return fmt.Errorf("SSH connection failed: %w", err)
+	}
+	defer sshClient.Close()
+
+	if cfg.Deploy.Type == "static" {
+		return nil
+	}
+
+	unit, err := deploy.ActiveUnit(ctx, sshClient, cfg)
+	if err != nil {
+		return err
+	}
+	// The unit may still be starting after boot
+	state := ""
+	for attempt := 0; attempt < 15; attempt++ {
+		output, err := sshClient.Run(ctx, fmt.Sprintf("systemctl is-active %s 2>/dev/null || true", unit))
+		if err != nil {
+			return err
+		}
+		if state = strings.TrimSpace(output); state == "active" {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+	if state != "active" {
+		return fmt.Errorf("%s is %s after the restart; check 'gotzer logs'", unit, state)
+	}
+	report.Info(r, "%s is active", unit)
+
+	hc := cfg.Deploy.HealthCheck
+	if hc == nil {
+		return nil
+	}
+	probe := *hc
+	if cfg.Deploy.IsBlueGreen() {
+		// Blue-green instances are probed on their own port
+		color, err := deploy.ActiveColor(ctx, sshClient, cfg)
+		if err != nil || color == "" {
+			return err
+		}
+		probe.Port = cfg.Deploy.ColorPort(color)
+	}
+	return deploy.CheckHealth(ctx, sshClient, &probe, r)
+}
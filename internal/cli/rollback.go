@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/deploy"
+	"github.com/DawnKosmos/gotzer/internal/report"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/spf13/cobra"
+)
+
+var rollbackList bool
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback [release-id]",
+	Short: "Roll back to a previous release",
+	Long: `Points the current release symlink at a previous release and restarts the service.
+
+Without an argument, the release deployed before the active one is used.
+Use --list to show all releases kept on the server.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runRollback,
+}
+
+func init() {
+	rollbackCmd.Flags().BoolVarP(&rollbackList, "list", "l", false, "List releases on the server")
+	rollbackCmd.Flags().StringVar(&serverFlag, "server", "", "Only roll back this server of a server group")
+}
+
+func runRollback(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	// Load configs
+	cfg, err := config.Load(cfgFile, envName)
+	if err != nil {
+		return err
+	}
+
+	globalCfg, err := loadGlobalConfig()
+	if err != nil {
+		return err
+	}
+
+	// Get server info
+	hc := newHetznerClient(globalCfg)
+	servers, err := targetServers(ctx, hc, cfg)
+	if err != nil {
+		return err
+	}
+
+	if rollbackList {
+		return listReleases(ctx, globalCfg, cfg, servers)
+	}
+
+	var releaseID string
+	if len(args) > 0 {
+		releaseID = args[0]
+	}
+
+	// Servers are rolled back one at a time so a failure leaves the rest untouched
+	var activated string
+	for _, server := range servers {
+		r := reporter
+		if len(servers) > 1 {
+			r = report.WithServer(reporter, server.Name)
+		}
+		ip := serverIP(server)
+
+		sshClient := newSSHClient(globalCfg, server)
+		if err := sshClient.Connect(ctx); err != nil {
+			return fmt.Errorf("SSH connection to %s failed: %w", server.Name, err)
+		}
+
+		report.Info(r, "Rolling back %s on %s (%s)...", cfg.Name, server.Name, ip)
+		activated, err = deploy.Rollback(ctx, sshClient, cfg, releaseID, r)
+		sshClient.Close()
+		if err != nil {
+			return err
+		}
+		report.Success(r, "", "Release %s is now active", activated)
+	}
+
+	if len(servers) == 1 {
+		reportResult(result{Status: "success", ServerIP: serverIP(servers[0]), ReleaseID: activated})
+	} else {
+		reportResult(result{Status: "success", ReleaseID: activated, Servers: serverNames(servers)})
+	}
+	return nil
+}
+
+// listReleases shows the releases kept on each server
+func listReleases(ctx context.Context, globalCfg *globalConfig, cfg *config.Config, servers []*hcloud.Server) error {
+	byServer := make(map[string][]deploy.Release, len(servers))
+	for _, server := range servers {
+		sshClient := newSSHClient(globalCfg, server)
+		if err := sshClient.Connect(ctx); err != nil {
+			return fmt.Errorf("SSH connection to %s failed: %w", server.Name, err)
+		}
+		releases, err := deploy.ListReleases(ctx, sshClient, cfg)
+		sshClient.Close()
+		if err != nil {
+			return err
+		}
+		byServer[server.Name] = releases
+	}
+
+	if jsonOutput() {
+		if len(servers) == 1 {
+			reportResult(byServer[servers[0].Name])
+		} else {
+			reportResult(byServer)
+		}
+		return nil
+	}
+
+	for _, server := range servers {
+		releases := byServer[server.Name]
+		suffix := ""
+		if len(servers) > 1 {
+			suffix = " on " + server.Name
+		}
+		if len(releases) == 0 {
+			printInfo("No releases found" + suffix)
+			continue
+		}
+		fmt.Println("\n📦 Releases" + suffix)
+		fmt.Println("────────────────────────────────────")
+		for _, r := range releases {
+			marker := " "
+			if r.Current {
+				marker = "*"
+			}
+			fmt.Printf("  %s %s\n", marker, r.ID)
+		}
+	}
+	return nil
+}
@@ -1,17 +1,25 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
+	"github.com/DawnKosmos/gotzer/internal/report"
 	"github.com/spf13/cobra"
 )
 
 var (
-	cfgFile string
-	verbose bool
+	cfgFile      string
+	envName      string
+	verbose      bool
+	outputFormat string
 )
 
+// reporter receives progress events from all commands. It is replaced in
+// PersistentPreRunE once --output and --verbose are known.
+var reporter report.Reporter = report.Terminal()
+
 var rootCmd = &cobra.Command{
 	Use:   "gotzer",
 	Short: "Deploy Go applications to Hetzner Cloud",
@@ -20,7 +28,7 @@ var rootCmd = &cobra.Command{
 It handles:
   - Server provisioning with Docker services (PostgreSQL, Typesense, etc.)
   - Go cross-compilation for ARM64 and AMD64
-  - Direct deployment via SSH (stop → upload → start)
+  - Direct deployment via SSH into release directories with instant rollback
 
 Quick start:
   gotzer init       # Create .gotzer.yaml config
@@ -28,21 +36,82 @@ Quick start:
   gotzer provision  # Create server with services
   gotzer deploy     # Build and deploy your app`,
 	SilenceUsage: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		switch outputFormat {
+		case "text":
+			reporter = report.NewHuman(os.Stdout, os.Stderr, verbose)
+		case "json":
+			reporter = report.NewJSON(os.Stdout)
+		default:
+			return fmt.Errorf("invalid --output %q, expected text or json", outputFormat)
+		}
+		return nil
+	},
 }
 
 func Execute() error {
-	return rootCmd.Execute()
+	err := rootCmd.Execute()
+
+	// Commands returning an exitError have already reported their result
+	var ee *exitError
+	if err != nil && jsonOutput() && !errors.As(err, &ee) {
+		reportResult(result{Status: "error", Error: err.Error()})
+	}
+	return err
+}
+
+// jsonOutput reports whether events are written as newline-delimited JSON
+func jsonOutput() bool {
+	return outputFormat == "json"
+}
+
+// result is the final object of a command run with --output json
+type result struct {
+	Status    string   `json:"status"`
+	ServerIP  string   `json:"server_ip,omitempty"`
+	ReleaseID string   `json:"release_id,omitempty"`
+	Servers   []string `json:"servers,omitempty"` // servers reached when deploying to a group
+	Error     string   `json:"error,omitempty"`
+
+	LoadBalancerIP string `json:"load_balancer_ip,omitempty"`
+}
+
+// reportResult emits the final result of a command
+func reportResult(data any) {
+	report.Result(reporter, data)
+}
+
+// exitError is an error that maps to a specific process exit status
+type exitError struct {
+	code int
+	msg  string
+}
+
+func (e *exitError) Error() string {
+	return e.msg
+}
+
+// ExitCode returns the process exit status for an error returned by Execute
+func ExitCode(err error) int {
+	var ee *exitError
+	if errors.As(err, &ee) {
+		return ee.code
+	}
+	return 1
 }
 
 func init() {
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is .gotzer.yaml)")
+	rootCmd.PersistentFlags().StringVarP(&envName, "env", "e", "", "environment from the environments section (e.g. staging, production)")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "text", "output format: text or json (newline-delimited events)")
 
 	// Add subcommands
 	rootCmd.AddCommand(initCmd)
 	rootCmd.AddCommand(authCmd)
 	rootCmd.AddCommand(provisionCmd)
 	rootCmd.AddCommand(deployCmd)
+	rootCmd.AddCommand(rollbackCmd)
 	rootCmd.AddCommand(sshCmd)
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(logsCmd)
@@ -51,16 +120,25 @@ func init() {
 	rootCmd.AddCommand(restartCmd)
 	rootCmd.AddCommand(localCmd)
 	rootCmd.AddCommand(destroyCmd)
+	rootCmd.AddCommand(secretsCmd)
+	rootCmd.AddCommand(planCmd)
+	rootCmd.AddCommand(firewallCmd)
+	rootCmd.AddCommand(snapshotCmd)
+	rootCmd.AddCommand(rescaleCmd)
+	rootCmd.AddCommand(costCmd)
+	rootCmd.AddCommand(lsCmd)
+	rootCmd.AddCommand(ipCmd)
+	rootCmd.AddCommand(dnsCmd)
 }
 
 func printSuccess(msg string) {
-	fmt.Fprintf(os.Stdout, "✓ %s\n", msg)
+	report.Success(reporter, "", "%s", msg)
 }
 
 func printInfo(msg string) {
-	fmt.Fprintf(os.Stdout, "→ %s\n", msg)
+	report.Info(reporter, "%s", msg)
 }
 
 func printError(msg string) {
-	fmt.Fprintf(os.Stderr, "✗ %s\n", msg)
+	report.Error(reporter, "%s", msg)
 }
@@ -0,0 +1,254 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/secrets"
+	"github.com/spf13/cobra"
+)
+
+var secretsService string
+
+var secretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Manage encrypted secrets",
+	Long: `Manages secrets.enc.yaml, an age-encrypted file next to .gotzer.yaml.
+
+Secrets under "deploy" are merged into deploy.env; secrets under
+"services.<name>" are added to that Docker service's environment. On the
+server they are written to root-only environment files, never to unit files.
+
+The file is encrypted for your key (~/.gotzer/age.key, created on first use)
+and every age public key listed in secrets.recipients.`,
+}
+
+var secretsEditCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Edit secrets in $EDITOR",
+	Args:  cobra.NoArgs,
+	RunE:  runSecretsEdit,
+}
+
+var secretsSetCmd = &cobra.Command{
+	Use:   "set KEY=VALUE...",
+	Short: "Set one or more secrets",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runSecretsSet,
+}
+
+var secretsGetCmd = &cobra.Command{
+	Use:   "get KEY",
+	Short: "Print a secret",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runSecretsGet,
+}
+
+var secretsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List secret names",
+	Args:  cobra.NoArgs,
+	RunE:  runSecretsList,
+}
+
+func init() {
+	for _, c := range []*cobra.Command{secretsSetCmd, secretsGetCmd, secretsListCmd} {
+		c.Flags().StringVar(&secretsService, "service", "", "Docker service the secret belongs to (default: the app)")
+	}
+
+	secretsCmd.AddCommand(secretsEditCmd)
+	secretsCmd.AddCommand(secretsSetCmd)
+	secretsCmd.AddCommand(secretsGetCmd)
+	secretsCmd.AddCommand(secretsListCmd)
+}
+
+// loadSecrets decrypts the project's secrets, or returns nil if there is no secrets file
+func loadSecrets(cfg *config.Config) (*secrets.Secrets, error) {
+	path := cfg.SecretsPath()
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	identity, err := secrets.LoadIdentity()
+	if err != nil {
+		return nil, err
+	}
+	return secrets.Load(path, identity)
+}
+
+func runSecretsEdit(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load(cfgFile, envName)
+	if err != nil {
+		return err
+	}
+
+	identity, created, err := secrets.LoadOrCreateIdentity()
+	if err != nil {
+		return err
+	}
+	if created {
+		printInfo(fmt.Sprintf("Created age key with public key %s", identity.Recipient()))
+	}
+
+	path := cfg.SecretsPath()
+	plain := []byte("deploy: {}\nservices: {}\n")
+	if data, err := os.ReadFile(path); err == nil {
+		if plain, err = secrets.Decrypt(data, identity); err != nil {
+			return err
+		}
+	}
+
+	tmp, err := os.CreateTemp("", "gotzer-secrets-*.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(plain); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	tmp.Close()
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	c := exec.Command("sh", "-c", fmt.Sprintf("%s %q", editor, tmp.Name()))
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("editor failed: %w", err)
+	}
+
+	edited, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return fmt.Errorf("failed to read temp file: %w", err)
+	}
+
+	recipients, err := secrets.Recipients(cfg.Secrets.Recipients, identity)
+	if err != nil {
+		return err
+	}
+	if err := secrets.SaveRaw(path, edited, recipients); err != nil {
+		return err
+	}
+
+	printSuccess(fmt.Sprintf("Saved %s", path))
+	return nil
+}
+
+func runSecretsSet(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load(cfgFile, envName)
+	if err != nil {
+		return err
+	}
+
+	identity, created, err := secrets.LoadOrCreateIdentity()
+	if err != nil {
+		return err
+	}
+	if created {
+		printInfo(fmt.Sprintf("Created age key with public key %s", identity.Recipient()))
+	}
+
+	path := cfg.SecretsPath()
+	s, err := secrets.Load(path, identity)
+	if err != nil {
+		return err
+	}
+
+	scope := s.Scope(secretsService)
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("invalid secret %q, expected KEY=VALUE", arg)
+		}
+		scope[key] = value
+	}
+
+	recipients, err := secrets.Recipients(cfg.Secrets.Recipients, identity)
+	if err != nil {
+		return err
+	}
+	if err := secrets.Save(path, s, recipients); err != nil {
+		return err
+	}
+
+	printSuccess(fmt.Sprintf("Updated %d secret(s) in %s", len(args), path))
+	return nil
+}
+
+func runSecretsGet(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load(cfgFile, envName)
+	if err != nil {
+		return err
+	}
+
+	s, err := loadSecrets(cfg)
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		return fmt.Errorf("no secrets file at %s", cfg.SecretsPath())
+	}
+
+	value, ok := s.Scope(secretsService)[args[0]]
+	if !ok {
+		return fmt.Errorf("secret %s not found", args[0])
+	}
+
+	fmt.Println(value)
+	return nil
+}
+
+func runSecretsList(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load(cfgFile, envName)
+	if err != nil {
+		return err
+	}
+
+	s, err := loadSecrets(cfg)
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		printInfo(fmt.Sprintf("No secrets file at %s", cfg.SecretsPath()))
+		return nil
+	}
+
+	scopes := map[string]map[string]string{"deploy": s.Deploy}
+	for name, vars := range s.Services {
+		scopes[name] = vars
+	}
+	if secretsService != "" {
+		scopes = map[string]map[string]string{secretsService: s.Scope(secretsService)}
+	}
+
+	names := make([]string, 0, len(scopes))
+	for name := range scopes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		keys := make([]string, 0, len(scopes[name]))
+		for k := range scopes[name] {
+			keys = append(keys, k)
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		sort.Strings(keys)
+
+		fmt.Printf("%s:\n", name)
+		for _, k := range keys {
+			fmt.Printf("  %s\n", k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/hetzner"
+	"github.com/DawnKosmos/gotzer/internal/report"
+	"github.com/DawnKosmos/gotzer/internal/ssh"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// serverFlag narrows commands to one member of a server group
+var serverFlag string
+
+// findServers looks up the app servers. Names of configured servers that do
+// not exist yet are returned in missing.
+func findServers(ctx context.Context, hc *hetzner.Client, cfg *config.Config) ([]*hcloud.Server, []string, error) {
+	servers, missing, err := lookupServers(ctx, hc, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.Server.FloatingIP != "" {
+		if err := useFloatingIP(ctx, hc, cfg, servers); err != nil {
+			return nil, nil, err
+		}
+	}
+	return servers, missing, nil
+}
+
+// lookupServers finds the servers by name, label selector or, after
+// server.name changed, by the app's labels
+func lookupServers(ctx context.Context, hc *hetzner.Client, cfg *config.Config) (servers []*hcloud.Server, missing []string, err error) {
+	if cfg.Server.Selector != "" {
+		servers, err := hc.ListServersBySelector(ctx, cfg.Server.Selector)
+		return servers, nil, err
+	}
+
+	names := cfg.Server.ServerNames()
+	for _, name := range names {
+		server, err := hc.GetServer(ctx, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if server == nil {
+			missing = append(missing, name)
+			continue
+		}
+		servers = append(servers, server)
+	}
+	if len(missing) == 0 {
+		return servers, nil, nil
+	}
+
+	// A server keeps its labels when server.name changes, so it is found by
+	// them and stands in for a configured name that has no server
+	labelled, err := hc.ListServersBySelector(ctx, cfg.LabelSelector())
+	if err != nil {
+		return nil, nil, err
+	}
+	var renamed []*hcloud.Server
+	for _, server := range labelled {
+		if !slices.Contains(names, server.Name) {
+			renamed = append(renamed, server)
+		}
+	}
+	for len(missing) > 0 && len(renamed) > 0 {
+		report.Warn(reporter, "Server %s has the labels of this app but is not named in %s; using it as %s. 'gotzer provision --update' renames it",
+			renamed[0].Name, cfgFileName(), missing[0])
+		servers = append(servers, renamed[0])
+		missing, renamed = missing[1:], renamed[1:]
+	}
+	return servers, missing, nil
+}
+
+// renames maps the servers that were found by their labels to the configured
+// names they stand for, pairing them up the same way as findServers
+func renames(cfg *config.Config, servers []*hcloud.Server) map[*hcloud.Server]string {
+	names := cfg.Server.ServerNames()
+	var unused []string
+	for _, name := range names {
+		if !slices.ContainsFunc(servers, func(s *hcloud.Server) bool { return s.Name == name }) {
+			unused = append(unused, name)
+		}
+	}
+	out := make(map[*hcloud.Server]string)
+	for _, server := range servers {
+		if len(unused) > 0 && !slices.Contains(names, server.Name) {
+			out[server] = unused[0]
+			unused = unused[1:]
+		}
+	}
+	return out
+}
+
+// targetServers returns the existing app servers, or only the one chosen with
+// --server, after checking that they belong to this app and environment
+func targetServers(ctx context.Context, hc *hetzner.Client, cfg *config.Config) ([]*hcloud.Server, error) {
+	servers, missing, err := findServers(ctx, hc, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if serverFlag != "" {
+		var selected []*hcloud.Server
+		for _, server := range servers {
+			if server.Name == serverFlag {
+				selected = append(selected, server)
+			}
+		}
+		if len(selected) == 0 {
+			return nil, fmt.Errorf("server %s is not one of the app's servers (%s)", serverFlag, strings.Join(serverNames(servers), ", "))
+		}
+		servers = selected
+	} else if len(missing) > 0 {
+		return nil, fmt.Errorf("server %s not found. Run 'gotzer provision' first", strings.Join(missing, ", "))
+	}
+
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no servers match selector %q", cfg.Server.Selector)
+	}
+	for _, server := range servers {
+		if err := checkEnvironment(cfg, server); err != nil {
+			return nil, err
+		}
+	}
+	return servers, nil
+}
+
+// serverNames returns the names of the servers
+func serverNames(servers []*hcloud.Server) []string {
+	names := make([]string, len(servers))
+	for i, server := range servers {
+		names[i] = server.Name
+	}
+	return names
+}
+
+// useFloatingIP records server.floating_ip on the server it is assigned to,
+// so that serverIP returns it
+func useFloatingIP(ctx context.Context, hc *hetzner.Client, cfg *config.Config, servers []*hcloud.Server) error {
+	ip, err := hc.GetFloatingIP(ctx, cfg.Server.FloatingIP)
+	if err != nil || ip == nil || ip.Server == nil {
+		return err
+	}
+	for _, server := range servers {
+		if server.ID == ip.Server.ID {
+			server.PublicNet.FloatingIPs = []*hcloud.FloatingIP{ip}
+		}
+	}
+	return nil
+}
+
+// serverIP returns the address commands reach the server on: server.floating_ip
+// if it is assigned to the server, otherwise the server's public IP
+func serverIP(server *hcloud.Server) string {
+	for _, ip := range server.PublicNet.FloatingIPs {
+		if ip.IP != nil {
+			return ip.IP.String()
+		}
+	}
+	return publicIP(server)
+}
+
+// publicIP returns the server's public IPv4 address, or its IPv6 address if it
+// is IPv6-only
+func publicIP(server *hcloud.Server) string {
+	if !server.PublicNet.IPv4.IsUnspecified() {
+		return server.PublicNet.IPv4.IP.String()
+	}
+	if ip := hetzner.ServerIPv6(server); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// newSSHClient creates a root SSH client for the server whose host key is
+// verified against gotzer's known_hosts, keyed by server ID
+func newSSHClient(globalCfg *globalConfig, server *hcloud.Server) *ssh.Client {
+	sshKeyPath := config.ExpandPath(globalCfg.DefaultSSHKey)
+	sshClient := ssh.NewClient(serverIP(server), "root", sshKeyPath)
+	knownHosts := ssh.DefaultKnownHosts()
+	knownHosts.Notify = func(msg string) { report.Info(reporter, "%s", msg) }
+	sshClient.SetHostKeyCallback(knownHosts.HostKeyCallback(server.ID))
+	return sshClient
+}
+
+// checkEnvironment refuses to work on a server whose labels belong to another
+// app or environment, e.g. deploying a staging build to production. Servers
+// without labels predate them and are accepted.
+func checkEnvironment(cfg *config.Config, server *hcloud.Server) error {
+	if app, ok := server.Labels["gotzer/app"]; ok && app != cfg.Name {
+		return fmt.Errorf("server %s belongs to app %q, not %q", server.Name, app, cfg.Name)
+	}
+	env, ok := server.Labels["gotzer/env"]
+	if !ok || env == cfg.Env {
+		return nil
+	}
+	if cfg.Env == "" {
+		return fmt.Errorf("server %s belongs to environment %q; select it with --env %s", server.Name, env, env)
+	}
+	return fmt.Errorf("server %s belongs to environment %q, not %q", server.Name, env, cfg.Env)
+}
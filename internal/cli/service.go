@@ -6,8 +6,8 @@ import (
 	"strings"
 
 	"github.com/DawnKosmos/gotzer/internal/config"
-	"github.com/DawnKosmos/gotzer/internal/hetzner"
-	"github.com/DawnKosmos/gotzer/internal/ssh"
+	"github.com/DawnKosmos/gotzer/internal/deploy"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"github.com/spf13/cobra"
 )
 
@@ -35,8 +35,14 @@ var restartCmd = &cobra.Command{
 	},
 }
 
+func init() {
+	for _, c := range []*cobra.Command{stopCmd, startCmd, restartCmd} {
+		c.Flags().StringVar(&serverFlag, "server", "", "Only act on this server of a server group")
+	}
+}
+
 func runServiceCmd(ctx context.Context, action string) error {
-	cfg, err := config.Load(cfgFile)
+	cfg, err := config.Load(cfgFile, envName)
 	if err != nil {
 		return err
 	}
@@ -46,29 +52,39 @@ func runServiceCmd(ctx context.Context, action string) error {
 		return err
 	}
 
-	hc := hetzner.NewClient(globalCfg.Token)
-	server, err := hc.GetServer(ctx, cfg.Server.Name)
+	hc := newHetznerClient(globalCfg)
+	servers, err := targetServers(ctx, hc, cfg)
 	if err != nil {
 		return err
 	}
-	if server == nil {
-		return fmt.Errorf("server %s not found", cfg.Server.Name)
+
+	for _, server := range servers {
+		if err := serviceAction(ctx, globalCfg, cfg, server, action); err != nil {
+			return err
+		}
 	}
 
-	serverIP := server.PublicNet.IPv4.IP.String()
-	sshKeyPath := config.ExpandPath(globalCfg.DefaultSSHKey)
-	sshClient := ssh.NewClient(serverIP, "root", sshKeyPath)
+	printSuccess(fmt.Sprintf("Service %s complete", action))
+	return nil
+}
+
+// serviceAction runs systemctl <action> for the active unit on one server
+func serviceAction(ctx context.Context, globalCfg *globalConfig, cfg *config.Config, server *hcloud.Server, action string) error {
+	sshClient := newSSHClient(globalCfg, server)
 	if err := sshClient.Connect(ctx); err != nil {
 		return err
 	}
 	defer sshClient.Close()
 
-	printInfo(fmt.Sprintf("%s service %s...", strings.Title(action), cfg.Deploy.ServiceName))
-	_, err = sshClient.Run(ctx, fmt.Sprintf("sudo systemctl %s %s", action, cfg.Deploy.ServiceName))
+	unit, err := deploy.ActiveUnit(ctx, sshClient, cfg)
 	if err != nil {
-		return fmt.Errorf("failed to %s service: %w", action, err)
+		return err
 	}
 
-	printSuccess(fmt.Sprintf("Service %s complete", action))
+	printInfo(fmt.Sprintf("%s service %s on %s...", strings.Title(action), unit, server.Name))
+	_, err = sshClient.Run(ctx, fmt.Sprintf("sudo systemctl %s %s", action, unit))
+	if err != nil {
+		return fmt.Errorf("failed to %s service on %s: %w", action, server.Name, err)
+	}
 	return nil
 }
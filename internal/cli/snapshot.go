@@ -0,0 +1,240 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strconv"
+	"time"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/hetzner"
+	"github.com/DawnKosmos/gotzer/internal/report"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/spf13/cobra"
+)
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Manage snapshots of the servers",
+	Long: `Creates, lists and deletes Hetzner snapshots of the app servers' disks.
+
+A snapshot can be used to create a new server, e.g. to clone production into
+staging:
+
+  gotzer snapshot create
+  gotzer --env staging provision --from-snapshot <id>
+
+Hetzner Volumes (server.volumes) are not part of snapshots.`,
+}
+
+var snapshotCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Snapshot the servers",
+	Args:  cobra.NoArgs,
+	RunE:  runSnapshotCreate,
+}
+
+var snapshotListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the app's snapshots",
+	Args:  cobra.NoArgs,
+	RunE:  runSnapshotList,
+}
+
+var snapshotDeleteCmd = &cobra.Command{
+	Use:   "delete <id>...",
+	Short: "Delete snapshots",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runSnapshotDelete,
+}
+
+var snapshotDescription string
+var snapshotListAll bool
+
+func init() {
+	snapshotCmd.AddCommand(snapshotCreateCmd)
+	snapshotCmd.AddCommand(snapshotListCmd)
+	snapshotCmd.AddCommand(snapshotDeleteCmd)
+
+	snapshotCreateCmd.Flags().StringVarP(&snapshotDescription, "description", "d", "", "Snapshot description (default: <server> <date>)")
+	snapshotCreateCmd.Flags().StringVar(&serverFlag, "server", "", "Only snapshot this server of a server group")
+	snapshotListCmd.Flags().BoolVar(&snapshotListAll, "all", false, "List the snapshots of every environment")
+}
+
+// snapshotInfo is a snapshot as listed by `gotzer snapshot list`
+type snapshotInfo struct {
+	ID          int64     `json:"id"`
+	Description string    `json:"description"`
+	Server      string    `json:"server"`
+	Env         string    `json:"environment,omitempty"`
+	SizeGB      float32   `json:"size_gb"`
+	Created     time.Time `json:"created"`
+}
+
+func runSnapshotCreate(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	cfg, hc, err := loadSnapshotConfig()
+	if err != nil {
+		return err
+	}
+	servers, err := targetServers(ctx, hc, cfg)
+	if err != nil {
+		return err
+	}
+
+	var snapshots []snapshotInfo
+	for _, server := range servers {
+		if err := checkEnvironment(cfg, server); err != nil {
+			return err
+		}
+		image, err := createSnapshot(ctx, hc, cfg, server, snapshotDescription)
+		if err != nil {
+			return err
+		}
+		snapshots = append(snapshots, newSnapshotInfo(image))
+	}
+
+	reportResult(struct {
+		Status    string         `json:"status"`
+		Snapshots []snapshotInfo `json:"snapshots"`
+	}{"success", snapshots})
+	return nil
+}
+
+func runSnapshotList(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	cfg, hc, err := loadSnapshotConfig()
+	if err != nil {
+		return err
+	}
+	selector := cfg.LabelSelector()
+	if snapshotListAll {
+		selector = "gotzer/app=" + cfg.Name
+	}
+	images, err := hc.ListSnapshots(ctx, selector)
+	if err != nil {
+		return err
+	}
+
+	snapshots := make([]snapshotInfo, len(images))
+	for i, image := range images {
+		snapshots[i] = newSnapshotInfo(image)
+	}
+	if jsonOutput() {
+		reportResult(snapshots)
+		return nil
+	}
+
+	if len(snapshots) == 0 {
+		printInfo("No snapshots found. Create one with 'gotzer snapshot create'")
+		return nil
+	}
+	fmt.Println("\n📸 Snapshots")
+	fmt.Println("────────────────────────────────────")
+	for _, s := range snapshots {
+		server := s.Server
+		if s.Env != "" && snapshotListAll {
+			server += " (" + s.Env + ")"
+		}
+		fmt.Printf("  %-10d %s  %-24s %5.1f GB  %s\n", s.ID, s.Created.Local().Format("2006-01-02 15:04"), server, s.SizeGB, s.Description)
+	}
+	fmt.Println()
+	return nil
+}
+
+func runSnapshotDelete(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	cfg, hc, err := loadSnapshotConfig()
+	if err != nil {
+		return err
+	}
+
+	// Look all of them up first so a typo deletes nothing
+	var images []*hcloud.Image
+	for _, arg := range args {
+		image, err := getAppSnapshot(ctx, hc, cfg, arg)
+		if err != nil {
+			return err
+		}
+		images = append(images, image)
+	}
+	for _, image := range images {
+		if err := hc.DeleteSnapshot(ctx, image); err != nil {
+			return err
+		}
+		printSuccess(fmt.Sprintf("Deleted snapshot %d (%s)", image.ID, image.Description))
+	}
+	reportResult(result{Status: "success"})
+	return nil
+}
+
+// loadSnapshotConfig loads the configs and creates the Hetzner client
+func loadSnapshotConfig() (*config.Config, *hetzner.Client, error) {
+	cfg, err := config.Load(cfgFile, envName)
+	if err != nil {
+		return nil, nil, err
+	}
+	globalCfg, err := loadGlobalConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, newHetznerClient(globalCfg), nil
+}
+
+// createSnapshot snapshots a server, labelling the snapshot with the app,
+// environment and server name
+func createSnapshot(ctx context.Context, hc *hetzner.Client, cfg *config.Config, server *hcloud.Server, description string) (*hcloud.Image, error) {
+	if description == "" {
+		description = fmt.Sprintf("%s %s", server.Name, time.Now().Format("2006-01-02 15:04"))
+	}
+	labels := maps.Clone(cfg.Labels())
+	labels["gotzer/server"] = server.Name
+
+	step := report.Start(reporter, "snapshot", "📸", fmt.Sprintf("Creating snapshot of %s...", server.Name))
+	image, err := hc.CreateSnapshot(ctx, server, description, labels)
+	if err != nil {
+		return nil, step.Fail(err)
+	}
+	report.Info(reporter, "Snapshot %d: %s", image.ID, description)
+	step.Done()
+	return image, nil
+}
+
+// getAppSnapshot looks up a snapshot by its ID and checks it belongs to the app
+func getAppSnapshot(ctx context.Context, hc *hetzner.Client, cfg *config.Config, arg string) (*hcloud.Image, error) {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot ID %q", arg)
+	}
+	image, err := hc.GetSnapshot(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if image == nil {
+		return nil, fmt.Errorf("snapshot %d not found", id)
+	}
+	if app := image.Labels["gotzer/app"]; app != cfg.Name {
+		return nil, fmt.Errorf("snapshot %d does not belong to app %q", id, cfg.Name)
+	}
+	return image, nil
+}
+
+// newSnapshotInfo describes a snapshot image
+func newSnapshotInfo(image *hcloud.Image) snapshotInfo {
+	info := snapshotInfo{
+		ID:          image.ID,
+		Description: image.Description,
+		Server:      image.Labels["gotzer/server"],
+		Env:         image.Labels["gotzer/env"],
+		SizeGB:      image.ImageSize,
+		Created:     image.Created,
+	}
+	if info.Server == "" && image.CreatedFrom != nil {
+		info.Server = image.CreatedFrom.Name
+	}
+	return info
+}
@@ -3,9 +3,9 @@ package cli
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/DawnKosmos/gotzer/internal/config"
-	"github.com/DawnKosmos/gotzer/internal/hetzner"
 	"github.com/DawnKosmos/gotzer/internal/ssh"
 	"github.com/spf13/cobra"
 )
@@ -17,11 +17,28 @@ var sshCmd = &cobra.Command{
 	RunE:  runSSH,
 }
 
+var sshTrustReset bool
+
+var sshTrustCmd = &cobra.Command{
+	Use:   "trust",
+	Short: "Record the server's SSH host key",
+	Long: `Connects to the server and records its host key in ~/.gotzer/known_hosts.
+
+Use --reset after a legitimate rebuild to forget the previously recorded key first.`,
+	RunE: runSSHTrust,
+}
+
+func init() {
+	sshTrustCmd.Flags().BoolVar(&sshTrustReset, "reset", false, "Forget the recorded host key before connecting")
+	sshCmd.PersistentFlags().StringVar(&serverFlag, "server", "", "Server of a server group to connect to")
+	sshCmd.AddCommand(sshTrustCmd)
+}
+
 func runSSH(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
 
 	// Load configs
-	cfg, err := config.Load(cfgFile)
+	cfg, err := config.Load(cfgFile, envName)
 	if err != nil {
 		return err
 	}
@@ -32,21 +49,21 @@ func runSSH(cmd *cobra.Command, args []string) error {
 	}
 
 	// Get server info
-	hc := hetzner.NewClient(globalCfg.Token)
-	server, err := hc.GetServer(ctx, cfg.Server.Name)
+	hc := newHetznerClient(globalCfg)
+	servers, err := targetServers(ctx, hc, cfg)
 	if err != nil {
 		return err
 	}
-	if server == nil {
-		return fmt.Errorf("server %s not found", cfg.Server.Name)
+	if len(servers) > 1 {
+		return fmt.Errorf("the app has %d servers; choose one with --server (%s)", len(servers), strings.Join(serverNames(servers), ", "))
 	}
+	server := servers[0]
 
-	serverIP := server.PublicNet.IPv4.IP.String()
-	printInfo(fmt.Sprintf("Connecting to %s (%s)...", cfg.Server.Name, serverIP))
+	ip := serverIP(server)
+	printInfo(fmt.Sprintf("Connecting to %s (%s)...", server.Name, ip))
 
 	// Connect via SSH
-	sshKeyPath := config.ExpandPath(globalCfg.DefaultSSHKey)
-	sshClient := ssh.NewClient(serverIP, "root", sshKeyPath)
+	sshClient := newSSHClient(globalCfg, server)
 	if err := sshClient.Connect(ctx); err != nil {
 		return fmt.Errorf("SSH connection failed: %w", err)
 	}
@@ -54,3 +71,48 @@ func runSSH(cmd *cobra.Command, args []string) error {
 
 	return sshClient.Shell()
 }
+
+func runSSHTrust(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	// Load configs
+	cfg, err := config.Load(cfgFile, envName)
+	if err != nil {
+		return err
+	}
+
+	globalCfg, err := loadGlobalConfig()
+	if err != nil {
+		return err
+	}
+
+	// Get server info
+	hc := newHetznerClient(globalCfg)
+	servers, err := targetServers(ctx, hc, cfg)
+	if err != nil {
+		return err
+	}
+
+	knownHosts := ssh.DefaultKnownHosts()
+	for _, server := range servers {
+		ip := serverIP(server)
+
+		if sshTrustReset {
+			removed, err := knownHosts.Remove(server.ID, ip)
+			if err != nil {
+				return err
+			}
+			printInfo(fmt.Sprintf("Removed %d host key(s) for %s (%s)", removed, server.Name, ip))
+		}
+
+		// Connecting records the key if none is known and fails on mismatch
+		sshClient := newSSHClient(globalCfg, server)
+		if err := sshClient.Connect(ctx); err != nil {
+			return fmt.Errorf("SSH connection to %s failed: %w", server.Name, err)
+		}
+		sshClient.Close()
+
+		printSuccess(fmt.Sprintf("Host key for %s (%s) is trusted", server.Name, ip))
+	}
+	return nil
+}
@@ -3,25 +3,58 @@ package cli
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/deploy"
 	"github.com/DawnKosmos/gotzer/internal/hetzner"
-	"github.com/DawnKosmos/gotzer/internal/ssh"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"github.com/spf13/cobra"
 )
 
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Show server and application status",
-	Long:  `Displays the current status of your Hetzner server and running services.`,
+	Long:  `Displays the current status of your Hetzner servers and running services.`,
 	RunE:  runStatus,
 }
 
+func init() {
+	statusCmd.Flags().StringVar(&serverFlag, "server", "", "Only show this server of a server group")
+}
+
+// serverStatus is the information shown by `gotzer status`
+type serverStatus struct {
+	Name       string     `json:"name"`
+	Env        string     `json:"environment,omitempty"`
+	Status     string     `json:"status"`
+	IP         string     `json:"ip"`
+	IPv6       string     `json:"ipv6,omitempty"`
+	FloatingIP string     `json:"floating_ip,omitempty"`
+	PrivateIP  string     `json:"private_ip,omitempty"`
+	Type       string     `json:"type"`
+	Location   string     `json:"location"`
+	Datacenter string     `json:"datacenter"`
+	Placement  string     `json:"placement_group,omitempty"`
+	Image      string     `json:"image"`
+	App        *appStatus `json:"app,omitempty"`
+	Docker     []string   `json:"docker,omitempty"`
+	Disk       string     `json:"disk_usage,omitempty"`
+	Memory     string     `json:"memory_usage,omitempty"`
+}
+
+// appStatus is the state of the application's systemd unit
+type appStatus struct {
+	Unit    string `json:"unit"`
+	State   string `json:"state"`
+	Release string `json:"release,omitempty"`
+}
+
 func runStatus(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
 
 	// Load configs
-	cfg, err := config.Load(cfgFile)
+	cfg, err := config.Load(cfgFile, envName)
 	if err != nil {
 		return err
 	}
@@ -32,66 +65,164 @@ func runStatus(cmd *cobra.Command, args []string) error {
 	}
 
 	// Get server info
-	hc := hetzner.NewClient(globalCfg.Token)
-	server, err := hc.GetServer(ctx, cfg.Server.Name)
+	hc := newHetznerClient(globalCfg)
+	var servers []*hcloud.Server
+	var missing []string
+	if serverFlag != "" {
+		servers, err = targetServers(ctx, hc, cfg)
+	} else {
+		servers, missing, err = findServers(ctx, hc, cfg)
+	}
 	if err != nil {
 		return err
 	}
-	if server == nil {
-		fmt.Println("❌ Server not found")
-		fmt.Printf("   Run 'gotzer provision' to create %s\n", cfg.Server.Name)
-		return nil
+
+	var statuses []serverStatus
+	for _, name := range missing {
+		statuses = append(statuses, serverStatus{Name: name, Env: cfg.Env, Status: "not_found"})
+	}
+	for _, server := range servers {
+		statuses = append(statuses, collectStatus(ctx, globalCfg, cfg, server))
 	}
 
-	serverIP := server.PublicNet.IPv4.IP.String()
+	if jsonOutput() {
+		reportResult(statuses)
+		return nil
+	}
+	if len(statuses) == 0 {
+		fmt.Printf("❌ No servers match selector %q\n", cfg.Server.Selector)
+		return nil
+	}
+	for _, status := range statuses {
+		printStatus(status)
+	}
+	return nil
+}
 
-	fmt.Println("\n📊 Server Status")
-	fmt.Println("────────────────────────────────────")
-	fmt.Printf("  Name:           %s\n", server.Name)
-	fmt.Printf("  Status:         %s\n", server.Status)
-	fmt.Printf("  IP:             %s\n", serverIP)
-	fmt.Printf("  Type:           %s\n", server.ServerType.Name)
-	fmt.Printf("  Location:       %s\n", server.Datacenter.Location.Name)
-	fmt.Printf("  Image:          %s\n", server.Image.Name)
+// collectStatus gathers the server's attributes and, if it is reachable, the
+// state of the app and its services
+func collectStatus(ctx context.Context, globalCfg *globalConfig, cfg *config.Config, server *hcloud.Server) serverStatus {
+	status := serverStatus{
+		Name:       server.Name,
+		Env:        cfg.Env,
+		Status:     string(server.Status),
+		IP:         publicIP(server),
+		Type:       server.ServerType.Name,
+		Location:   server.Datacenter.Location.Name,
+		Datacenter: server.Datacenter.Name,
+		Image:      server.Image.Name,
+	}
+	if ip := hetzner.ServerIPv6(server); ip != nil && ip.String() != status.IP {
+		status.IPv6 = ip.String()
+	}
+	if ip := serverIP(server); ip != status.IP {
+		status.FloatingIP = ip
+	}
+	if server.PlacementGroup != nil {
+		status.Placement = server.PlacementGroup.Name
+	}
+	if len(server.PrivateNet) > 0 {
+		status.PrivateIP = server.PrivateNet[0].IP.String()
+	}
 
 	// Try to get service status via SSH
-	sshKeyPath := config.ExpandPath(globalCfg.DefaultSSHKey)
-	sshClient := ssh.NewClient(serverIP, "root", sshKeyPath)
+	sshClient := newSSHClient(globalCfg, server)
 	if err := sshClient.Connect(ctx); err == nil {
 		defer sshClient.Close()
 
-		fmt.Println("\n📦 Application Status")
-		fmt.Println("────────────────────────────────────")
-
 		// Service status
-		output, err := sshClient.Run(ctx, fmt.Sprintf("systemctl is-active %s 2>/dev/null || echo 'inactive'", cfg.Deploy.ServiceName))
+		unit, err := deploy.ActiveUnit(ctx, sshClient, cfg)
+		if err != nil {
+			unit = cfg.Deploy.ServiceName
+		}
+		output, err := sshClient.Run(ctx, fmt.Sprintf("systemctl is-active %s 2>/dev/null || echo 'inactive'", unit))
 		if err == nil {
-			fmt.Printf("  %s:  %s", cfg.Deploy.ServiceName, output)
+			status.App = &appStatus{Unit: unit, State: strings.TrimSpace(output)}
+
+			// Active release
+			if release, err := deploy.CurrentRelease(ctx, sshClient, cfg); err == nil {
+				status.App.Release = release
+			}
 		}
 
 		// Docker services
 		output, err = sshClient.Run(ctx, "docker ps --format '{{.Names}}: {{.Status}}' 2>/dev/null || echo 'Docker not running'")
 		if err == nil && output != "" {
-			fmt.Println("\n🐳 Docker Services")
-			fmt.Println("────────────────────────────────────")
-			fmt.Printf("  %s", output)
+			status.Docker = strings.Split(strings.TrimSpace(output), "\n")
 		}
 
 		// Disk usage
 		output, err = sshClient.Run(ctx, "df -h / | tail -1 | awk '{print $5}'")
 		if err == nil {
-			fmt.Println("\n💾 Resources")
-			fmt.Println("────────────────────────────────────")
-			fmt.Printf("  Disk Usage:     %s", output)
+			status.Disk = strings.TrimSpace(output)
 		}
 
 		// Memory
 		output, err = sshClient.Run(ctx, "free -h | grep Mem | awk '{print $3 \"/\" $2}'")
 		if err == nil {
-			fmt.Printf("  Memory Usage:   %s", output)
+			status.Memory = strings.TrimSpace(output)
 		}
 	}
 
+	return status
+}
+
+// printStatus prints the status as text
+func printStatus(status serverStatus) {
+	if status.Status == "not_found" {
+		fmt.Printf("❌ Server %s not found\n", status.Name)
+		fmt.Printf("   Run 'gotzer provision' to create %s\n", status.Name)
+		return
+	}
+
+	fmt.Println("\n📊 Server Status")
+	fmt.Println("────────────────────────────────────")
+	fmt.Printf("  Name:           %s\n", status.Name)
+	if status.Env != "" {
+		fmt.Printf("  Environment:    %s\n", status.Env)
+	}
+	fmt.Printf("  Status:         %s\n", status.Status)
+	fmt.Printf("  IP:             %s\n", status.IP)
+	if status.IPv6 != "" {
+		fmt.Printf("  IPv6:           %s\n", status.IPv6)
+	}
+	if status.FloatingIP != "" {
+		fmt.Printf("  Floating IP:    %s\n", status.FloatingIP)
+	}
+	if status.PrivateIP != "" {
+		fmt.Printf("  Private IP:     %s\n", status.PrivateIP)
+	}
+	fmt.Printf("  Type:           %s\n", status.Type)
+	fmt.Printf("  Location:       %s\n", status.Location)
+	fmt.Printf("  Datacenter:     %s\n", status.Datacenter)
+	if status.Placement != "" {
+		fmt.Printf("  Placement:      %s\n", status.Placement)
+	}
+	fmt.Printf("  Image:          %s\n", status.Image)
+
+	if status.App != nil {
+		fmt.Println("\n📦 Application Status")
+		fmt.Println("────────────────────────────────────")
+		fmt.Printf("  %s:  %s\n", status.App.Unit, status.App.State)
+		if status.App.Release != "" {
+			fmt.Printf("  Release:        %s\n", status.App.Release)
+		}
+	}
+
+	if len(status.Docker) > 0 {
+		fmt.Println("\n🐳 Docker Services")
+		fmt.Println("────────────────────────────────────")
+		for _, line := range status.Docker {
+			fmt.Printf("  %s\n", line)
+		}
+	}
+
+	if status.Disk != "" || status.Memory != "" {
+		fmt.Println("\n💾 Resources")
+		fmt.Println("────────────────────────────────────")
+		fmt.Printf("  Disk Usage:     %s\n", status.Disk)
+		fmt.Printf("  Memory Usage:   %s\n", status.Memory)
+	}
+
 	fmt.Println()
-	return nil
 }
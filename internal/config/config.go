@@ -2,9 +2,15 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -17,6 +23,46 @@ type Config struct {
 	Build       BuildConfig    `yaml:"build"`
 	Deploy      DeployConfig   `yaml:"deploy"`
 	Services    ServicesConfig `yaml:"services,omitempty"`
+	Proxy       *ProxyConfig   `yaml:"proxy,omitempty"`
+	Secrets     SecretsConfig  `yaml:"secrets,omitempty"`
+
+	LoadBalancer *LoadBalancerConfig `yaml:"load_balancer,omitempty"`
+	Firewall     *FirewallConfig     `yaml:"firewall,omitempty"`
+	Network      *NetworkConfig      `yaml:"network,omitempty"`
+	DNS          *DNSConfig          `yaml:"dns,omitempty"`
+
+	Environments map[string]EnvironmentConfig `yaml:"environments,omitempty"`
+
+	// Dir is the directory containing the loaded config file
+	Dir string `yaml:"-"`
+	// Env is the environment applied on top of the base config, "" for none
+	Env string `yaml:"-"`
+}
+
+// EnvironmentConfig overrides parts of the base configuration for one
+// environment, e.g. staging or production
+type EnvironmentConfig struct {
+	Server   ServerConfig      `yaml:"server,omitempty"` // set fields replace the base server's
+	Deploy   EnvironmentDeploy `yaml:"deploy,omitempty"`
+	Services ServicesConfig    `yaml:"services,omitempty"` // set services replace the base definitions
+	Proxy    EnvironmentProxy  `yaml:"proxy,omitempty"`
+	DNS      *DNSConfig        `yaml:"dns,omitempty"` // replaces the base dns section
+}
+
+// EnvironmentDeploy holds the deploy settings an environment may override
+type EnvironmentDeploy struct {
+	Env map[string]string `yaml:"env,omitempty"` // merged over deploy.env
+}
+
+// EnvironmentProxy holds the proxy settings an environment may override
+type EnvironmentProxy struct {
+	Domains []string `yaml:"domains,omitempty"` // replaces proxy.domains
+}
+
+// SecretsConfig locates the encrypted secrets file and who can decrypt it
+type SecretsConfig struct {
+	File       string   `yaml:"file,omitempty"`       // default secrets.enc.yaml next to .gotzer.yaml
+	Recipients []string `yaml:"recipients,omitempty"` // age public keys of everyone allowed to decrypt
 }
 
 type ServerConfig struct {
@@ -26,6 +72,33 @@ type ServerConfig struct {
 	Image        string `yaml:"image"`
 	Architecture string `yaml:"architecture"` // x64 or arm64
 	FreePorts    []int  `yaml:"free_ports,omitempty"`
+	Backups      *bool  `yaml:"backups,omitempty"` // Hetzner automatic daily backups
+	IPv4         *bool  `yaml:"ipv4,omitempty"`    // public IPv4 address, default true; false creates IPv6-only servers
+
+	// A group of app servers is declared with one of these instead of a single name
+	Count    int      `yaml:"count,omitempty"`    // servers named <name>-1 … <name>-<count>
+	Names    []string `yaml:"names,omitempty"`    // explicit server names
+	Selector string   `yaml:"selector,omitempty"` // Hetzner label selector, e.g. "role=web"
+
+	// Spreading the servers of a group for resilience
+	Locations      []string `yaml:"locations,omitempty"`       // create servers round-robin in these locations
+	PlacementGroup string   `yaml:"placement_group,omitempty"` // "spread": each server on a different physical host
+
+	Volumes []VolumeConfig `yaml:"volumes,omitempty"`
+
+	// A public IPv4 kept across server rebuilds, assigned to the first server.
+	// gotzer creates it under this name or adopts an existing one.
+	FloatingIP string `yaml:"floating_ip,omitempty"` // Hetzner Floating IP
+	PrimaryIP  string `yaml:"primary_ip,omitempty"`  // Hetzner Primary IP, used as the server's own IPv4
+}
+
+// VolumeConfig is a Hetzner Volume attached to each app server. Its data
+// survives rebuilding or destroying the server.
+type VolumeConfig struct {
+	Name       string `yaml:"name"`                  // the Hetzner volume is named <server>-<name>
+	Size       int    `yaml:"size"`                  // GB, at least 10
+	Filesystem string `yaml:"filesystem,omitempty"`  // "ext4" (default) or "xfs"
+	MountPoint string `yaml:"mount_point,omitempty"` // default /mnt/<name>
 }
 
 type BuildConfig struct {
@@ -39,12 +112,136 @@ type BuildConfig struct {
 }
 
 type DeployConfig struct {
-	Type        string            `yaml:"type"` // "service" or "static"
-	RemotePath  string            `yaml:"remote_path"`
-	ServiceName string            `yaml:"service_name"`
-	User        string            `yaml:"user"`
-	Command     []string          `yaml:"command,omitempty"`
-	Env         map[string]string `yaml:"env,omitempty"`
+	Type         string             `yaml:"type"` // "service" or "static"
+	RemotePath   string             `yaml:"remote_path"`
+	ServiceName  string             `yaml:"service_name"`
+	User         string             `yaml:"user"`
+	Command      []string           `yaml:"command,omitempty"`
+	Env          map[string]string  `yaml:"env,omitempty"`
+	KeepReleases int                `yaml:"keep_releases,omitempty"` // number of releases kept for rollback
+	HealthCheck  *HealthCheckConfig `yaml:"health_check,omitempty"`
+	Strategy     string             `yaml:"strategy,omitempty"` // "restart" (default) or "blue-green"
+	BlueGreen    BlueGreenConfig    `yaml:"blue_green,omitempty"`
+	Rollout      RolloutConfig      `yaml:"rollout,omitempty"`
+}
+
+// RolloutConfig controls how a release is rolled out to a group of servers
+type RolloutConfig struct {
+	BatchSize int           `yaml:"batch_size,omitempty"` // servers deployed at once, default 1
+	Pause     time.Duration `yaml:"pause,omitempty"`      // wait between batches
+}
+
+// BlueGreenConfig configures the ports of the two app instances and the
+// local reverse proxy that switches between them
+type BlueGreenConfig struct {
+	BluePort  int    `yaml:"blue_port,omitempty"`  // default 8081
+	GreenPort int    `yaml:"green_port,omitempty"` // default 8082
+	Listen    string `yaml:"listen,omitempty"`     // proxy listen address, default ":80"
+}
+
+// HealthCheckConfig describes how a freshly started release is probed.
+// The probe runs on the server itself, against 127.0.0.1.
+type HealthCheckConfig struct {
+	Type           string        `yaml:"type,omitempty"` // "http" (default) or "tcp"
+	Path           string        `yaml:"path,omitempty"` // http only, default "/"
+	Port           int           `yaml:"port"`
+	ExpectedStatus int           `yaml:"expected_status,omitempty"` // http only, default 200
+	Timeout        time.Duration `yaml:"timeout,omitempty"`         // per attempt, default 5s
+	Retries        int           `yaml:"retries,omitempty"`         // default 5
+	Interval       time.Duration `yaml:"interval,omitempty"`        // between attempts, default 2s
+	GracePeriod    time.Duration `yaml:"grace_period,omitempty"`    // before the first attempt
+}
+
+// ProxyConfig configures the Caddy reverse proxy installed on the server.
+// Caddy obtains TLS certificates for the domains automatically.
+type ProxyConfig struct {
+	Domains      []string          `yaml:"domains,omitempty"`       // empty serves plain HTTP on :80
+	Email        string            `yaml:"email,omitempty"`         // ACME account email
+	UpstreamPort int               `yaml:"upstream_port,omitempty"` // service deploys, defaults to deploy.env PORT
+	Root         string            `yaml:"root,omitempty"`          // static deploys, defaults to <remote_path>/current
+	Redirects    []RedirectConfig  `yaml:"redirects,omitempty"`
+	Headers      map[string]string `yaml:"headers,omitempty"`
+}
+
+// LoadBalancerConfig configures a Hetzner Load Balancer in front of the app
+// servers. TLS for its domains is terminated with a managed certificate.
+type LoadBalancerConfig struct {
+	Name      string                      `yaml:"name,omitempty"`      // default <server.name>-lb
+	Type      string                      `yaml:"type,omitempty"`      // default lb11
+	Location  string                      `yaml:"location,omitempty"`  // default server.location
+	Algorithm string                      `yaml:"algorithm,omitempty"` // "round_robin" (default) or "least_connections"
+	Domains   []string                    `yaml:"domains,omitempty"`   // managed certificate for https services
+	Selector  string                      `yaml:"selector,omitempty"`  // target servers by label instead of the app's servers
+	Drain     time.Duration               `yaml:"drain,omitempty"`     // wait after taking a server out during deploys, default 10s
+	Services  []LoadBalancerServiceConfig `yaml:"services,omitempty"`  // default https:443 with domains, else http:80
+}
+
+// LoadBalancerServiceConfig is a port the load balancer forwards to the targets
+type LoadBalancerServiceConfig struct {
+	Protocol        string                        `yaml:"protocol,omitempty"`         // "http" (default), "https" or "tcp"
+	ListenPort      int                           `yaml:"listen_port,omitempty"`      // default 80, 443 for https
+	DestinationPort int                           `yaml:"destination_port,omitempty"` // default the app's port
+	RedirectHTTP    bool                          `yaml:"redirect_http,omitempty"`    // https only, redirect port 80
+	StickySessions  bool                          `yaml:"sticky_sessions,omitempty"`
+	HealthCheck     LoadBalancerHealthCheckConfig `yaml:"health_check,omitempty"`
+}
+
+// LoadBalancerHealthCheckConfig describes how the load balancer probes targets
+type LoadBalancerHealthCheckConfig struct {
+	Protocol string        `yaml:"protocol,omitempty"` // "http" (default for http services) or "tcp"
+	Port     int           `yaml:"port,omitempty"`     // default destination_port
+	Path     string        `yaml:"path,omitempty"`     // http only, default deploy.health_check.path or "/"
+	Interval time.Duration `yaml:"interval,omitempty"` // default 15s
+	Timeout  time.Duration `yaml:"timeout,omitempty"`  // default 10s
+	Retries  int           `yaml:"retries,omitempty"`  // default 3
+}
+
+// FirewallConfig describes the Hetzner Cloud Firewall applied to the app
+// servers. It filters traffic before it reaches the server, so unlike UFW it
+// also holds for ports published by Docker.
+type FirewallConfig struct {
+	Name  string               `yaml:"name,omitempty"`  // default <server.name>-fw
+	Rules []FirewallRuleConfig `yaml:"rules,omitempty"` // default SSH, HTTP(S) and load balancer ports from anywhere
+}
+
+// FirewallRuleConfig allows inbound traffic; everything else is dropped
+type FirewallRuleConfig struct {
+	Description string   `yaml:"description,omitempty"`
+	Protocol    string   `yaml:"protocol,omitempty"` // "tcp" (default), "udp" or "icmp"
+	Port        string   `yaml:"port,omitempty"`     // "5432" or a range "8000-8100", not for icmp
+	Sources     []string `yaml:"sources,omitempty"`  // CIDRs or IPs, default anywhere
+}
+
+// NetworkConfig describes the Hetzner private network the app servers are
+// attached to. Projects that use the same network name share the network, so
+// an app can reach e.g. a database server provisioned from another config.
+type NetworkConfig struct {
+	Name    string `yaml:"name,omitempty"`     // default <server.name>-net
+	IPRange string `yaml:"ip_range,omitempty"` // default 10.0.0.0/16
+	Subnet  string `yaml:"subnet,omitempty"`   // default 10.0.1.0/24, inside ip_range
+	Zone    string `yaml:"zone,omitempty"`     // default from server.location, e.g. eu-central
+}
+
+// DNSConfig describes the A and AAAA records gotzer keeps pointing at the app
+// in a DNS zone hosted by Hetzner: at the load balancer if there is one, else
+// the floating IP, else every app server.
+type DNSConfig struct {
+	Zone    string   `yaml:"zone"`              // e.g. example.com
+	Records []string `yaml:"records,omitempty"` // names in the zone, "@" for the apex; default proxy.domains in the zone, else "@"
+	TTL     int      `yaml:"ttl,omitempty"`     // seconds, default 300
+	IPv6    *bool    `yaml:"ipv6,omitempty"`    // also manage AAAA records, default true
+}
+
+// IPv6Enabled reports whether AAAA records are managed
+func (d *DNSConfig) IPv6Enabled() bool {
+	return d.IPv6 == nil || *d.IPv6
+}
+
+// RedirectConfig redirects a path ("/old") or a whole host ("www.example.com")
+type RedirectConfig struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+	Code int    `yaml:"code,omitempty"` // default 308
 }
 
 type ServicesConfig struct {
@@ -63,10 +260,15 @@ type ServiceConfig struct {
 	Command string            `yaml:"command,omitempty"`
 	Volumes []string          `yaml:"volumes,omitempty"`
 	Env     map[string]string `yaml:"env,omitempty"`
+
+	// PrivateIP is set by WithPrivateIP; the port is then published on
+	// localhost and this IP
+	PrivateIP string `yaml:"-"`
 }
 
-// Load reads the project configuration from .gotzer.yaml
-func Load(path string) (*Config, error) {
+// Load reads the project configuration from .gotzer.yaml and applies the
+// overrides of the given environment, if any
+func Load(path, env string) (*Config, error) {
 	if path == "" {
 		path = ".gotzer.yaml"
 	}
@@ -84,10 +286,86 @@ func Load(path string) (*Config, error) {
 
 	var config Config
 	if err := yaml.Unmarshal([]byte(expanded), &config); err != nil {
+		if strings.Contains(err.Error(), "into time.Duration") {
+			return nil, fmt.Errorf("failed to parse config: %w\ndurations need a unit, e.g. \"5s\" or \"2m\"", err)
+		}
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
 
+	config.Dir = filepath.Dir(path)
+
+	if env != "" {
+		if err := config.applyEnvironment(env); err != nil {
+			return nil, err
+		}
+	}
+
 	// Set defaults
+	groups := 0
+	for _, set := range []bool{config.Server.Count > 1, len(config.Server.Names) > 0, config.Server.Selector != ""} {
+		if set {
+			groups++
+		}
+	}
+	if groups > 1 {
+		return nil, fmt.Errorf("server.count, server.names and server.selector are mutually exclusive")
+	}
+	if config.Server.Count < 0 {
+		return nil, fmt.Errorf("server.count must not be negative")
+	}
+	if config.Server.FloatingIP != "" && config.Server.PrimaryIP != "" {
+		return nil, fmt.Errorf("server.floating_ip and server.primary_ip are mutually exclusive")
+	}
+	if !config.Server.IPv4Enabled() && (config.Server.FloatingIP != "" || config.Server.PrimaryIP != "") {
+		return nil, fmt.Errorf("server.floating_ip and server.primary_ip are IPv4 addresses and need server.ipv4")
+	}
+	if config.Server.PrimaryIP != "" && config.Server.Selector != "" {
+		return nil, fmt.Errorf("server.primary_ip needs servers created by gotzer and cannot be used with server.selector")
+	}
+	if s := &config.Server; len(s.Locations) > 0 {
+		if s.Selector != "" {
+			return nil, fmt.Errorf("server.locations applies to servers created by gotzer and cannot be used with server.selector")
+		}
+		if s.Location == "" {
+			s.Location = s.Locations[0]
+		} else if !slices.Contains(s.Locations, s.Location) {
+			return nil, fmt.Errorf("server.location %s is not one of server.locations", s.Location)
+		}
+	}
+	switch config.Server.PlacementGroup {
+	case "":
+	case "spread":
+		if config.Server.Selector != "" {
+			return nil, fmt.Errorf("server.placement_group applies to servers created by gotzer and cannot be used with server.selector")
+		}
+		if n := len(config.Server.ServerNames()); n > 10 {
+			return nil, fmt.Errorf("server.placement_group spread holds at most 10 servers, not %d", n)
+		}
+	default:
+		return nil, fmt.Errorf("server.placement_group must be \"spread\"")
+	}
+	for i := range config.Server.Volumes {
+		v := &config.Server.Volumes[i]
+		if v.Name == "" {
+			return nil, fmt.Errorf("server.volumes[%d].name is required", i)
+		}
+		if v.Size < 10 {
+			return nil, fmt.Errorf("server.volumes[%d].size must be at least 10 (GB)", i)
+		}
+		switch v.Filesystem {
+		case "":
+			v.Filesystem = "ext4"
+		case "ext4", "xfs":
+		default:
+			return nil, fmt.Errorf("server.volumes[%d].filesystem must be ext4 or xfs, got %q", i, v.Filesystem)
+		}
+		if v.MountPoint == "" {
+			v.MountPoint = "/mnt/" + v.Name
+		}
+	}
+	if config.Deploy.Rollout.BatchSize <= 0 {
+		config.Deploy.Rollout.BatchSize = 1
+	}
 	if config.Server.Architecture == "" {
 		config.Server.Architecture = "x64"
 	}
@@ -100,10 +378,709 @@ func Load(path string) (*Config, error) {
 	if config.Deploy.User == "" {
 		config.Deploy.User = "app"
 	}
+	if config.Secrets.File == "" {
+		config.Secrets.File = "secrets.enc.yaml"
+	}
+	if config.Deploy.KeepReleases <= 0 {
+		config.Deploy.KeepReleases = 5
+	}
+	if config.Deploy.Strategy == "" {
+		config.Deploy.Strategy = "restart"
+	}
+	if config.Deploy.IsBlueGreen() {
+		if config.Deploy.Type == "static" {
+			return nil, fmt.Errorf("deploy.strategy blue-green is only supported for service deploys")
+		}
+		if config.Deploy.HealthCheck == nil {
+			return nil, fmt.Errorf("deploy.strategy blue-green requires deploy.health_check")
+		}
+		if config.Deploy.BlueGreen.BluePort == 0 {
+			config.Deploy.BlueGreen.BluePort = 8081
+		}
+		if config.Deploy.BlueGreen.GreenPort == 0 {
+			config.Deploy.BlueGreen.GreenPort = 8082
+		}
+		if config.Deploy.BlueGreen.Listen == "" {
+			config.Deploy.BlueGreen.Listen = ":80"
+		}
+	}
+	if p := config.Proxy; p != nil {
+		if p.UpstreamPort == 0 && config.Deploy.Type != "static" && !config.Deploy.IsBlueGreen() {
+			port, err := strconv.Atoi(config.Deploy.Env["PORT"])
+			if err != nil {
+				return nil, fmt.Errorf("proxy.upstream_port is required when deploy.env has no numeric PORT")
+			}
+			p.UpstreamPort = port
+		}
+		// Caddy listens on 80 and 443 itself
+		if p.UpstreamPort == 80 || p.UpstreamPort == 443 {
+			return nil, fmt.Errorf("proxy.upstream_port %d is taken by the proxy; run the app on another port, e.g. deploy.env PORT: \"8080\"", p.UpstreamPort)
+		}
+		if p.Root == "" {
+			p.Root = config.Deploy.CurrentPath()
+		}
+		for i := range p.Redirects {
+			if p.Redirects[i].Code == 0 {
+				p.Redirects[i].Code = 308
+			}
+		}
+	}
+	if err := checkDuration("deploy.rollout.pause", config.Deploy.Rollout.Pause); err != nil {
+		return nil, err
+	}
+	if hc := config.Deploy.HealthCheck; hc != nil {
+		if err := checkDuration("deploy.health_check.timeout", hc.Timeout); err != nil {
+			return nil, err
+		}
+		if err := checkDuration("deploy.health_check.interval", hc.Interval); err != nil {
+			return nil, err
+		}
+		if err := checkDuration("deploy.health_check.grace_period", hc.GracePeriod); err != nil {
+			return nil, err
+		}
+		if hc.Type == "" {
+			hc.Type = "http"
+		}
+		if hc.Path == "" {
+			hc.Path = "/"
+		}
+		if hc.ExpectedStatus == 0 {
+			hc.ExpectedStatus = 200
+		}
+		if hc.Timeout <= 0 {
+			hc.Timeout = 5 * time.Second
+		}
+		if hc.Retries <= 0 {
+			hc.Retries = 5
+		}
+		if hc.Interval <= 0 {
+			hc.Interval = 2 * time.Second
+		}
+		// Blue-green probes each instance on its own port
+		if hc.Port == 0 && !config.Deploy.IsBlueGreen() {
+			return nil, fmt.Errorf("deploy.health_check.port is required")
+		}
+	}
+	if lb := config.LoadBalancer; lb != nil {
+		if err := config.setLoadBalancerDefaults(lb); err != nil {
+			return nil, err
+		}
+	}
+	if fw := config.Firewall; fw != nil {
+		if err := config.setFirewallDefaults(fw); err != nil {
+			return nil, err
+		}
+	}
+	if d := config.DNS; d != nil {
+		if err := config.setDNSDefaults(d); err != nil {
+			return nil, err
+		}
+	}
+	if n := config.Network; n != nil {
+		if err := config.setNetworkDefaults(n); err != nil {
+			return nil, err
+		}
+	} else {
+		for k, v := range config.Deploy.Env {
+			if strings.Contains(v, "private_ip") {
+				return nil, fmt.Errorf("deploy.env.%s uses private_ip, which requires a network section", k)
+			}
+		}
+	}
 
 	return &config, nil
 }
 
+// setLoadBalancerDefaults fills in the load balancer settings that were left
+// out, deriving the target port from how the app is exposed on the servers
+func (c *Config) setLoadBalancerDefaults(lb *LoadBalancerConfig) error {
+	if lb.Name == "" {
+		lb.Name = c.Server.Name + "-lb"
+	}
+	if lb.Type == "" {
+		lb.Type = "lb11"
+	}
+	if lb.Location == "" {
+		lb.Location = c.Server.Location
+	}
+	switch lb.Algorithm {
+	case "":
+		lb.Algorithm = "round_robin"
+	case "round_robin", "least_connections":
+	default:
+		return fmt.Errorf("load_balancer.algorithm must be round_robin or least_connections, got %q", lb.Algorithm)
+	}
+	if err := checkDuration("load_balancer.drain", lb.Drain); err != nil {
+		return err
+	}
+	if lb.Drain <= 0 {
+		lb.Drain = 10 * time.Second
+	}
+	if len(lb.Services) == 0 {
+		if len(lb.Domains) > 0 {
+			lb.Services = []LoadBalancerServiceConfig{{Protocol: "https", RedirectHTTP: true}}
+		} else {
+			lb.Services = []LoadBalancerServiceConfig{{Protocol: "http"}}
+		}
+	}
+
+	for i := range lb.Services {
+		svc := &lb.Services[i]
+		switch svc.Protocol {
+		case "":
+			svc.Protocol = "http"
+		case "http", "tcp":
+		case "https":
+			if len(lb.Domains) == 0 {
+				return fmt.Errorf("load_balancer.services[%d]: https requires load_balancer.domains", i)
+			}
+		default:
+			return fmt.Errorf("load_balancer.services[%d].protocol must be http, https or tcp, got %q", i, svc.Protocol)
+		}
+		if svc.ListenPort == 0 {
+			svc.ListenPort = 80
+			if svc.Protocol == "https" {
+				svc.ListenPort = 443
+			}
+		}
+		if svc.DestinationPort == 0 {
+			port, err := c.appPort()
+			if err != nil {
+				return fmt.Errorf("load_balancer.services[%d].destination_port is required: %w", i, err)
+			}
+			svc.DestinationPort = port
+		}
+
+		hc := &svc.HealthCheck
+		if err := checkDuration(fmt.Sprintf("load_balancer.services[%d].health_check.interval", i), hc.Interval); err != nil {
+			return err
+		}
+		if err := checkDuration(fmt.Sprintf("load_balancer.services[%d].health_check.timeout", i), hc.Timeout); err != nil {
+			return err
+		}
+		if hc.Protocol == "" {
+			hc.Protocol = "http"
+			if svc.Protocol == "tcp" {
+				hc.Protocol = "tcp"
+			}
+		}
+		if hc.Port == 0 {
+			hc.Port = svc.DestinationPort
+		}
+		if hc.Path == "" {
+			hc.Path = "/"
+			if c.Deploy.HealthCheck != nil && c.Deploy.HealthCheck.Type == "http" {
+				hc.Path = c.Deploy.HealthCheck.Path
+			}
+		}
+		if hc.Interval <= 0 {
+			hc.Interval = 15 * time.Second
+		}
+		if hc.Timeout <= 0 {
+			hc.Timeout = 10 * time.Second
+		}
+		if hc.Retries <= 0 {
+			hc.Retries = 3
+		}
+	}
+	return nil
+}
+
+// setFirewallDefaults fills in the firewall name and rules and validates the
+// rules, normalizing sources to CIDRs
+func (c *Config) setFirewallDefaults(fw *FirewallConfig) error {
+	if fw.Name == "" {
+		fw.Name = c.Server.Name + "-fw"
+	}
+	if len(fw.Rules) == 0 {
+		fw.Rules = []FirewallRuleConfig{
+			{Description: "SSH", Port: "22"},
+			{Description: "HTTP", Port: "80"},
+			{Description: "HTTPS", Port: "443"},
+		}
+		if lb := c.LoadBalancer; lb != nil {
+			for _, svc := range lb.Services {
+				for _, port := range []int{svc.DestinationPort, svc.HealthCheck.Port} {
+					p := strconv.Itoa(port)
+					if !slices.ContainsFunc(fw.Rules, func(r FirewallRuleConfig) bool { return r.Port == p }) {
+						fw.Rules = append(fw.Rules, FirewallRuleConfig{Description: "Load balancer", Port: p})
+					}
+				}
+			}
+		}
+	}
+
+	ssh := false
+	for i := range fw.Rules {
+		r := &fw.Rules[i]
+		switch r.Protocol {
+		case "":
+			r.Protocol = "tcp"
+		case "tcp", "udp":
+		case "icmp":
+			if r.Port != "" {
+				return fmt.Errorf("firewall.rules[%d]: icmp rules take no port", i)
+			}
+		default:
+			return fmt.Errorf("firewall.rules[%d].protocol must be tcp, udp or icmp, got %q", i, r.Protocol)
+		}
+		if r.Protocol != "icmp" {
+			low, high, err := parsePortRange(r.Port)
+			if err != nil {
+				return fmt.Errorf("firewall.rules[%d].port: %w", i, err)
+			}
+			if r.Protocol == "tcp" && low <= 22 && 22 <= high {
+				ssh = true
+			}
+		}
+
+		if len(r.Sources) == 0 {
+			r.Sources = []string{"0.0.0.0/0", "::/0"}
+		}
+		for j, src := range r.Sources {
+			if !strings.Contains(src, "/") {
+				if ip := net.ParseIP(src); ip != nil && ip.To4() != nil {
+					src += "/32"
+				} else {
+					src += "/128"
+				}
+			}
+			_, ipNet, err := net.ParseCIDR(src)
+			if err != nil {
+				return fmt.Errorf("firewall.rules[%d].sources: invalid CIDR %q", i, r.Sources[j])
+			}
+			r.Sources[j] = ipNet.String()
+		}
+	}
+	// gotzer itself connects over SSH
+	if !ssh {
+		return fmt.Errorf("firewall.rules must allow tcp port 22, or gotzer cannot reach the servers")
+	}
+	return nil
+}
+
+// networkZones maps locations to their network zone
+var networkZones = map[string]string{
+	"fsn1": "eu-central",
+	"nbg1": "eu-central",
+	"hel1": "eu-central",
+	"ash":  "us-east",
+	"hil":  "us-west",
+	"sin":  "ap-southeast",
+}
+
+// setNetworkDefaults fills in the network name, ranges and zone and checks
+// that the subnet lies inside the network's IP range
+func (c *Config) setNetworkDefaults(n *NetworkConfig) error {
+	if n.Name == "" {
+		n.Name = c.Server.Name + "-net"
+	}
+	if n.IPRange == "" {
+		n.IPRange = "10.0.0.0/16"
+	}
+	if n.Subnet == "" {
+		n.Subnet = "10.0.1.0/24"
+	}
+	if n.Zone == "" {
+		zone, ok := networkZones[c.Server.Location]
+		if !ok {
+			return fmt.Errorf("network.zone is required for location %q", c.Server.Location)
+		}
+		n.Zone = zone
+	}
+	for _, location := range c.Server.Locations {
+		if zone, ok := networkZones[location]; ok && zone != n.Zone {
+			return fmt.Errorf("server.locations: %s is in network zone %s, not %s", location, zone, n.Zone)
+		}
+	}
+
+	_, ipRange, err := net.ParseCIDR(n.IPRange)
+	if err != nil {
+		return fmt.Errorf("network.ip_range: invalid CIDR %q", n.IPRange)
+	}
+	subnetIP, subnet, err := net.ParseCIDR(n.Subnet)
+	if err != nil {
+		return fmt.Errorf("network.subnet: invalid CIDR %q", n.Subnet)
+	}
+	rangeSize, _ := ipRange.Mask.Size()
+	subnetSize, _ := subnet.Mask.Size()
+	if !ipRange.Contains(subnetIP) || subnetSize < rangeSize {
+		return fmt.Errorf("network.subnet %s is not inside network.ip_range %s", n.Subnet, n.IPRange)
+	}
+	return nil
+}
+
+// setDNSDefaults fills in the TTL and records and makes the record names
+// relative to the zone
+func (c *Config) setDNSDefaults(d *DNSConfig) error {
+	d.Zone = strings.ToLower(strings.TrimSuffix(d.Zone, "."))
+	if d.Zone == "" {
+		return fmt.Errorf("dns.zone is required")
+	}
+	if d.TTL == 0 {
+		d.TTL = 300
+	}
+	if d.TTL < 60 {
+		return fmt.Errorf("dns.ttl must be at least 60 seconds")
+	}
+
+	names := d.Records
+	if len(names) == 0 && c.Proxy != nil {
+		for _, domain := range c.Proxy.Domains {
+			if _, ok := relativeName(domain, d.Zone); ok {
+				names = append(names, domain)
+			}
+		}
+	}
+	if len(names) == 0 {
+		names = []string{"@"}
+	}
+	d.Records = nil
+	for _, name := range names {
+		rel, ok := relativeName(name, d.Zone)
+		if !ok {
+			return fmt.Errorf("dns.records: %s is not in zone %s", name, d.Zone)
+		}
+		if !slices.Contains(d.Records, rel) {
+			d.Records = append(d.Records, rel)
+		}
+	}
+	return nil
+}
+
+// relativeName returns a record name relative to the zone, "@" for the apex.
+// A single label is relative already; other names must end in the zone.
+func relativeName(name, zone string) (string, bool) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	switch {
+	case name == "@" || name == zone:
+		return "@", true
+	case strings.HasSuffix(name, "."+zone):
+		return strings.TrimSuffix(name, "."+zone), true
+	case strings.Contains(name, "."):
+		return "", false
+	}
+	return name, name != ""
+}
+
+// checkDuration rejects durations below a second, which are a mistyped unit
+// like "5ns" rather than a real setting
+func checkDuration(field string, d time.Duration) error {
+	if d > 0 && d < time.Second {
+		return fmt.Errorf("%s is %s, less than a second; use e.g. \"5s\"", field, d)
+	}
+	return nil
+}
+
+// parsePortRange parses "80" or "8000-8100"
+func parsePortRange(s string) (low, high int, err error) {
+	if s == "" {
+		return 0, 0, fmt.Errorf("port is required")
+	}
+	lowStr, highStr, isRange := strings.Cut(s, "-")
+	low, err = strconv.Atoi(lowStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port %q", s)
+	}
+	high = low
+	if isRange {
+		if high, err = strconv.Atoi(highStr); err != nil {
+			return 0, 0, fmt.Errorf("invalid port range %q", s)
+		}
+	}
+	if low < 1 || high > 65535 || low > high {
+		return 0, 0, fmt.Errorf("invalid port %q", s)
+	}
+	return low, high, nil
+}
+
+// appPort returns the port the app is reachable on from outside the server:
+// the Caddy proxy's, the blue-green switch's or the PORT from deploy.env
+func (c *Config) appPort() (int, error) {
+	switch {
+	case c.Proxy != nil:
+		return 80, nil
+	case c.Deploy.IsBlueGreen():
+		_, port, err := net.SplitHostPort(c.Deploy.BlueGreen.Listen)
+		if err != nil {
+			return 0, fmt.Errorf("invalid deploy.blue_green.listen: %w", err)
+		}
+		return strconv.Atoi(port)
+	default:
+		port, err := strconv.Atoi(c.Deploy.Env["PORT"])
+		if err != nil {
+			return 0, fmt.Errorf("deploy.env has no numeric PORT")
+		}
+		return port, nil
+	}
+}
+
+// applyEnvironment merges the named environment into the base configuration.
+// Without a server name override the server is named <server.name>-<env>, and
+// likewise for floating and primary IPs.
+func (c *Config) applyEnvironment(name string) error {
+	e, ok := c.Environments[name]
+	if !ok {
+		names := make([]string, 0, len(c.Environments))
+		for n := range c.Environments {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return fmt.Errorf("environment %q not found: .gotzer.yaml has no environments section", name)
+		}
+		return fmt.Errorf("environment %q not found (available: %s)", name, strings.Join(names, ", "))
+	}
+	c.Env = name
+
+	s := &c.Server
+	if e.Server.Name != "" {
+		s.Name = e.Server.Name
+	} else {
+		s.Name = fmt.Sprintf("%s-%s", s.Name, name)
+	}
+	if len(e.Server.Names) > 0 {
+		s.Names = e.Server.Names
+	} else {
+		for i, n := range s.Names {
+			s.Names[i] = fmt.Sprintf("%s-%s", n, name)
+		}
+	}
+	if e.Server.Count > 0 {
+		s.Count = e.Server.Count
+	}
+	if e.Server.Selector != "" {
+		s.Selector = e.Server.Selector
+	}
+	if e.Server.Location != "" {
+		s.Location = e.Server.Location
+	}
+	if len(e.Server.Locations) > 0 {
+		s.Locations = e.Server.Locations
+	}
+	if e.Server.PlacementGroup != "" {
+		s.PlacementGroup = e.Server.PlacementGroup
+	}
+	if e.Server.Type != "" {
+		s.Type = e.Server.Type
+	}
+	if e.Server.Image != "" {
+		s.Image = e.Server.Image
+	}
+	if e.Server.Architecture != "" {
+		s.Architecture = e.Server.Architecture
+	}
+	if len(e.Server.FreePorts) > 0 {
+		s.FreePorts = e.Server.FreePorts
+	}
+	if e.Server.Backups != nil {
+		s.Backups = e.Server.Backups
+	}
+	if e.Server.IPv4 != nil {
+		s.IPv4 = e.Server.IPv4
+	}
+	if len(e.Server.Volumes) > 0 {
+		s.Volumes = e.Server.Volumes
+	}
+	if e.Server.FloatingIP != "" {
+		s.FloatingIP = e.Server.FloatingIP
+	} else if s.FloatingIP != "" {
+		s.FloatingIP = fmt.Sprintf("%s-%s", s.FloatingIP, name)
+	}
+	if e.Server.PrimaryIP != "" {
+		s.PrimaryIP = e.Server.PrimaryIP
+	} else if s.PrimaryIP != "" {
+		s.PrimaryIP = fmt.Sprintf("%s-%s", s.PrimaryIP, name)
+	}
+
+	if len(e.Deploy.Env) > 0 {
+		merged := make(map[string]string, len(c.Deploy.Env)+len(e.Deploy.Env))
+		for k, v := range c.Deploy.Env {
+			merged[k] = v
+		}
+		for k, v := range e.Deploy.Env {
+			merged[k] = v
+		}
+		c.Deploy.Env = merged
+	}
+
+	if e.Services.Postgres != nil {
+		c.Services.Postgres = e.Services.Postgres
+	}
+	if e.Services.Typesense != nil {
+		c.Services.Typesense = e.Services.Typesense
+	}
+	if e.Services.Redis != nil {
+		c.Services.Redis = e.Services.Redis
+	}
+	if e.Services.Centrifugo != nil {
+		c.Services.Centrifugo = e.Services.Centrifugo
+	}
+	if len(e.Services.Custom) > 0 {
+		c.Services.Custom = e.Services.Custom
+	}
+
+	if e.DNS != nil {
+		c.DNS = e.DNS
+	}
+	if len(e.Proxy.Domains) > 0 {
+		if c.Proxy == nil {
+			return fmt.Errorf("environments.%s.proxy.domains requires a proxy section", name)
+		}
+		c.Proxy.Domains = e.Proxy.Domains
+	}
+	return nil
+}
+
+// ServerNames returns the names of the app servers. It is nil when the
+// servers are discovered through server.selector.
+func (s *ServerConfig) ServerNames() []string {
+	switch {
+	case s.Selector != "":
+		return nil
+	case len(s.Names) > 0:
+		return s.Names
+	case s.Count > 1:
+		names := make([]string, s.Count)
+		for i := range names {
+			names[i] = fmt.Sprintf("%s-%d", s.Name, i+1)
+		}
+		return names
+	default:
+		return []string{s.Name}
+	}
+}
+
+// ServerLocation returns the location of the named app server: server.locations
+// in turn by the server's position in ServerNames, else server.location
+func (s *ServerConfig) ServerLocation(name string) string {
+	if len(s.Locations) > 0 {
+		if i := slices.Index(s.ServerNames(), name); i >= 0 {
+			return s.Locations[i%len(s.Locations)]
+		}
+	}
+	return s.Location
+}
+
+// PlacementGroupName returns the name of the servers' Hetzner placement group
+func (s *ServerConfig) PlacementGroupName() string {
+	return s.Name + "-" + s.PlacementGroup
+}
+
+// IPv4Enabled reports whether new servers get a public IPv4 address
+func (s *ServerConfig) IPv4Enabled() bool {
+	return s.IPv4 == nil || *s.IPv4
+}
+
+// BackupsEnabled reports whether the servers get Hetzner's automatic backups
+func (s *ServerConfig) BackupsEnabled() bool {
+	return s.Backups != nil && *s.Backups
+}
+
+// Volume returns the configured volume with the given name
+func (s *ServerConfig) Volume(name string) (*VolumeConfig, bool) {
+	for i := range s.Volumes {
+		if s.Volumes[i].Name == name {
+			return &s.Volumes[i], true
+		}
+	}
+	return nil, false
+}
+
+// VolumeName returns the name of the Hetzner volume for a server
+func (v *VolumeConfig) VolumeName(server string) string {
+	return server + "-" + v.Name
+}
+
+// Labels returns the Hetzner labels identifying the app's resources
+func (c *Config) Labels() map[string]string {
+	labels := map[string]string{"gotzer/app": c.Name, "gotzer/managed": "true"}
+	if c.Env != "" {
+		labels["gotzer/env"] = c.Env
+	}
+	return labels
+}
+
+// ExpandPrivateIPs expands the templates in deploy.env, which reference the
+// private IPs of servers in the network, e.g. {{ private_ip "db" }}. ips maps
+// server names to their private IPs.
+func (c *Config) ExpandPrivateIPs(ips map[string]string) error {
+	funcs := template.FuncMap{
+		"private_ip": func(server string) (string, error) {
+			ip, ok := ips[server]
+			if !ok {
+				return "", fmt.Errorf("server %s is not attached to network %s", server, c.Network.Name)
+			}
+			return ip, nil
+		},
+	}
+
+	env := make(map[string]string, len(c.Deploy.Env))
+	for k, v := range c.Deploy.Env {
+		env[k] = v
+		if !strings.Contains(v, "{{") {
+			continue
+		}
+		tmpl, err := template.New(k).Funcs(funcs).Parse(v)
+		if err != nil {
+			return fmt.Errorf("deploy.env.%s: %w", k, err)
+		}
+		var out strings.Builder
+		if err := tmpl.Execute(&out, nil); err != nil {
+			return fmt.Errorf("deploy.env.%s: %w", k, err)
+		}
+		env[k] = out.String()
+	}
+	c.Deploy.Env = env
+	return nil
+}
+
+// WithPrivateIP returns a copy of the config for a server with the given
+// private IP. Services without a bind_ip publish their ports on localhost and
+// that IP, so they are reachable over the network but not from the internet.
+func (c *Config) WithPrivateIP(ip string) *Config {
+	cp := *c
+	if ip == "" {
+		return &cp
+	}
+	bind := func(svc *ServiceConfig) *ServiceConfig {
+		if svc == nil || svc.BindIP != "" {
+			return svc
+		}
+		bound := *svc
+		bound.PrivateIP = ip
+		return &bound
+	}
+	cp.Services.Postgres = bind(c.Services.Postgres)
+	cp.Services.Typesense = bind(c.Services.Typesense)
+	cp.Services.Redis = bind(c.Services.Redis)
+	cp.Services.Centrifugo = bind(c.Services.Centrifugo)
+	if len(c.Services.Custom) > 0 {
+		cp.Services.Custom = make([]ServiceConfig, len(c.Services.Custom))
+		for i := range c.Services.Custom {
+			cp.Services.Custom[i] = *bind(&c.Services.Custom[i])
+		}
+	}
+	return &cp
+}
+
+// LabelSelector returns the Hetzner label selector matching the resources of
+// the app in the current environment only
+func (c *Config) LabelSelector() string {
+	if c.Env == "" {
+		return fmt.Sprintf("gotzer/app=%s,!gotzer/env", c.Name)
+	}
+	return fmt.Sprintf("gotzer/app=%s,gotzer/env=%s", c.Name, c.Env)
+}
+
+// SecretsPath returns the path of the encrypted secrets file
+func (c *Config) SecretsPath() string {
+	if filepath.IsAbs(c.Secrets.File) {
+		return c.Secrets.File
+	}
+	return filepath.Join(c.Dir, c.Secrets.File)
+}
+
 // GOARCH returns the Go architecture string
 func (s *ServerConfig) GOARCH() string {
 	switch strings.ToLower(s.Architecture) {
@@ -114,6 +1091,29 @@ func (s *ServerConfig) GOARCH() string {
 	}
 }
 
+// ReleasesDir returns the directory holding all deployed releases
+func (d *DeployConfig) ReleasesDir() string {
+	return d.RemotePath + "/releases"
+}
+
+// IsBlueGreen reports whether deploys alternate between two app instances
+func (d *DeployConfig) IsBlueGreen() bool {
+	return d.Strategy == "blue-green"
+}
+
+// ColorPort returns the port the given blue-green instance listens on
+func (d *DeployConfig) ColorPort(color string) int {
+	if color == "green" {
+		return d.BlueGreen.GreenPort
+	}
+	return d.BlueGreen.BluePort
+}
+
+// CurrentPath returns the symlink pointing at the active release
+func (d *DeployConfig) CurrentPath() string {
+	return d.RemotePath + "/current"
+}
+
 // ExpandPath expands ~ to home directory
 func ExpandPath(path string) string {
 	if strings.HasPrefix(path, "~/") {
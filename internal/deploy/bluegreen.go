@@ -0,0 +1,144 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/proxy"
+	"github.com/DawnKosmos/gotzer/internal/report"
+	"github.com/DawnKosmos/gotzer/internal/ssh"
+	"github.com/DawnKosmos/gotzer/internal/systemd"
+)
+
+// activeColorPath returns the file recording which blue-green instance serves traffic
+func activeColorPath(cfg *config.Config) string {
+	return cfg.Deploy.RemotePath + "/active-color"
+}
+
+// ActiveColor returns "blue" or "green", or "" before the first blue-green deploy
+func ActiveColor(ctx context.Context, sc *ssh.Client, cfg *config.Config) (string, error) {
+	output, err := sc.Run(ctx, fmt.Sprintf("cat %s 2>/dev/null || true", activeColorPath(cfg)))
+	if err != nil {
+		return "", fmt.Errorf("failed to read active color: %w", err)
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// ActiveUnit returns the systemd unit currently serving the app
+func ActiveUnit(ctx context.Context, sc *ssh.Client, cfg *config.Config) (string, error) {
+	if !cfg.Deploy.IsBlueGreen() {
+		return cfg.Deploy.ServiceName, nil
+	}
+	color, err := ActiveColor(ctx, sc, cfg)
+	if err != nil {
+		return "", err
+	}
+	if color == "" {
+		return cfg.Deploy.ServiceName, nil
+	}
+	return systemd.InstanceName(cfg, color), nil
+}
+
+// otherColor returns the idle instance given the active one
+func otherColor(color string) string {
+	if color == "blue" {
+		return "green"
+	}
+	return "blue"
+}
+
+// switchBlueGreen starts the release on the idle instance, health-checks it,
+// points the proxy at it and then stops the previously active instance.
+// Traffic stays on the old instance if anything fails before the switch.
+func switchBlueGreen(ctx context.Context, sc *ssh.Client, cfg *config.Config, releaseID string, r report.Reporter) error {
+	active, err := ActiveColor(ctx, sc, cfg)
+	if err != nil {
+		return err
+	}
+	next := otherColor(active)
+	nextUnit := systemd.InstanceName(cfg, next)
+	nextPort := cfg.Deploy.ColorPort(next)
+	remotePath := cfg.Deploy.RemotePath
+
+	// Step 1: Link the release and port for the idle instance
+	step := report.Start(r, "prepare", "🔀", fmt.Sprintf("Preparing %s instance on port %d...", next, nextPort))
+	releasePath := path.Join(cfg.Deploy.ReleasesDir(), releaseID)
+	linkCmd := fmt.Sprintf("sudo ln -sfn %s %s/%s.tmp && sudo mv -Tf %s/%s.tmp %s/%s",
+		releasePath, remotePath, next, remotePath, next, remotePath, next)
+	if _, err := sc.Run(ctx, linkCmd); err != nil {
+		return step.Fail(fmt.Errorf("failed to link release for %s: %w", next, err))
+	}
+	envCmd := fmt.Sprintf(`echo 'PORT=%d' | sudo tee %s/%s.env > /dev/null`, nextPort, remotePath, next)
+	if _, err := sc.Run(ctx, envCmd); err != nil {
+		return step.Fail(fmt.Errorf("failed to write %s environment: %w", next, err))
+	}
+	step.Done()
+
+	// Step 2: Update the template unit
+	step = report.Start(r, "configure", "⚙️", "Updating service configuration...")
+	if err := systemd.Configure(ctx, sc, cfg); err != nil {
+		return step.Fail(fmt.Errorf("failed to update service config: %w", err))
+	}
+	step.Done()
+
+	// Step 3: Start the idle instance next to the active one
+	step = report.Start(r, "start", "🚀", fmt.Sprintf("Starting %s...", nextUnit))
+	if _, err := sc.Run(ctx, fmt.Sprintf("sudo systemctl restart %s", nextUnit)); err != nil {
+		return step.Fail(stopFailedInstance(ctx, sc, nextUnit, fmt.Errorf("failed to start %s: %w", nextUnit, err), r))
+	}
+	step.Done()
+
+	// Step 4: Health-check it on its own port
+	step = report.Start(r, "health_check", "🩺", "Running health check...")
+	probe := *cfg.Deploy.HealthCheck
+	probe.Port = nextPort
+	if err := CheckHealth(ctx, sc, &probe, r); err != nil {
+		return step.Fail(stopFailedInstance(ctx, sc, nextUnit, err, r))
+	}
+	step.Done()
+
+	// Step 5: Switch the proxy upstream
+	step = report.Start(r, "switch_traffic", "🔁", fmt.Sprintf("Switching traffic to %s...", next))
+	if err := proxy.Apply(ctx, sc, proxy.RenderCaddyfile(cfg, nextPort)); err != nil {
+		return step.Fail(stopFailedInstance(ctx, sc, nextUnit, err, r))
+	}
+	if err := activateRelease(ctx, sc, cfg, releaseID); err != nil {
+		return step.Fail(err)
+	}
+	if _, err := sc.Run(ctx, fmt.Sprintf(`echo '%s' | sudo tee %s > /dev/null`, next, activeColorPath(cfg))); err != nil {
+		return step.Fail(fmt.Errorf("failed to record active color: %w", err))
+	}
+	if _, err := sc.Run(ctx, fmt.Sprintf("sudo systemctl enable %s", nextUnit)); err != nil {
+		return step.Fail(fmt.Errorf("failed to enable %s: %w", nextUnit, err))
+	}
+	step.Done()
+
+	// Step 6: Stop the old instance; the plain unit is left over from restart deploys
+	oldUnit := cfg.Deploy.ServiceName
+	if active != "" {
+		oldUnit = systemd.InstanceName(cfg, active)
+	}
+	step = report.Start(r, "stop_old", "🛑", fmt.Sprintf("Stopping %s...", oldUnit))
+	if _, err := sc.Run(ctx, fmt.Sprintf("sudo systemctl disable --now %s 2>/dev/null || true", oldUnit)); err != nil {
+		report.Warn(r, "Note: %v", err)
+	}
+	report.Info(r, "%s is serving on port %d", nextUnit, nextPort)
+	step.Done()
+	return nil
+}
+
+// stopFailedInstance reports the instance logs, stops it and returns the failure
+func stopFailedInstance(ctx context.Context, sc *ssh.Client, unit string, cause error, r report.Reporter) error {
+	logs, logErr := sc.Run(ctx, fmt.Sprintf("sudo journalctl -u %s -n 10 --no-pager", unit))
+	if logErr == nil {
+		report.Warn(r, "Release failed. Last 10 lines of logs:\n%s", strings.TrimRight(logs, "\n"))
+	}
+	if _, err := sc.Run(ctx, fmt.Sprintf("sudo systemctl stop %s 2>/dev/null || true", unit)); err != nil {
+		report.Warn(r, "Note: %v", err)
+	}
+	report.Info(r, "Traffic was not switched; the previous instance keeps serving")
+	return cause
+}
@@ -4,10 +4,16 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 
 	"github.com/DawnKosmos/gotzer/internal/build"
 	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/docker"
+	"github.com/DawnKosmos/gotzer/internal/proxy"
+	"github.com/DawnKosmos/gotzer/internal/report"
+	"github.com/DawnKosmos/gotzer/internal/secrets"
 	"github.com/DawnKosmos/gotzer/internal/ssh"
 	"github.com/DawnKosmos/gotzer/internal/systemd"
 )
@@ -16,6 +22,11 @@ import (
 type Deployer struct {
 	Config    *config.Config
 	SSHClient *ssh.Client
+	Secrets   *secrets.Secrets // decrypted secrets, may be nil
+	Reporter  report.Reporter
+
+	// ReleaseID is the release created by the last Deploy call
+	ReleaseID string
 }
 
 // NewDeployer creates a new deployer
@@ -23,15 +34,28 @@ func NewDeployer(cfg *config.Config, sshClient *ssh.Client) *Deployer {
 	return &Deployer{
 		Config:    cfg,
 		SSHClient: sshClient,
+		Reporter:  report.Terminal(),
 	}
 }
 
 // Deploy builds and deploys the application
 func (d *Deployer) Deploy(ctx context.Context) error {
+	artifact, err := d.Build(ctx)
+	if err != nil {
+		return err
+	}
+	defer cleanupArtifact(d.Config, artifact)
+
+	return d.Release(ctx, artifact, NewReleaseID())
+}
+
+// Build compiles the application and returns the path of the binary, or of
+// the output directory for static builds. The binary lives in a temporary
+// directory removed by cleanupArtifact.
+func (d *Deployer) Build(ctx context.Context) (string, error) {
 	cfg := d.Config
 
-	// Step 1: Build the binary
-	fmt.Println("\n📦 Building application...")
+	step := report.Start(d.Reporter, "build", "📦", "Building application...")
 	builder := build.NewBuilder(
 		cfg.Build.Type,
 		cfg.Build.Main,
@@ -42,85 +66,315 @@ func (d *Deployer) Deploy(ctx context.Context) error {
 	builder.Dir = cfg.Build.Dir
 	builder.LDFlags = cfg.Build.LDFlags
 	builder.Env = cfg.Build.Env
+	builder.Reporter = d.Reporter
 
 	binaryPath, err := builder.Build(ctx)
 	if err != nil {
-		return fmt.Errorf("build failed: %w", err)
+		return "", step.Fail(fmt.Errorf("build failed: %w", err))
 	}
-	defer os.RemoveAll(filepath.Dir(binaryPath)) // Cleanup temp dir
+	step.Done()
+	return binaryPath, nil
+}
 
-	// Step 2: Stop the service
-	fmt.Println("\n🛑 Stopping service...")
-	_, stopErr := d.SSHClient.Run(ctx, fmt.Sprintf("sudo systemctl stop %s 2>/dev/null || true", cfg.Deploy.ServiceName))
-	if stopErr != nil {
-		fmt.Printf("  ⚠ Note: %v\n", stopErr)
+// cleanupArtifact removes the temporary build directory of a Go binary.
+// Static build output belongs to the project and is left alone.
+func cleanupArtifact(cfg *config.Config, artifact string) {
+	if cfg.Build.Type != "static" {
+		os.RemoveAll(filepath.Dir(artifact))
 	}
+}
 
-	// Step 3: Upload the application
-	fmt.Println("\n📤 Uploading application...")
-	remotePath := cfg.Deploy.RemotePath
+// Release uploads a built artifact to the server as the given release and
+// activates it
+func (d *Deployer) Release(ctx context.Context, binaryPath, releaseID string) error {
+	cfg := d.Config
+	r := d.Reporter
+
+	d.ReleaseID = releaseID
+	releasePath := path.Join(cfg.Deploy.ReleasesDir(), releaseID)
+
+	// Another deploy may have created the same release at the same moment
+	if exists, err := d.releaseExists(ctx, releasePath); err != nil {
+		return err
+	} else if exists {
+		return fmt.Errorf("release %s already exists in %s; another deploy may be running", releaseID, cfg.Deploy.ReleasesDir())
+	}
+
+	if err := d.updateServiceSecrets(ctx); err != nil {
+		return err
+	}
+
+	// Step 2: Upload the application into a new release directory
+	step := report.Start(r, "upload", "📤", fmt.Sprintf("Uploading release %s...", releaseID))
 
 	if cfg.Deploy.Type == "static" {
-		if err := d.SSHClient.UploadDir(ctx, binaryPath, remotePath); err != nil {
-			return fmt.Errorf("static upload failed: %w", err)
+		if err := d.SSHClient.UploadDir(ctx, binaryPath, releasePath); err != nil {
+			return step.Fail(fmt.Errorf("static upload failed: %w", err))
 		}
-		fmt.Printf("  → Uploaded directory to %s\n", remotePath)
+		report.Info(r, "Uploaded directory to %s", releasePath)
 
 		// Set permissions
-		_, err = d.SSHClient.Run(ctx, fmt.Sprintf("sudo chown -R %s:%s %s && sudo chmod -R 755 %s",
-			cfg.Deploy.User, cfg.Deploy.User, remotePath, remotePath))
+		_, err := d.SSHClient.Run(ctx, fmt.Sprintf("sudo chown -R %s:%s %s && sudo chmod -R 755 %s",
+			cfg.Deploy.User, cfg.Deploy.User, releasePath, releasePath))
+		if err != nil {
+			return step.Fail(fmt.Errorf("failed to set permissions: %w", err))
+		}
+		step.Done()
+
+		previousRelease, err := CurrentRelease(ctx, d.SSHClient, cfg)
 		if err != nil {
-			return fmt.Errorf("failed to set permissions: %w", err)
+			return err
+		}
+
+		// Step 3: Switch the current symlink
+		step = report.Start(r, "activate", "🔀", "Activating release...")
+		if err := activateRelease(ctx, d.SSHClient, cfg, releaseID); err != nil {
+			return step.Fail(err)
 		}
+		report.Info(r, "%s → %s", cfg.Deploy.CurrentPath(), releasePath)
+		step.Done()
 
-		fmt.Println("\n🎉 Static deployment complete!")
+		if cfg.Deploy.HealthCheck != nil {
+			step = report.Start(r, "health_check", "🩺", "Running health check...")
+			if err := CheckHealth(ctx, d.SSHClient, cfg.Deploy.HealthCheck, r); err != nil {
+				step.Fail(err)
+				if previousRelease != "" {
+					step = report.Start(r, "restore", "↩️ ", fmt.Sprintf("Restoring release %s...", previousRelease))
+					if revertErr := activateRelease(ctx, d.SSHClient, cfg, previousRelease); revertErr != nil {
+						return step.Fail(fmt.Errorf("%w (restore failed: %v)", err, revertErr))
+					}
+					step.Done()
+				}
+				return err
+			}
+			step.Done()
+		}
+
+		if err := d.reloadProxy(ctx); err != nil {
+			return err
+		}
+
+		if err := pruneReleases(ctx, d.SSHClient, cfg, r); err != nil {
+			report.Warn(r, "Could not prune old releases: %v", err)
+		}
+
+		report.Success(r, "🎉", "Static deployment complete! Release: %s", releaseID)
 		return nil
 	}
 
-	// Legacy Go upload logic
-	remoteBinaryPath := filepath.Join(remotePath, cfg.Build.Output)
+	remoteBinaryPath := path.Join(releasePath, cfg.Build.Output)
 
 	// Upload to temp location first
 	tempPath := fmt.Sprintf("/tmp/%s", cfg.Build.Output)
 	if err := d.SSHClient.Upload(ctx, binaryPath, tempPath); err != nil {
-		return fmt.Errorf("upload failed: %w", err)
+		return step.Fail(fmt.Errorf("upload failed: %w", err))
+	}
+
+	// Move into the release directory with sudo and set permissions
+	_, err := d.SSHClient.Run(ctx, fmt.Sprintf("sudo mkdir -p %s && sudo mv %s %s && sudo chmod +x %s && sudo setcap 'cap_net_bind_service=+ep' %s && sudo chown -R %s:%s %s",
+		releasePath, tempPath, remoteBinaryPath, remoteBinaryPath, remoteBinaryPath, cfg.Deploy.User, cfg.Deploy.User, releasePath))
+	if err != nil {
+		return step.Fail(fmt.Errorf("failed to move or configure binary: %w", err))
+	}
+
+	report.Info(r, "Uploaded to %s", remoteBinaryPath)
+	step.Done()
+
+	if cfg.Deploy.IsBlueGreen() {
+		if err := systemd.WriteEnvFile(ctx, d.SSHClient, cfg, d.Secrets); err != nil {
+			return err
+		}
+		if err := switchBlueGreen(ctx, d.SSHClient, cfg, releaseID, r); err != nil {
+			return err
+		}
+
+		if err := pruneReleases(ctx, d.SSHClient, cfg, r); err != nil {
+			report.Warn(r, "Could not prune old releases: %v", err)
+		}
+
+		report.Success(r, "🎉", "Deployment complete! Release: %s", releaseID)
+		return nil
 	}
 
-	// Move to final location with sudo and set permissions
-	_, err = d.SSHClient.Run(ctx, fmt.Sprintf("sudo mv %s %s && sudo chmod +x %s && sudo setcap 'cap_net_bind_service=+ep' %s",
-		tempPath, remoteBinaryPath, remoteBinaryPath, remoteBinaryPath))
+	// Remember what is running now so a failed release can be reverted
+	previousRelease, err := CurrentRelease(ctx, d.SSHClient, cfg)
+	if err != nil {
+		return err
+	}
+	previousUnit, err := systemd.ReadUnit(ctx, d.SSHClient, systemd.UnitPath(cfg))
+	if err != nil {
+		return err
+	}
+	previousEnv, err := d.SSHClient.ReadFile(ctx, systemd.EnvFilePath(cfg))
 	if err != nil {
-		return fmt.Errorf("failed to move or configure binary: %w", err)
+		return err
+	}
+	previous := previousState{release: previousRelease, unit: previousUnit, env: previousEnv}
+
+	// Step 3: Stop the service
+	step = report.Start(r, "stop", "🛑", "Stopping service...")
+	_, stopErr := d.SSHClient.Run(ctx, fmt.Sprintf("sudo systemctl stop %s 2>/dev/null || true", cfg.Deploy.ServiceName))
+	if stopErr != nil {
+		report.Warn(r, "Note: %v", stopErr)
 	}
+	step.Done()
 
-	fmt.Printf("  → Uploaded to %s\n", remoteBinaryPath)
+	// Step 4: Switch the current symlink
+	step = report.Start(r, "activate", "🔀", "Activating release...")
+	if err := activateRelease(ctx, d.SSHClient, cfg, releaseID); err != nil {
+		return step.Fail(err)
+	}
+	report.Info(r, "%s → %s", cfg.Deploy.CurrentPath(), releasePath)
+	step.Done()
 
-	// Step 4: Update service configuration
-	fmt.Println("\n⚙️ Updating service configuration...")
+	// Step 5: Update service configuration
+	step = report.Start(r, "configure", "⚙️", "Updating service configuration...")
+	if err := systemd.WriteEnvFile(ctx, d.SSHClient, cfg, d.Secrets); err != nil {
+		return step.Fail(err)
+	}
 	if err := systemd.Configure(ctx, d.SSHClient, d.Config); err != nil {
-		return fmt.Errorf("failed to update service config: %w", err)
+		return step.Fail(fmt.Errorf("failed to update service config: %w", err))
 	}
+	step.Done()
 
-	// Step 5: Start the service
-	fmt.Println("\n🚀 Starting service...")
+	// Step 6: Start the service
+	step = report.Start(r, "start", "🚀", "Starting service...")
 	_, err = d.SSHClient.Run(ctx, fmt.Sprintf("sudo systemctl start %s", cfg.Deploy.ServiceName))
 	if err != nil {
-		return fmt.Errorf("failed to start service: %w", err)
+		return d.revert(ctx, previous, step.Fail(fmt.Errorf("failed to start service: %w", err)))
 	}
+	step.Done()
 
-	// Step 6: Check service status
-	fmt.Println("\n✅ Checking status...")
+	// Step 7: Check service status
+	step = report.Start(r, "status", "✅", "Checking status...")
 	output, err := d.SSHClient.Run(ctx, fmt.Sprintf("systemctl is-active %s", cfg.Deploy.ServiceName))
 	if err != nil {
-		// If it failed, try to get logs to show why
-		logs, logErr := d.SSHClient.Run(ctx, fmt.Sprintf("sudo journalctl -u %s -n 10 --no-pager", cfg.Deploy.ServiceName))
-		if logErr == nil {
-			fmt.Printf("\n❌ Service failed to start. Last 10 lines of logs:\n%s\n", logs)
+		return d.revert(ctx, previous, step.Fail(fmt.Errorf("service failed to start: %w", err)))
+	}
+	report.Info(r, "Service status: %s", strings.TrimSpace(output))
+	step.Done()
+
+	// Step 8: Probe the application
+	if cfg.Deploy.HealthCheck != nil {
+		step = report.Start(r, "health_check", "🩺", "Running health check...")
+		if err := CheckHealth(ctx, d.SSHClient, cfg.Deploy.HealthCheck, r); err != nil {
+			return d.revert(ctx, previous, step.Fail(err))
+		}
+		step.Done()
+	}
+
+	if err := d.reloadProxy(ctx); err != nil {
+		return err
+	}
+
+	if err := pruneReleases(ctx, d.SSHClient, cfg, r); err != nil {
+		report.Warn(r, "Could not prune old releases: %v", err)
+	}
+
+	report.Success(r, "🎉", "Deployment complete! Release: %s", releaseID)
+	return nil
+}
+
+// reloadProxy re-renders and reloads the Caddy configuration, if a proxy is configured
+func (d *Deployer) reloadProxy(ctx context.Context) error {
+	if d.Config.Proxy == nil {
+		return nil
+	}
+
+	step := report.Start(d.Reporter, "reload_proxy", "🔁", "Reloading Caddy...")
+	if err := proxy.Apply(ctx, d.SSHClient, proxy.Render(d.Config)); err != nil {
+		return step.Fail(fmt.Errorf("failed to reload proxy: %w", err))
+	}
+	step.Done()
+	return nil
+}
+
+// previousState is what was running before a deploy, used to revert it
+type previousState struct {
+	release string
+	unit    string
+	env     string
+}
+
+// revert reports the service logs, restores the previous release, unit and
+// environment file, restarts the service and returns the original failure
+func (d *Deployer) revert(ctx context.Context, previous previousState, cause error) error {
+	cfg := d.Config
+	r := d.Reporter
+
+	// Show why the release failed
+	logs, logErr := d.SSHClient.Run(ctx, fmt.Sprintf("sudo journalctl -u %s -n 10 --no-pager", cfg.Deploy.ServiceName))
+	if logErr == nil {
+		report.Warn(r, "Release failed. Last 10 lines of logs:\n%s", strings.TrimRight(logs, "\n"))
+	}
+
+	if previous.release == "" {
+		report.Warn(r, "No previous release to restore")
+		return cause
+	}
+
+	step := report.Start(r, "restore", "↩️ ", fmt.Sprintf("Restoring release %s...", previous.release))
+	if err := activateRelease(ctx, d.SSHClient, cfg, previous.release); err != nil {
+		return step.Fail(fmt.Errorf("%w (restore failed: %v)", cause, err))
+	}
+	if previous.env != "" {
+		if err := d.SSHClient.WriteFile(ctx, systemd.EnvFilePath(cfg), []byte(previous.env), 0600); err != nil {
+			return step.Fail(fmt.Errorf("%w (restore failed: %v)", cause, err))
+		}
+	} else if _, err := d.SSHClient.Run(ctx, fmt.Sprintf("sudo rm -f %s", systemd.EnvFilePath(cfg))); err != nil {
+		// The previous release ran without an environment file
+		return step.Fail(fmt.Errorf("%w (restore failed: %v)", cause, err))
+	}
+	if previous.unit != "" {
+		if err := systemd.WriteUnit(ctx, d.SSHClient, systemd.UnitPath(cfg), strings.TrimRight(previous.unit, "\n")); err != nil {
+			return step.Fail(fmt.Errorf("%w (restore failed: %v)", cause, err))
 		}
-		return fmt.Errorf("service failed to start (status %v): %w", err, err)
 	}
-	fmt.Printf("  → Service status: %s", output)
+	if _, err := d.SSHClient.Run(ctx, fmt.Sprintf("sudo systemctl restart %s", cfg.Deploy.ServiceName)); err != nil {
+		return step.Fail(fmt.Errorf("%w (restart of previous release failed: %v)", cause, err))
+	}
+
+	report.Info(r, "Release %s restored", previous.release)
+	step.Done()
+	return cause
+}
+
+// releaseExists reports whether a release directory is already on the server
+func (d *Deployer) releaseExists(ctx context.Context, releasePath string) (bool, error) {
+	output, err := d.SSHClient.Run(ctx, fmt.Sprintf("test -e %s && echo exists || true", releasePath))
+	if err != nil {
+		return false, fmt.Errorf("failed to check release directory: %w", err)
+	}
+	return strings.TrimSpace(output) == "exists", nil
+}
+
+// updateServiceSecrets refreshes the env files of the Docker services set up
+// by provision and recreates the services whose secrets changed
+func (d *Deployer) updateServiceSecrets(ctx context.Context) error {
+	cfg := d.Config
+	compose, err := d.SSHClient.ReadFile(ctx, docker.ComposePath(cfg))
+	if err != nil || compose == "" {
+		return err
+	}
 
-	fmt.Println("\n🎉 Deployment complete!")
+	written, err := docker.WriteEnvFiles(ctx, d.SSHClient, cfg, d.Secrets)
+	if err != nil {
+		return err
+	}
+	// Secrets may exist for services this server does not run
+	var changed []string
+	for _, name := range written {
+		if strings.Contains(compose, "\n  "+name+":\n") {
+			changed = append(changed, name)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	step := report.Start(d.Reporter, "services", "🐳", fmt.Sprintf("Restarting %s with new secrets...", strings.Join(changed, ", ")))
+	if _, err := d.SSHClient.Run(ctx, fmt.Sprintf("cd %s && sudo docker compose up -d %s", docker.ServicesDir(cfg), strings.Join(changed, " "))); err != nil {
+		return step.Fail(fmt.Errorf("failed to restart services: %w", err))
+	}
+	step.Done()
 	return nil
 }
@@ -0,0 +1,79 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/report"
+	"github.com/DawnKosmos/gotzer/internal/ssh"
+)
+
+// CheckHealth probes the application from the server until it answers as
+// expected or the retries are exhausted
+func CheckHealth(ctx context.Context, sc *ssh.Client, hc *config.HealthCheckConfig, r report.Reporter) error {
+	if hc.GracePeriod > 0 {
+		report.Info(r, "Waiting %v grace period...", hc.GracePeriod)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(hc.GracePeriod):
+		}
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= hc.Retries; attempt++ {
+		lastErr = probe(ctx, sc, hc)
+		if lastErr == nil {
+			report.Info(r, "Health check passed (attempt %d/%d)", attempt, hc.Retries)
+			return nil
+		}
+		report.Warn(r, "Health check attempt %d/%d failed: %v", attempt, hc.Retries, lastErr)
+
+		if attempt < hc.Retries {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(hc.Interval):
+			}
+		}
+	}
+
+	return fmt.Errorf("health check failed after %d attempts: %w", hc.Retries, lastErr)
+}
+
+// probe runs a single health check attempt over SSH
+func probe(ctx context.Context, sc *ssh.Client, hc *config.HealthCheckConfig) error {
+	port := hc.Port
+	timeout := int(hc.Timeout.Seconds())
+	if timeout < 1 {
+		timeout = 1
+	}
+
+	if hc.Type == "tcp" {
+		cmd := fmt.Sprintf("timeout %d bash -c '</dev/tcp/127.0.0.1/%d'", timeout, port)
+		if _, err := sc.Run(ctx, cmd); err != nil {
+			return fmt.Errorf("port %d not accepting connections", port)
+		}
+		return nil
+	}
+
+	url := fmt.Sprintf("http://127.0.0.1:%d%s", port, hc.Path)
+	cmd := fmt.Sprintf("curl -s -o /dev/null -w '%%{http_code}' --max-time %d '%s' || true", timeout, url)
+	output, err := sc.Run(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	status, err := strconv.Atoi(strings.TrimSpace(output))
+	if err != nil || status == 0 {
+		return fmt.Errorf("no response from %s", url)
+	}
+	if status != hc.ExpectedStatus {
+		return fmt.Errorf("%s returned %d, expected %d", url, status, hc.ExpectedStatus)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/report"
+	"github.com/DawnKosmos/gotzer/internal/ssh"
+)
+
+// releaseIDFormat is the timestamp layout used for release directory names.
+// It sorts lexically in chronological order, also next to the older IDs
+// without milliseconds.
+const releaseIDFormat = "20060102150405.000"
+
+// NewReleaseID returns a fresh release identifier based on the current time
+func NewReleaseID() string {
+	return time.Now().UTC().Format(releaseIDFormat)
+}
+
+// Release describes a release directory on the server
+type Release struct {
+	ID      string `json:"id"`
+	Path    string `json:"path"`
+	Current bool   `json:"current"`
+}
+
+// ListReleases returns all releases on the server, oldest first
+func ListReleases(ctx context.Context, sc *ssh.Client, cfg *config.Config) ([]Release, error) {
+	releasesDir := cfg.Deploy.ReleasesDir()
+
+	output, err := sc.Run(ctx, fmt.Sprintf("ls -1 %s 2>/dev/null || true", releasesDir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list releases: %w", err)
+	}
+
+	current, err := CurrentRelease(ctx, sc, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, line := range strings.Split(output, "\n") {
+		if id := strings.TrimSpace(line); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	releases := make([]Release, 0, len(ids))
+	for _, id := range ids {
+		releases = append(releases, Release{
+			ID:      id,
+			Path:    path.Join(releasesDir, id),
+			Current: id == current,
+		})
+	}
+	return releases, nil
+}
+
+// CurrentRelease returns the ID of the active release, or "" if none is active
+func CurrentRelease(ctx context.Context, sc *ssh.Client, cfg *config.Config) (string, error) {
+	output, err := sc.Run(ctx, fmt.Sprintf("readlink %s 2>/dev/null || true", cfg.Deploy.CurrentPath()))
+	if err != nil {
+		return "", fmt.Errorf("failed to read current release: %w", err)
+	}
+	target := strings.TrimSpace(output)
+	if target == "" {
+		return "", nil
+	}
+	return path.Base(target), nil
+}
+
+// activateRelease atomically points the current symlink at the given release
+func activateRelease(ctx context.Context, sc *ssh.Client, cfg *config.Config, id string) error {
+	current := cfg.Deploy.CurrentPath()
+	target := path.Join(cfg.Deploy.ReleasesDir(), id)
+
+	// ln -sfn on an existing link is not atomic, so create a temporary link and rename it over
+	cmd := fmt.Sprintf("sudo ln -sfn %s %s.tmp && sudo mv -Tf %s.tmp %s", target, current, current, current)
+	if _, err := sc.Run(ctx, cmd); err != nil {
+		return fmt.Errorf("failed to activate release %s: %w", id, err)
+	}
+	return nil
+}
+
+// pruneReleases removes the oldest releases beyond the configured retention count.
+// The active release is never removed.
+func pruneReleases(ctx context.Context, sc *ssh.Client, cfg *config.Config, r report.Reporter) error {
+	releases, err := ListReleases(ctx, sc, cfg)
+	if err != nil {
+		return err
+	}
+
+	excess := len(releases) - cfg.Deploy.KeepReleases
+	for _, rel := range releases {
+		if excess <= 0 {
+			break
+		}
+		if rel.Current {
+			continue
+		}
+		if _, err := sc.Run(ctx, fmt.Sprintf("sudo rm -rf %s", rel.Path)); err != nil {
+			return fmt.Errorf("failed to remove release %s: %w", rel.ID, err)
+		}
+		report.Info(r, "Removed old release %s", rel.ID)
+		excess--
+	}
+	return nil
+}
+
+// Rollback points the current symlink at a previous release and restarts the service.
+// Blue-green deploys start the release on the idle instance and switch traffic to it.
+// If id is empty, the release before the active one is used.
+func Rollback(ctx context.Context, sc *ssh.Client, cfg *config.Config, id string, r report.Reporter) (string, error) {
+	releases, err := ListReleases(ctx, sc, cfg)
+	if err != nil {
+		return "", err
+	}
+	if len(releases) == 0 {
+		return "", fmt.Errorf("no releases found in %s", cfg.Deploy.ReleasesDir())
+	}
+
+	target := -1
+	if id == "" {
+		for i, rel := range releases {
+			if rel.Current {
+				target = i - 1
+				break
+			}
+		}
+		if target < 0 {
+			return "", fmt.Errorf("no previous release to roll back to")
+		}
+	} else {
+		for i, rel := range releases {
+			if rel.ID == id {
+				target = i
+				break
+			}
+		}
+		if target < 0 {
+			return "", fmt.Errorf("release %s not found", id)
+		}
+		if releases[target].Current {
+			return "", fmt.Errorf("release %s is already active", id)
+		}
+	}
+
+	release := releases[target]
+	if cfg.Deploy.IsBlueGreen() {
+		if err := switchBlueGreen(ctx, sc, cfg, release.ID, r); err != nil {
+			return "", err
+		}
+		return release.ID, nil
+	}
+
+	if err := activateRelease(ctx, sc, cfg, release.ID); err != nil {
+		return "", err
+	}
+
+	if cfg.Deploy.Type != "static" {
+		if _, err := sc.Run(ctx, fmt.Sprintf("sudo systemctl restart %s", cfg.Deploy.ServiceName)); err != nil {
+			return "", fmt.Errorf("failed to restart service: %w", err)
+		}
+	}
+
+	return release.ID, nil
+}
@@ -0,0 +1,137 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/report"
+	"github.com/DawnKosmos/gotzer/internal/secrets"
+	"github.com/DawnKosmos/gotzer/internal/ssh"
+)
+
+// Target is a server taking part in a rollout
+type Target struct {
+	Name      string
+	SSHClient *ssh.Client
+
+	// Drain and Restore, if set, take the server out of a load balancer's
+	// rotation while its release is swapped and put it back afterwards
+	Drain   func(ctx context.Context) error
+	Restore func(ctx context.Context) error
+}
+
+// RolloutResult lists the servers a rollout reached
+type RolloutResult struct {
+	ReleaseID string
+	Deployed  []string // servers running the new release
+	Failed    []string // servers whose deploy failed and was reverted
+	Skipped   []string // servers not attempted after a failed batch
+}
+
+// Rollout builds the application once and releases it to the targets in
+// batches of deploy.rollout.batch_size. Servers in a batch are deployed
+// concurrently, each with its own health check; the rollout halts after the
+// first batch with a failure and leaves later servers on their current release.
+func Rollout(ctx context.Context, cfg *config.Config, s *secrets.Secrets, targets []Target, r report.Reporter) (*RolloutResult, error) {
+	builder := &Deployer{Config: cfg, Reporter: r}
+	artifact, err := builder.Build(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanupArtifact(cfg, artifact)
+
+	res := &RolloutResult{ReleaseID: NewReleaseID()}
+
+	// A single server keeps the plain, unprefixed output
+	if len(targets) == 1 {
+		if err := releaseTarget(ctx, cfg, s, targets[0], artifact, res.ReleaseID, r); err != nil {
+			res.Failed = append(res.Failed, targets[0].Name)
+			return res, err
+		}
+		res.Deployed = append(res.Deployed, targets[0].Name)
+		return res, nil
+	}
+
+	size := cfg.Deploy.Rollout.BatchSize
+	batches := (len(targets) + size - 1) / size
+	for i := 0; i < len(targets); i += size {
+		batch := targets[i:min(i+size, len(targets))]
+		names := make([]string, len(batch))
+		for j, t := range batch {
+			names[j] = t.Name
+		}
+		report.Info(r, "Batch %d/%d: %s", i/size+1, batches, strings.Join(names, ", "))
+
+		errs := make([]error, len(batch))
+		var wg sync.WaitGroup
+		for j, t := range batch {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[j] = releaseTarget(ctx, cfg, s, t, artifact, res.ReleaseID, report.WithServer(r, t.Name))
+			}()
+		}
+		wg.Wait()
+
+		var failed []error
+		for j, err := range errs {
+			if err != nil {
+				res.Failed = append(res.Failed, batch[j].Name)
+				failed = append(failed, fmt.Errorf("%s: %w", batch[j].Name, err))
+			} else {
+				res.Deployed = append(res.Deployed, batch[j].Name)
+			}
+		}
+		if len(failed) > 0 {
+			for _, t := range targets[i+len(batch):] {
+				res.Skipped = append(res.Skipped, t.Name)
+			}
+			if len(res.Skipped) > 0 {
+				report.Warn(r, "Rollout halted; not deployed to %s", strings.Join(res.Skipped, ", "))
+			}
+			return res, fmt.Errorf("rollout failed: %w", errors.Join(failed...))
+		}
+
+		if cfg.Deploy.Rollout.Pause > 0 && i+size < len(targets) {
+			report.Info(r, "Waiting %v before the next batch...", cfg.Deploy.Rollout.Pause)
+			select {
+			case <-ctx.Done():
+				return res, ctx.Err()
+			case <-time.After(cfg.Deploy.Rollout.Pause):
+			}
+		}
+	}
+
+	report.Success(r, "🎉", "Release %s rolled out to %d servers", res.ReleaseID, len(res.Deployed))
+	return res, nil
+}
+
+// releaseTarget releases the artifact to one server, draining it from the
+// load balancer first if the target supports it. The server is put back into
+// rotation even if the release failed, since it was reverted to the old one.
+func releaseTarget(ctx context.Context, cfg *config.Config, s *secrets.Secrets, t Target, artifact, releaseID string, r report.Reporter) error {
+	if t.Drain != nil {
+		step := report.Start(r, "drain", "🚦", "Draining load balancer target...")
+		if err := t.Drain(ctx); err != nil {
+			return step.Fail(err)
+		}
+		step.Done()
+	}
+
+	d := &Deployer{Config: cfg, SSHClient: t.SSHClient, Secrets: s, Reporter: r}
+	err := d.Release(ctx, artifact, releaseID)
+
+	if t.Restore != nil {
+		step := report.Start(r, "restore", "🔀", "Returning server to the load balancer...")
+		if rerr := t.Restore(ctx); rerr != nil {
+			return errors.Join(err, step.Fail(rerr))
+		}
+		step.Done()
+	}
+	return err
+}
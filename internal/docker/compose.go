@@ -2,11 +2,22 @@ package docker
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/DawnKosmos/gotzer/internal/config"
 )
 
+// ServicesDir returns the directory holding docker-compose.yml on the server
+func ServicesDir(cfg *config.Config) string {
+	return fmt.Sprintf("%s/services", cfg.Deploy.RemotePath)
+}
+
+// ComposePath returns the path of docker-compose.yml on the server
+func ComposePath(cfg *config.Config) string {
+	return fmt.Sprintf("%s/docker-compose.yml", ServicesDir(cfg))
+}
+
 // GenerateCompose creates the docker-compose.yml content
 func GenerateCompose(cfg *config.Config) string {
 	services := cfg.Services
@@ -15,18 +26,18 @@ func GenerateCompose(cfg *config.Config) string {
 	builder.WriteString("services:\n")
 
 	if services.Postgres != nil && services.Postgres.Enabled {
-		builder.WriteString(formatService("postgres", services.Postgres))
+		builder.WriteString(formatService(cfg, "postgres", services.Postgres))
 	}
 
 	if services.Typesense != nil && services.Typesense.Enabled {
-		builder.WriteString(formatService("typesense", services.Typesense))
+		builder.WriteString(formatService(cfg, "typesense", services.Typesense))
 	}
 
 	if services.Redis != nil && services.Redis.Enabled {
-		builder.WriteString(formatService("redis", services.Redis))
+		builder.WriteString(formatService(cfg, "redis", services.Redis))
 	}
 	if services.Centrifugo != nil && services.Centrifugo.Enabled {
-		builder.WriteString(formatService("centrifugo", services.Centrifugo))
+		builder.WriteString(formatService(cfg, "centrifugo", services.Centrifugo))
 	}
 
 	for _, svc := range services.Custom {
@@ -42,7 +53,7 @@ func GenerateCompose(cfg *config.Config) string {
 			// This generates invalid yaml if multiple custom services exist.
 			// For now, let's keep it 1:1 with existing logic but maybe append index if needed?
 			// Or just use "custom" as in original code.
-			builder.WriteString(formatService("custom", &svc))
+			builder.WriteString(formatService(cfg, "custom", &svc))
 		}
 	}
 
@@ -65,8 +76,13 @@ func GenerateCompose(cfg *config.Config) string {
 	return builder.String()
 }
 
+// EnvFileName returns the env file holding a service's secrets
+func EnvFileName(service string) string {
+	return fmt.Sprintf(".env.%s", service)
+}
+
 // formatService formats a single service for docker-compose
-func formatService(name string, svc *config.ServiceConfig) string {
+func formatService(cfg *config.Config, name string, svc *config.ServiceConfig) string {
 	var builder strings.Builder
 
 	builder.WriteString(fmt.Sprintf("  %s:\n", name))
@@ -80,6 +96,10 @@ func formatService(name string, svc *config.ServiceConfig) string {
 	if svc.Port > 0 {
 		if svc.BindIP != "" {
 			builder.WriteString(fmt.Sprintf("    ports:\n      - \"%s:%d:%d\"\n", svc.BindIP, svc.Port, svc.Port))
+		} else if svc.PrivateIP != "" {
+			builder.WriteString("    ports:\n")
+			builder.WriteString(fmt.Sprintf("      - \"127.0.0.1:%d:%d\"\n", svc.Port, svc.Port))
+			builder.WriteString(fmt.Sprintf("      - \"%s:%d:%d\"\n", svc.PrivateIP, svc.Port, svc.Port))
 		} else {
 			builder.WriteString(fmt.Sprintf("    ports:\n      - \"%d:%d\"\n", svc.Port, svc.Port))
 		}
@@ -88,16 +108,40 @@ func formatService(name string, svc *config.ServiceConfig) string {
 	if len(svc.Volumes) > 0 {
 		builder.WriteString("    volumes:\n")
 		for _, vol := range svc.Volumes {
-			builder.WriteString(fmt.Sprintf("      - %s\n", vol))
+			builder.WriteString(fmt.Sprintf("      - %s\n", volumeMount(cfg, name, vol)))
 		}
 	}
 
+	// Secrets are delivered as a root-only env file next to docker-compose.yml
+	builder.WriteString(fmt.Sprintf("    env_file:\n      - path: %s\n        required: false\n", EnvFileName(name)))
+
 	if len(svc.Env) > 0 {
 		builder.WriteString("    environment:\n")
-		for k, v := range svc.Env {
-			builder.WriteString(fmt.Sprintf("      %s: \"%s\"\n", k, v))
+		keys := make([]string, 0, len(svc.Env))
+		for k := range svc.Env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys) // stable output so plans only show real changes
+		for _, k := range keys {
+			builder.WriteString(fmt.Sprintf("      %s: \"%s\"\n", k, svc.Env[k]))
 		}
 	}
 
 	return builder.String()
 }
+
+// volumeMount resolves a volume entry whose source names one of
+// server.volumes to a bind mount of a per-service directory on it, e.g.
+// "data:/var/lib/postgresql/data" → "/mnt/data/postgres:/var/lib/postgresql/data".
+// Other entries are returned unchanged.
+func volumeMount(cfg *config.Config, service, entry string) string {
+	source, target, ok := strings.Cut(entry, ":")
+	if !ok {
+		return entry
+	}
+	v, ok := cfg.Server.Volume(source)
+	if !ok {
+		return entry
+	}
+	return fmt.Sprintf("%s/%s:%s", v.MountPoint, service, target)
+}
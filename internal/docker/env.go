@@ -0,0 +1,43 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/secrets"
+	"github.com/DawnKosmos/gotzer/internal/ssh"
+)
+
+// WriteEnvFiles installs each service's secrets as its root-only env file next
+// to docker-compose.yml. It returns the services whose file changed, so only
+// those need to be recreated.
+func WriteEnvFiles(ctx context.Context, sc *ssh.Client, cfg *config.Config, s *secrets.Secrets) ([]string, error) {
+	if s == nil {
+		return nil, nil
+	}
+	names := make([]string, 0, len(s.Services))
+	for name := range s.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var changed []string
+	for _, name := range names {
+		envPath := fmt.Sprintf("%s/%s", ServicesDir(cfg), EnvFileName(name))
+		content := secrets.FormatComposeEnvFile(s.Services[name])
+		current, err := sc.ReadFile(ctx, envPath)
+		if err != nil {
+			return nil, err
+		}
+		if current == content {
+			continue
+		}
+		if err := sc.WriteFile(ctx, envPath, []byte(content), 0600); err != nil {
+			return nil, fmt.Errorf("failed to write secrets for %s: %w", name, err)
+		}
+		changed = append(changed, name)
+	}
+	return changed, nil
+}
@@ -3,32 +3,110 @@ package hetzner
 import (
 	"context"
 	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
 	"time"
 
+	"github.com/DawnKosmos/gotzer/internal/report"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 )
 
+// DefaultActionTimeout bounds the wait for an action without a timeout of its own
+const DefaultActionTimeout = 10 * time.Minute
+
+// defaultActionTimeouts are the timeouts of actions that take longer, by command
+var defaultActionTimeouts = map[string]time.Duration{
+	"create_image": time.Hour, // snapshots grow with the disk
+	"change_type":  30 * time.Minute,
+}
+
 // Client wraps the Hetzner Cloud API client
 type Client struct {
 	client *hcloud.Client
+
+	endpoint       string
+	retry          RetryPolicy
+	actionTimeouts map[string]time.Duration
+	reporter       report.Reporter
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithRetryPolicy sets how failed API requests are retried
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// WithActionTimeout sets how long to wait for actions with the given command,
+// e.g. "create_server". The command "default" applies to all other actions.
+func WithActionTimeout(command string, timeout time.Duration) Option {
+	return func(c *Client) {
+		c.actionTimeouts[command] = timeout
+	}
+}
+
+// WithReporter reports the progress of the actions the client waits for
+func WithReporter(r report.Reporter) Option {
+	return func(c *Client) {
+		c.reporter = r
+	}
+}
+
+// WithEndpoint sends the requests to another API URL, e.g. a local stand-in
+func WithEndpoint(endpoint string) Option {
+	return func(c *Client) {
+		c.endpoint = endpoint
+	}
 }
 
 // NewClient creates a new Hetzner API client
-func NewClient(token string) *Client {
-	client := hcloud.NewClient(
+func NewClient(token string, opts ...Option) *Client {
+	c := &Client{
+		retry:          DefaultRetryPolicy,
+		actionTimeouts: maps.Clone(defaultActionTimeouts),
+		reporter:       report.Discard,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	hcloudOpts := []hcloud.ClientOption{
 		hcloud.WithToken(token),
 		hcloud.WithApplication("gotzer", "1.0.0"),
-	)
-	return &Client{client: client}
+		hcloud.WithHTTPClient(&http.Client{
+			Transport: &retryTransport{policy: c.retry, next: http.DefaultTransport},
+		}),
+		// Retries happen in the transport, which sees the rate limit headers
+		hcloud.WithRetryOpts(hcloud.RetryOpts{MaxRetries: 0}),
+	}
+	if c.endpoint != "" {
+		hcloudOpts = append(hcloudOpts, hcloud.WithEndpoint(c.endpoint))
+	}
+	c.client = hcloud.NewClient(hcloudOpts...)
+	return c
 }
 
 // ServerOpts contains options for creating a server
 type ServerOpts struct {
-	Name        string
-	Location    string
-	ServerType  string
-	Image       string
-	SSHKeyNames []string
+	Name           string
+	Location       string
+	ServerType     string
+	Image          string
+	SnapshotID     int64 // create the server from this snapshot instead of Image
+	PrimaryIPv4    int64 // ID of an unassigned Primary IP to use as the server's IPv4
+	NoIPv4         bool  // create an IPv6-only server
+	PlacementGroup int64 // ID of the placement group to create the server in
+	SSHKeyNames    []string
+	Labels         map[string]string
+	Firewalls      []int64 // IDs of Cloud Firewalls applied from the first boot
+	Networks       []int64 // IDs of private networks to attach
+	UserData       string  // cloud-init document run on the first boot
 }
 
 // CreateServer provisions a new Hetzner Cloud server
@@ -46,20 +124,59 @@ func (c *Client) CreateServer(ctx context.Context, opts ServerOpts) (*hcloud.Ser
 		sshKeys = append(sshKeys, key)
 	}
 
+	var firewalls []*hcloud.ServerCreateFirewall
+	for _, id := range opts.Firewalls {
+		firewalls = append(firewalls, &hcloud.ServerCreateFirewall{Firewall: hcloud.Firewall{ID: id}})
+	}
+
+	var networks []*hcloud.Network
+	for _, id := range opts.Networks {
+		networks = append(networks, &hcloud.Network{ID: id})
+	}
+
+	var placementGroup *hcloud.PlacementGroup
+	if opts.PlacementGroup != 0 {
+		placementGroup = &hcloud.PlacementGroup{ID: opts.PlacementGroup}
+	}
+
+	image := &hcloud.Image{Name: opts.Image}
+	if opts.SnapshotID != 0 {
+		image = &hcloud.Image{ID: opts.SnapshotID}
+	}
+
+	// Without a public net the server gets new IPv4 and IPv6 addresses
+	var publicNet *hcloud.ServerCreatePublicNet
+	switch {
+	case opts.NoIPv4:
+		publicNet = &hcloud.ServerCreatePublicNet{EnableIPv4: false, EnableIPv6: true}
+	case opts.PrimaryIPv4 != 0:
+		publicNet = &hcloud.ServerCreatePublicNet{
+			EnableIPv4: true,
+			EnableIPv6: true,
+			IPv4:       &hcloud.PrimaryIP{ID: opts.PrimaryIPv4},
+		}
+	}
+
 	// Create server
 	result, _, err := c.client.Server.Create(ctx, hcloud.ServerCreateOpts{
-		Name:       opts.Name,
-		ServerType: &hcloud.ServerType{Name: opts.ServerType},
-		Image:      &hcloud.Image{Name: opts.Image},
-		Location:   &hcloud.Location{Name: opts.Location},
-		SSHKeys:    sshKeys,
+		Name:           opts.Name,
+		ServerType:     &hcloud.ServerType{Name: opts.ServerType},
+		Image:          image,
+		Location:       &hcloud.Location{Name: opts.Location},
+		SSHKeys:        sshKeys,
+		Labels:         opts.Labels,
+		Firewalls:      firewalls,
+		Networks:       networks,
+		PublicNet:      publicNet,
+		UserData:       opts.UserData,
+		PlacementGroup: placementGroup,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create server: %w", err)
 	}
 
-	// Wait for server to be ready
-	if err := c.waitForAction(ctx, result.Action); err != nil {
+	// Wait for server to be ready and attached to its networks
+	if err := c.waitForActions(ctx, append([]*hcloud.Action{result.Action}, result.NextActions...)); err != nil {
 		return nil, fmt.Errorf("failed waiting for server creation: %w", err)
 	}
 
@@ -72,6 +189,52 @@ func (c *Client) CreateServer(ctx context.Context, opts ServerOpts) (*hcloud.Ser
 	return server, nil
 }
 
+// ServerIPv6 returns the first address of the server's public IPv6 /64
+// network, which Hetzner configures on the server, or nil if it has none
+func ServerIPv6(server *hcloud.Server) net.IP {
+	if server.PublicNet.IPv6.IsUnspecified() {
+		return nil
+	}
+	ip := slices.Clone(server.PublicNet.IPv6.IP.To16())
+	ip[len(ip)-1] |= 1
+	return ip
+}
+
+// EnsureServerLabels adds the given labels to a server, keeping its other labels
+func (c *Client) EnsureServerLabels(ctx context.Context, server *hcloud.Server, labels map[string]string) error {
+	merged := make(map[string]string, len(server.Labels)+len(labels))
+	changed := false
+	for k, v := range server.Labels {
+		merged[k] = v
+	}
+	for k, v := range labels {
+		if merged[k] != v {
+			merged[k] = v
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	updated, _, err := c.client.Server.Update(ctx, server, hcloud.ServerUpdateOpts{Labels: merged})
+	if err != nil {
+		return fmt.Errorf("failed to update server labels: %w", err)
+	}
+	server.Labels = updated.Labels
+	return nil
+}
+
+// RenameServer renames a server
+func (c *Client) RenameServer(ctx context.Context, server *hcloud.Server, name string) error {
+	updated, _, err := c.client.Server.Update(ctx, server, hcloud.ServerUpdateOpts{Name: name})
+	if err != nil {
+		return fmt.Errorf("failed to rename server %s: %w", server.Name, err)
+	}
+	server.Name = updated.Name
+	return nil
+}
+
 // GetServer retrieves a server by name
 func (c *Client) GetServer(ctx context.Context, name string) (*hcloud.Server, error) {
 	server, _, err := c.client.Server.GetByName(ctx, name)
@@ -81,6 +244,15 @@ func (c *Client) GetServer(ctx context.Context, name string) (*hcloud.Server, er
 	return server, nil
 }
 
+// GetServerByID retrieves a server by ID
+func (c *Client) GetServerByID(ctx context.Context, id int64) (*hcloud.Server, error) {
+	server, _, err := c.client.Server.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get server: %w", err)
+	}
+	return server, nil
+}
+
 // DeleteServer destroys a server
 func (c *Client) DeleteServer(ctx context.Context, name string) error {
 	server, err := c.GetServer(ctx, name)
@@ -112,6 +284,18 @@ func (c *Client) ListServers(ctx context.Context) ([]*hcloud.Server, error) {
 	return servers, nil
 }
 
+// ListServersBySelector returns the servers matching a label selector, sorted by name
+func (c *Client) ListServersBySelector(ctx context.Context, selector string) ([]*hcloud.Server, error) {
+	servers, err := c.client.Server.AllWithOpts(ctx, hcloud.ServerListOpts{
+		ListOpts: hcloud.ListOpts{LabelSelector: selector},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list servers: %w", err)
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].Name < servers[j].Name })
+	return servers, nil
+}
+
 // ListSSHKeys returns all SSH keys
 func (c *Client) ListSSHKeys(ctx context.Context) ([]*hcloud.SSHKey, error) {
 	keys, err := c.client.SSHKey.All(ctx)
@@ -122,10 +306,11 @@ func (c *Client) ListSSHKeys(ctx context.Context) ([]*hcloud.SSHKey, error) {
 }
 
 // CreateSSHKey creates a new SSH key
-func (c *Client) CreateSSHKey(ctx context.Context, name, publicKey string) (*hcloud.SSHKey, error) {
+func (c *Client) CreateSSHKey(ctx context.Context, name, publicKey string, labels map[string]string) (*hcloud.SSHKey, error) {
 	key, _, err := c.client.SSHKey.Create(ctx, hcloud.SSHKeyCreateOpts{
 		Name:      name,
 		PublicKey: publicKey,
+		Labels:    labels,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create SSH key: %w", err)
@@ -133,30 +318,65 @@ func (c *Client) CreateSSHKey(ctx context.Context, name, publicKey string) (*hcl
 	return key, nil
 }
 
-// waitForAction waits for a Hetzner action to complete
+// actionTimeout returns how long to wait for an action with the command
+func (c *Client) actionTimeout(command string) time.Duration {
+	if timeout, ok := c.actionTimeouts[command]; ok {
+		return timeout
+	}
+	if timeout, ok := c.actionTimeouts["default"]; ok {
+		return timeout
+	}
+	return DefaultActionTimeout
+}
+
+// waitForAction waits for a Hetzner action to complete, reporting its
+// progress, for at most the action's timeout
 func (c *Client) waitForAction(ctx context.Context, action *hcloud.Action) error {
-	if action == nil {
+	if action == nil || action.Status == hcloud.ActionStatusSuccess {
 		return nil
 	}
 
+	timeout := c.actionTimeout(action.Command)
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
 	ticker := time.NewTicker(2 * time.Second)
 	defer ticker.Stop()
 
+	progress := action.Progress
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
+		case <-deadline.C:
+			return fmt.Errorf("action %s (%d) did not finish within %s, it was at %d%%", action.Command, action.ID, timeout, progress)
 		case <-ticker.C:
 			a, _, err := c.client.Action.GetByID(ctx, action.ID)
 			if err != nil {
 				return err
 			}
-			if a.Status == hcloud.ActionStatusSuccess {
+			if a == nil {
+				return fmt.Errorf("action %s (%d) not found", action.Command, action.ID)
+			}
+			switch a.Status {
+			case hcloud.ActionStatusSuccess:
 				return nil
+			case hcloud.ActionStatusError:
+				return fmt.Errorf("action %s failed: %s", a.Command, a.ErrorMessage)
 			}
-			if a.Status == hcloud.ActionStatusError {
-				return fmt.Errorf("action failed: %s", a.ErrorMessage)
+			if a.Progress != progress {
+				progress = a.Progress
+				report.Info(c.reporter, "%s: %d%%", a.Command, progress)
 			}
 		}
 	}
 }
+
+// waitForActions waits for several Hetzner actions to complete
+func (c *Client) waitForActions(ctx context.Context, actions []*hcloud.Action) error {
+	for _, action := range actions {
+		if err := c.waitForAction(ctx, action); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package hetzner
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// NewDNSClient creates a client for DNS zones hosted by Hetzner, which are
+// managed through the Cloud API. A non-empty endpoint replaces the API URL,
+// e.g. with a local stand-in.
+func NewDNSClient(token, endpoint string, opts ...Option) *Client {
+	if endpoint != "" {
+		opts = append(opts, WithEndpoint(endpoint))
+	}
+	return NewClient(token, opts...)
+}
+
+// DNSRecord is the record set of one name and type in a zone
+type DNSRecord struct {
+	Name   string   `json:"name"` // relative to the zone, "@" for the apex
+	Type   string   `json:"type"` // A or AAAA
+	TTL    int      `json:"ttl,omitempty"`
+	Values []string `json:"values"`
+}
+
+// GetZone retrieves a DNS zone by name. It returns nil if the zone is not
+// hosted in the project.
+func (c *Client) GetZone(ctx context.Context, name string) (*hcloud.Zone, error) {
+	zone, _, err := c.client.Zone.GetByName(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get DNS zone %s: %w", name, err)
+	}
+	return zone, nil
+}
+
+// GetDNSRecord returns the record set of a name and type, or nil if there is none
+func (c *Client) GetDNSRecord(ctx context.Context, zone *hcloud.Zone, name, recordType string) (*DNSRecord, error) {
+	rrset, err := c.getRRSet(ctx, zone, name, recordType)
+	if err != nil || rrset == nil {
+		return nil, err
+	}
+	record := &DNSRecord{Name: name, Type: recordType, Values: rrsetValues(rrset)}
+	if rrset.TTL != nil {
+		record.TTL = *rrset.TTL
+	}
+	return record, nil
+}
+
+// EnsureDNSRecord sets the record set to the wanted values and TTL, creating
+// it if needed. Without values the record set is deleted if gotzer created it
+// and left alone otherwise.
+func (c *Client) EnsureDNSRecord(ctx context.Context, zone *hcloud.Zone, want DNSRecord, labels map[string]string) ([]string, error) {
+	what := fmt.Sprintf("%s record %s", want.Type, FQDN(want.Name, zone.Name))
+	rrset, err := c.getRRSet(ctx, zone, want.Name, want.Type)
+	if err != nil {
+		return nil, err
+	}
+	values := canonicalIPs(want.Values)
+
+	if rrset == nil {
+		if len(values) == 0 {
+			return nil, nil
+		}
+		result, _, err := c.client.Zone.CreateRRSet(ctx, zone, hcloud.ZoneRRSetCreateOpts{
+			Name:    want.Name,
+			Type:    hcloud.ZoneRRSetType(want.Type),
+			TTL:     hcloud.Ptr(want.TTL),
+			Labels:  labels,
+			Records: rrsetRecords(values),
+		})
+		if err := c.waitFor(ctx, result.Action, err, "create "+what); err != nil {
+			return nil, err
+		}
+		return []string{fmt.Sprintf("created %s → %s", what, strings.Join(values, ", "))}, nil
+	}
+
+	if len(values) == 0 {
+		if rrset.Labels["gotzer/managed"] != "true" {
+			return nil, nil
+		}
+		result, _, err := c.client.Zone.DeleteRRSet(ctx, rrset)
+		if err := c.waitFor(ctx, result.Action, err, "delete "+what); err != nil {
+			return nil, err
+		}
+		return []string{fmt.Sprintf("deleted %s", what)}, nil
+	}
+
+	var changes []string
+	if have := rrsetValues(rrset); !slices.Equal(have, values) {
+		action, _, err := c.client.Zone.SetRRSetRecords(ctx, rrset, hcloud.ZoneRRSetSetRecordsOpts{Records: rrsetRecords(values)})
+		if err := c.waitFor(ctx, action, err, "update "+what); err != nil {
+			return nil, err
+		}
+		changes = append(changes, fmt.Sprintf("updated %s: %s → %s", what, strings.Join(have, ", "), strings.Join(values, ", ")))
+	}
+	if rrset.TTL == nil || *rrset.TTL != want.TTL {
+		action, _, err := c.client.Zone.ChangeRRSetTTL(ctx, rrset, hcloud.ZoneRRSetChangeTTLOpts{TTL: hcloud.Ptr(want.TTL)})
+		if err := c.waitFor(ctx, action, err, "change TTL of "+what); err != nil {
+			return nil, err
+		}
+		changes = append(changes, fmt.Sprintf("changed TTL of %s to %ds", what, want.TTL))
+	}
+	return changes, nil
+}
+
+func (c *Client) getRRSet(ctx context.Context, zone *hcloud.Zone, name, recordType string) (*hcloud.ZoneRRSet, error) {
+	rrset, _, err := c.client.Zone.GetRRSetByNameAndType(ctx, zone, name, hcloud.ZoneRRSetType(recordType))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s record %s: %w", recordType, FQDN(name, zone.Name), err)
+	}
+	// Updates address the record set through its zone
+	if rrset != nil {
+		rrset.Zone = zone
+	}
+	return rrset, nil
+}
+
+// rrsetValues returns the record values of a record set, sorted
+func rrsetValues(rrset *hcloud.ZoneRRSet) []string {
+	values := make([]string, len(rrset.Records))
+	for i, r := range rrset.Records {
+		values[i] = r.Value
+	}
+	return canonicalIPs(values)
+}
+
+func rrsetRecords(values []string) []hcloud.ZoneRRSetRecord {
+	records := make([]hcloud.ZoneRRSetRecord, len(values))
+	for i, v := range values {
+		records[i] = hcloud.ZoneRRSetRecord{Value: v}
+	}
+	return records
+}
+
+// canonicalIPs formats addresses the same way and sorts them, so record sets
+// can be compared
+func canonicalIPs(values []string) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if ip := net.ParseIP(v); ip != nil {
+			v = ip.String()
+		}
+		if !slices.Contains(out, v) {
+			out = append(out, v)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// FQDN returns the full domain name of a record name relative to the zone
+func FQDN(name, zone string) string {
+	if name == "@" {
+		return zone
+	}
+	return name + "." + zone
+}
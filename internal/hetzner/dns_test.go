@@ -0,0 +1,268 @@
+package hetzner
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRRSet is a record set held by fakeZoneAPI
+type fakeRRSet struct {
+	TTL    int
+	Labels map[string]string
+	Values []string
+}
+
+// fakeZoneAPI serves the zone and record set endpoints of the Cloud API for
+// the zone example.com. Every action it returns has already succeeded.
+type fakeZoneAPI struct {
+	mu     sync.Mutex
+	rrsets map[string]*fakeRRSet // keyed by "<name>/<type>"
+	calls  []string              // "<method> <action>" of each change
+}
+
+func newFakeZoneAPI(t *testing.T) (*fakeZoneAPI, *Client) {
+	api := &fakeZoneAPI{rrsets: map[string]*fakeRRSet{}}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	return api, NewDNSClient("token", srv.URL)
+}
+
+func (f *fakeZoneAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// /zones/{zone}[/rrsets[/{name}/{type}[/actions/{action}]]]
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "zones" {
+		writeJSON(w, http.StatusNotFound, errorBody("not_found"))
+		return
+	}
+	if len(parts) == 2 {
+		writeJSON(w, http.StatusOK, map[string]any{"zone": map[string]any{
+			"id": 1, "name": "example.com", "mode": "primary", "ttl": 3600,
+			"created": "2026-01-01T00:00:00Z", "status": "ok",
+		}})
+		return
+	}
+
+	if len(parts) == 3 && r.Method == http.MethodPost {
+		var req struct {
+			Name    string            `json:"name"`
+			Type    string            `json:"type"`
+			TTL     int               `json:"ttl"`
+			Labels  map[string]string `json:"labels"`
+			Records []struct {
+				Value string `json:"value"`
+			} `json:"records"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorBody("invalid_input"))
+			return
+		}
+		rrset := &fakeRRSet{TTL: req.TTL, Labels: req.Labels}
+		for _, rec := range req.Records {
+			rrset.Values = append(rrset.Values, rec.Value)
+		}
+		key := req.Name + "/" + req.Type
+		f.rrsets[key] = rrset
+		f.calls = append(f.calls, "POST create")
+		writeJSON(w, http.StatusCreated, map[string]any{"rrset": rrsetBody(key, rrset), "action": actionBody("create_rrset")})
+		return
+	}
+	if len(parts) < 5 {
+		writeJSON(w, http.StatusNotFound, errorBody("not_found"))
+		return
+	}
+
+	key := parts[3] + "/" + parts[4]
+	rrset, ok := f.rrsets[key]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorBody("not_found"))
+		return
+	}
+	switch {
+	case len(parts) == 5 && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]any{"rrset": rrsetBody(key, rrset)})
+	case len(parts) == 5 && r.Method == http.MethodDelete:
+		delete(f.rrsets, key)
+		f.calls = append(f.calls, "DELETE delete")
+		writeJSON(w, http.StatusOK, map[string]any{"action": actionBody("delete_rrset")})
+	case len(parts) == 7 && parts[6] == "set_records":
+		var req struct {
+			Records []struct {
+				Value string `json:"value"`
+			} `json:"records"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorBody("invalid_input"))
+			return
+		}
+		rrset.Values = nil
+		for _, rec := range req.Records {
+			rrset.Values = append(rrset.Values, rec.Value)
+		}
+		f.calls = append(f.calls, "POST set_records")
+		writeJSON(w, http.StatusCreated, map[string]any{"action": actionBody("set_rrset_records")})
+	case len(parts) == 7 && parts[6] == "change_ttl":
+		var req struct {
+			TTL int `json:"ttl"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorBody("invalid_input"))
+			return
+		}
+		rrset.TTL = req.TTL
+		f.calls = append(f.calls, "POST change_ttl")
+		writeJSON(w, http.StatusCreated, map[string]any{"action": actionBody("change_rrset_ttl")})
+	default:
+		writeJSON(w, http.StatusNotFound, errorBody("not_found"))
+	}
+}
+
+// takeCalls returns the changes made since the last call
+func (f *fakeZoneAPI) takeCalls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	calls := f.calls
+	f.calls = nil
+	return calls
+}
+
+func rrsetBody(key string, rrset *fakeRRSet) map[string]any {
+	name, typ, _ := strings.Cut(key, "/")
+	records := make([]map[string]string, len(rrset.Values))
+	for i, v := range rrset.Values {
+		records[i] = map[string]string{"value": v}
+	}
+	return map[string]any{
+		"id": key, "name": name, "type": typ, "ttl": rrset.TTL,
+		"labels": rrset.Labels, "records": records, "zone": 1,
+	}
+}
+
+func actionBody(command string) map[string]any {
+	return map[string]any{
+		"id": 1, "command": command, "status": "success", "progress": 100,
+		"started": "2026-01-01T00:00:00Z", "finished": "2026-01-01T00:00:01Z",
+		"resources": []any{},
+	}
+}
+
+func errorBody(code string) map[string]any {
+	return map[string]any{"error": map[string]string{"code": code, "message": code}}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func TestEnsureDNSRecord(t *testing.T) {
+	ctx := context.Background()
+	api, c := newFakeZoneAPI(t)
+	zone, err := c.GetZone(ctx, "example.com")
+	if err != nil || zone == nil {
+		t.Fatalf("GetZone: %v, %v", zone, err)
+	}
+	managed := map[string]string{"gotzer/app": "shop", "gotzer/managed": "true"}
+
+	ensure := func(want DNSRecord) []string {
+		t.Helper()
+		changes, err := c.EnsureDNSRecord(ctx, zone, want, managed)
+		if err != nil {
+			t.Fatalf("EnsureDNSRecord(%+v): %v", want, err)
+		}
+		return changes
+	}
+	expectCalls := func(want ...string) {
+		t.Helper()
+		if got := api.takeCalls(); !slices.Equal(got, want) {
+			t.Fatalf("API changes = %q, want %q", got, want)
+		}
+	}
+
+	t.Run("create", func(t *testing.T) {
+		changes := ensure(DNSRecord{Name: "www", Type: "A", TTL: 300, Values: []string{"203.0.113.2", "203.0.113.1"}})
+		if len(changes) != 1 || !strings.Contains(changes[0], "created A record www.example.com") {
+			t.Errorf("changes = %q", changes)
+		}
+		expectCalls("POST create")
+		if got := api.rrsets["www/A"].Values; !slices.Equal(got, []string{"203.0.113.1", "203.0.113.2"}) {
+			t.Errorf("values = %q", got)
+		}
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		if changes := ensure(DNSRecord{Name: "www", Type: "A", TTL: 300, Values: []string{"203.0.113.1", "203.0.113.2"}}); len(changes) != 0 {
+			t.Errorf("changes = %q", changes)
+		}
+		expectCalls()
+	})
+
+	t.Run("update values", func(t *testing.T) {
+		changes := ensure(DNSRecord{Name: "www", Type: "A", TTL: 300, Values: []string{"203.0.113.3"}})
+		if len(changes) != 1 || !strings.Contains(changes[0], "203.0.113.1, 203.0.113.2 → 203.0.113.3") {
+			t.Errorf("changes = %q", changes)
+		}
+		expectCalls("POST set_records")
+		if got := api.rrsets["www/A"].Values; !slices.Equal(got, []string{"203.0.113.3"}) {
+			t.Errorf("values = %q", got)
+		}
+	})
+
+	t.Run("change TTL", func(t *testing.T) {
+		changes := ensure(DNSRecord{Name: "www", Type: "A", TTL: 60, Values: []string{"203.0.113.3"}})
+		if len(changes) != 1 || !strings.Contains(changes[0], "changed TTL of A record www.example.com to 60s") {
+			t.Errorf("changes = %q", changes)
+		}
+		expectCalls("POST change_ttl")
+		if got := api.rrsets["www/A"].TTL; got != 60 {
+			t.Errorf("TTL = %d", got)
+		}
+	})
+
+	t.Run("delete managed", func(t *testing.T) {
+		changes := ensure(DNSRecord{Name: "www", Type: "A", TTL: 60})
+		if len(changes) != 1 || !strings.Contains(changes[0], "deleted A record www.example.com") {
+			t.Errorf("changes = %q", changes)
+		}
+		expectCalls("DELETE delete")
+		if _, ok := api.rrsets["www/A"]; ok {
+			t.Error("record set still exists")
+		}
+	})
+
+	t.Run("keep unmanaged", func(t *testing.T) {
+		api.rrsets["@/AAAA"] = &fakeRRSet{TTL: 3600, Values: []string{"2001:db8::1"}}
+		if changes := ensure(DNSRecord{Name: "@", Type: "AAAA", TTL: 3600}); len(changes) != 0 {
+			t.Errorf("changes = %q", changes)
+		}
+		expectCalls()
+		if _, ok := api.rrsets["@/AAAA"]; !ok {
+			t.Error("record set not created by gotzer was deleted")
+		}
+	})
+
+	t.Run("nothing to delete", func(t *testing.T) {
+		if changes := ensure(DNSRecord{Name: "api", Type: "A", TTL: 300}); len(changes) != 0 {
+			t.Errorf("changes = %q", changes)
+		}
+		expectCalls()
+	})
+}
+
+func TestFQDN(t *testing.T) {
+	if got := FQDN("@", "example.com"); got != "example.com" {
+		t.Errorf("FQDN(@) = %q", got)
+	}
+	if got := FQDN("www", "example.com"); got != "www.example.com" {
+		t.Errorf("FQDN(www) = %q", got)
+	}
+}
@@ -0,0 +1,176 @@
+package hetzner
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// GetFirewall retrieves a Cloud Firewall by name
+func (c *Client) GetFirewall(ctx context.Context, name string) (*hcloud.Firewall, error) {
+	fw, _, err := c.client.Firewall.GetByName(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get firewall: %w", err)
+	}
+	return fw, nil
+}
+
+// EnsureFirewall creates the Cloud Firewall described by cfg or replaces the
+// rules of an existing one, and applies it to the servers. Servers it is
+// already applied to are left alone. It returns a description of every change.
+func (c *Client) EnsureFirewall(ctx context.Context, cfg *config.FirewallConfig, labels map[string]string, servers []*hcloud.Server) (*hcloud.Firewall, []string, error) {
+	rules, err := FirewallRules(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fw, err := c.GetFirewall(ctx, cfg.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fw == nil {
+		opts := hcloud.FirewallCreateOpts{Name: cfg.Name, Labels: labels, Rules: rules}
+		for _, server := range servers {
+			opts.ApplyTo = append(opts.ApplyTo, serverResource(server))
+		}
+		result, _, err := c.client.Firewall.Create(ctx, opts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create firewall: %w", err)
+		}
+		if err := c.waitForActions(ctx, result.Actions); err != nil {
+			return nil, nil, fmt.Errorf("failed waiting for firewall creation: %w", err)
+		}
+		changes := []string{fmt.Sprintf("created firewall %s with %d rules", cfg.Name, len(rules))}
+		for _, server := range servers {
+			changes = append(changes, fmt.Sprintf("applied to %s", server.Name))
+		}
+		fw, err = c.GetFirewall(ctx, cfg.Name)
+		return fw, changes, err
+	}
+
+	var changes []string
+	if RenderFirewallRules(fw.Rules) != RenderFirewallRules(rules) {
+		actions, _, err := c.client.Firewall.SetRules(ctx, fw, hcloud.FirewallSetRulesOpts{Rules: rules})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to set firewall rules: %w", err)
+		}
+		if err := c.waitForActions(ctx, actions); err != nil {
+			return nil, nil, fmt.Errorf("failed waiting for firewall rules: %w", err)
+		}
+		changes = append(changes, fmt.Sprintf("updated rules (%d)", len(rules)))
+	}
+
+	var apply []hcloud.FirewallResource
+	for _, server := range servers {
+		if !FirewallAppliedTo(fw, server.ID) {
+			apply = append(apply, serverResource(server))
+			changes = append(changes, fmt.Sprintf("applied to %s", server.Name))
+		}
+	}
+	if len(apply) > 0 {
+		actions, _, err := c.client.Firewall.ApplyResources(ctx, fw, apply)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to apply firewall: %w", err)
+		}
+		if err := c.waitForActions(ctx, actions); err != nil {
+			return nil, nil, fmt.Errorf("failed waiting for firewall to apply: %w", err)
+		}
+	}
+
+	fw, err = c.GetFirewall(ctx, cfg.Name)
+	return fw, changes, err
+}
+
+// DeleteFirewall deletes a Cloud Firewall. A missing firewall is not an error.
+func (c *Client) DeleteFirewall(ctx context.Context, name string) error {
+	fw, err := c.GetFirewall(ctx, name)
+	if err != nil || fw == nil {
+		return err
+	}
+	if _, err := c.client.Firewall.Delete(ctx, fw); err != nil {
+		return fmt.Errorf("failed to delete firewall: %w", err)
+	}
+	return nil
+}
+
+// FirewallAppliedTo reports whether the firewall is applied to the server,
+// directly or through a label selector
+func FirewallAppliedTo(fw *hcloud.Firewall, serverID int64) bool {
+	for _, res := range fw.AppliedTo {
+		switch res.Type {
+		case hcloud.FirewallResourceTypeServer:
+			if res.Server.ID == serverID {
+				return true
+			}
+		case hcloud.FirewallResourceTypeLabelSelector:
+			for _, applied := range res.AppliedToResources {
+				if applied.Server != nil && applied.Server.ID == serverID {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// FirewallRules converts the configured rules to inbound API rules
+func FirewallRules(cfg *config.FirewallConfig) ([]hcloud.FirewallRule, error) {
+	rules := make([]hcloud.FirewallRule, 0, len(cfg.Rules))
+	for _, r := range cfg.Rules {
+		rule := hcloud.FirewallRule{
+			Direction: hcloud.FirewallRuleDirectionIn,
+			Protocol:  hcloud.FirewallRuleProtocol(r.Protocol),
+		}
+		if r.Port != "" {
+			rule.Port = hcloud.Ptr(r.Port)
+		}
+		if r.Description != "" {
+			rule.Description = hcloud.Ptr(r.Description)
+		}
+		for _, src := range r.Sources {
+			_, ipNet, err := net.ParseCIDR(src)
+			if err != nil {
+				return nil, fmt.Errorf("invalid firewall source %q: %w", src, err)
+			}
+			rule.SourceIPs = append(rule.SourceIPs, *ipNet)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// RenderFirewallRules describes rules one per line, sorted, for comparing and diffing
+func RenderFirewallRules(rules []hcloud.FirewallRule) string {
+	lines := make([]string, 0, len(rules))
+	for _, r := range rules {
+		port := "-"
+		if r.Port != nil {
+			port = *r.Port
+		}
+		sources := make([]string, len(r.SourceIPs))
+		for i, src := range r.SourceIPs {
+			sources[i] = src.String()
+		}
+		sort.Strings(sources)
+		line := fmt.Sprintf("%s %s %s from %s", r.Direction, r.Protocol, port, strings.Join(sources, ", "))
+		if r.Description != nil && *r.Description != "" {
+			line += "  # " + *r.Description
+		}
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// serverResource returns the firewall resource for a server
+func serverResource(server *hcloud.Server) hcloud.FirewallResource {
+	return hcloud.FirewallResource{
+		Type:   hcloud.FirewallResourceTypeServer,
+		Server: &hcloud.FirewallResourceServer{ID: server.ID},
+	}
+}
@@ -0,0 +1,181 @@
+package hetzner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// GetFloatingIP retrieves a Floating IP by name
+func (c *Client) GetFloatingIP(ctx context.Context, name string) (*hcloud.FloatingIP, error) {
+	ip, _, err := c.client.FloatingIP.GetByName(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get floating IP: %w", err)
+	}
+	return ip, nil
+}
+
+// EnsureFloatingIP creates the named IPv4 Floating IP in the location, or
+// adopts an existing one with that name unless it is labelled for another app
+// or environment
+func (c *Client) EnsureFloatingIP(ctx context.Context, name, location string, labels map[string]string) (*hcloud.FloatingIP, []string, error) {
+	ip, err := c.GetFloatingIP(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ip != nil {
+		if err := checkOwner("floating IP "+name, ip.Labels, labels); err != nil {
+			return nil, nil, err
+		}
+		return ip, nil, nil
+	}
+	result, _, err := c.client.FloatingIP.Create(ctx, hcloud.FloatingIPCreateOpts{
+		Type:         hcloud.FloatingIPTypeIPv4,
+		HomeLocation: &hcloud.Location{Name: location},
+		Name:         hcloud.Ptr(name),
+		Labels:       labels,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create floating IP %s: %w", name, err)
+	}
+	if err := c.waitForAction(ctx, result.Action); err != nil {
+		return nil, nil, fmt.Errorf("failed waiting for floating IP %s: %w", name, err)
+	}
+	return result.FloatingIP, []string{fmt.Sprintf("created floating IP %s (%s)", name, result.FloatingIP.IP)}, nil
+}
+
+// AssignFloatingIP routes the Floating IP to the server, moving it away from
+// the server it is assigned to
+func (c *Client) AssignFloatingIP(ctx context.Context, ip *hcloud.FloatingIP, server *hcloud.Server) error {
+	if ip.Server != nil && ip.Server.ID == server.ID {
+		return nil
+	}
+	action, _, err := c.client.FloatingIP.Assign(ctx, ip, server)
+	if err := c.waitFor(ctx, action, err, fmt.Sprintf("assign floating IP %s to %s", ip.Name, server.Name)); err != nil {
+		return err
+	}
+	ip.Server = server
+	return nil
+}
+
+// GetPrimaryIP retrieves a Primary IP by name
+func (c *Client) GetPrimaryIP(ctx context.Context, name string) (*hcloud.PrimaryIP, error) {
+	ip, _, err := c.client.PrimaryIP.GetByName(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get primary IP: %w", err)
+	}
+	return ip, nil
+}
+
+// EnsurePrimaryIP creates the named IPv4 Primary IP in the location, or adopts
+// an existing one with that name unless it is labelled for another app or
+// environment. Auto delete is turned off so the address outlives the server it
+// is assigned to.
+func (c *Client) EnsurePrimaryIP(ctx context.Context, name, location string, labels map[string]string) (*hcloud.PrimaryIP, []string, error) {
+	ip, err := c.GetPrimaryIP(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ip == nil {
+		result, _, err := c.client.PrimaryIP.Create(ctx, hcloud.PrimaryIPCreateOpts{
+			Name:         name,
+			Type:         hcloud.PrimaryIPTypeIPv4,
+			AssigneeType: "server",
+			Location:     location,
+			AutoDelete:   hcloud.Ptr(false),
+			Labels:       labels,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create primary IP %s: %w", name, err)
+		}
+		if err := c.waitForAction(ctx, result.Action); err != nil {
+			return nil, nil, fmt.Errorf("failed waiting for primary IP %s: %w", name, err)
+		}
+		return result.PrimaryIP, []string{fmt.Sprintf("created primary IP %s (%s)", name, result.PrimaryIP.IP)}, nil
+	}
+
+	if err := checkOwner("primary IP "+name, ip.Labels, labels); err != nil {
+		return nil, nil, err
+	}
+	if ip.Type != hcloud.PrimaryIPTypeIPv4 {
+		return nil, nil, fmt.Errorf("primary IP %s is %s, expected ipv4", name, ip.Type)
+	}
+	if !ip.AutoDelete {
+		return ip, nil, nil
+	}
+	ip, _, err = c.client.PrimaryIP.Update(ctx, ip, hcloud.PrimaryIPUpdateOpts{AutoDelete: hcloud.Ptr(false)})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to update primary IP %s: %w", name, err)
+	}
+	return ip, []string{fmt.Sprintf("disabled auto delete of primary IP %s", name)}, nil
+}
+
+// checkOwner refuses to adopt a resource labelled for another app or
+// environment. Resources without a gotzer/app label were created by hand and
+// are accepted.
+func checkOwner(what string, have, want map[string]string) error {
+	app, ok := have["gotzer/app"]
+	if !ok {
+		return nil
+	}
+	if app != want["gotzer/app"] {
+		return fmt.Errorf("%s belongs to app %q, not %q", what, app, want["gotzer/app"])
+	}
+	if env := have["gotzer/env"]; env != want["gotzer/env"] {
+		if env == "" {
+			return fmt.Errorf("%s belongs to %s without an environment", what, app)
+		}
+		return fmt.Errorf("%s belongs to environment %q", what, env)
+	}
+	return nil
+}
+
+// UnassignPrimaryIP takes a Primary IP off its server, which must be off
+func (c *Client) UnassignPrimaryIP(ctx context.Context, ip *hcloud.PrimaryIP) error {
+	if ip.AssigneeID == 0 {
+		return nil
+	}
+	action, _, err := c.client.PrimaryIP.Unassign(ctx, ip.ID)
+	if err := c.waitFor(ctx, action, err, "unassign primary IP "+ip.Name); err != nil {
+		return err
+	}
+	ip.AssigneeID = 0
+	return nil
+}
+
+// AssignPrimaryIP makes the Primary IP the IPv4 address of a stopped server.
+// The server's previous IPv4 address is deleted if it was created with the
+// server, and kept if it has auto delete turned off.
+func (c *Client) AssignPrimaryIP(ctx context.Context, ip *hcloud.PrimaryIP, server *hcloud.Server) error {
+	if ip.AssigneeID == server.ID {
+		return nil
+	}
+	if id := server.PublicNet.IPv4.ID; id != 0 {
+		previous, _, err := c.client.PrimaryIP.GetByID(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to get primary IP: %w", err)
+		}
+		if previous != nil {
+			if err := c.UnassignPrimaryIP(ctx, previous); err != nil {
+				return err
+			}
+			if previous.AutoDelete {
+				if _, err := c.client.PrimaryIP.Delete(ctx, previous); err != nil {
+					return fmt.Errorf("failed to delete primary IP %s: %w", previous.IP, err)
+				}
+			}
+		}
+	}
+
+	action, _, err := c.client.PrimaryIP.Assign(ctx, hcloud.PrimaryIPAssignOpts{
+		ID:           ip.ID,
+		AssigneeID:   server.ID,
+		AssigneeType: "server",
+	})
+	if err := c.waitFor(ctx, action, err, fmt.Sprintf("assign primary IP %s to %s", ip.Name, server.Name)); err != nil {
+		return err
+	}
+	ip.AssigneeID = server.ID
+	return nil
+}
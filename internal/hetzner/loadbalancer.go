@@ -0,0 +1,454 @@
+package hetzner
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// GetLoadBalancer retrieves a Load Balancer by name
+func (c *Client) GetLoadBalancer(ctx context.Context, name string) (*hcloud.LoadBalancer, error) {
+	lb, _, err := c.client.LoadBalancer.GetByName(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get load balancer: %w", err)
+	}
+	return lb, nil
+}
+
+// EnsureLoadBalancer creates the Load Balancer described by cfg or brings an
+// existing one in line with it: type, algorithm, services, managed certificate
+// and targets. Targets are the given servers, or cfg.Selector if set. It
+// returns a description of every change made.
+func (c *Client) EnsureLoadBalancer(ctx context.Context, cfg *config.LoadBalancerConfig, labels map[string]string, servers []*hcloud.Server) (*hcloud.LoadBalancer, []string, error) {
+	var changes []string
+
+	var cert *hcloud.Certificate
+	if len(cfg.Domains) > 0 {
+		var created bool
+		var err error
+		cert, created, err = c.ensureCertificate(ctx, cfg, labels)
+		if err != nil {
+			return nil, nil, err
+		}
+		if created {
+			changes = append(changes, fmt.Sprintf("requested managed certificate for %s", strings.Join(cfg.Domains, ", ")))
+		}
+	}
+
+	lb, err := c.GetLoadBalancer(ctx, cfg.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if lb == nil {
+		lb, err = c.createLoadBalancer(ctx, cfg, labels, servers, cert)
+		if err != nil {
+			return nil, nil, err
+		}
+		changes = append(changes, fmt.Sprintf("created load balancer %s (%s in %s)", cfg.Name, cfg.Type, cfg.Location))
+		return lb, changes, c.deleteUnusedCertificates(ctx, cfg.Name, cert)
+	}
+
+	if lb.Location.Name != cfg.Location {
+		return nil, nil, fmt.Errorf("load balancer %s is in %s, not %s; delete it to move it", lb.Name, lb.Location.Name, cfg.Location)
+	}
+	if lb.LoadBalancerType.Name != cfg.Type {
+		action, _, err := c.client.LoadBalancer.ChangeType(ctx, lb, hcloud.LoadBalancerChangeTypeOpts{
+			LoadBalancerType: &hcloud.LoadBalancerType{Name: cfg.Type},
+		})
+		if err := c.waitFor(ctx, action, err, "change load balancer type"); err != nil {
+			return nil, nil, err
+		}
+		changes = append(changes, fmt.Sprintf("changed type %s → %s", lb.LoadBalancerType.Name, cfg.Type))
+	}
+	if string(lb.Algorithm.Type) != cfg.Algorithm {
+		action, _, err := c.client.LoadBalancer.ChangeAlgorithm(ctx, lb, hcloud.LoadBalancerChangeAlgorithmOpts{
+			Type: hcloud.LoadBalancerAlgorithmType(cfg.Algorithm),
+		})
+		if err := c.waitFor(ctx, action, err, "change load balancer algorithm"); err != nil {
+			return nil, nil, err
+		}
+		changes = append(changes, fmt.Sprintf("changed algorithm %s → %s", lb.Algorithm.Type, cfg.Algorithm))
+	}
+
+	serviceChanges, err := c.reconcileServices(ctx, lb, cfg, cert)
+	if err != nil {
+		return nil, nil, err
+	}
+	changes = append(changes, serviceChanges...)
+
+	targetChanges, err := c.reconcileTargets(ctx, lb, cfg, servers)
+	if err != nil {
+		return nil, nil, err
+	}
+	changes = append(changes, targetChanges...)
+
+	if err := c.deleteUnusedCertificates(ctx, cfg.Name, cert); err != nil {
+		return nil, nil, err
+	}
+
+	lb, err = c.GetLoadBalancer(ctx, cfg.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return lb, changes, nil
+}
+
+// DeleteLoadBalancer deletes a Load Balancer and the certificates gotzer
+// requested for it. A missing Load Balancer is not an error.
+func (c *Client) DeleteLoadBalancer(ctx context.Context, name string) error {
+	lb, err := c.GetLoadBalancer(ctx, name)
+	if err != nil {
+		return err
+	}
+	if lb != nil {
+		if _, err := c.client.LoadBalancer.Delete(ctx, lb); err != nil {
+			return fmt.Errorf("failed to delete load balancer: %w", err)
+		}
+	}
+	return c.deleteUnusedCertificates(ctx, name, nil)
+}
+
+// RemoveLoadBalancerTarget takes a server out of the Load Balancer's rotation
+func (c *Client) RemoveLoadBalancerTarget(ctx context.Context, lb *hcloud.LoadBalancer, server *hcloud.Server) error {
+	action, _, err := c.client.LoadBalancer.RemoveServerTarget(ctx, lb, server)
+	return c.waitFor(ctx, action, err, "remove load balancer target")
+}
+
+// AddLoadBalancerTarget puts a server (back) into the Load Balancer's rotation
+func (c *Client) AddLoadBalancerTarget(ctx context.Context, lb *hcloud.LoadBalancer, server *hcloud.Server) error {
+	action, _, err := c.client.LoadBalancer.AddServerTarget(ctx, lb, hcloud.LoadBalancerAddServerTargetOpts{Server: server})
+	return c.waitFor(ctx, action, err, "add load balancer target")
+}
+
+// WaitForTargetHealthy waits until the Load Balancer's health checks pass for
+// the server on every service
+func (c *Client) WaitForTargetHealthy(ctx context.Context, lb *hcloud.LoadBalancer, server *hcloud.Server, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("load balancer %s did not report %s healthy within %v", lb.Name, server.Name, timeout)
+		case <-ticker.C:
+			current, _, err := c.client.LoadBalancer.GetByID(ctx, lb.ID)
+			if err != nil {
+				return fmt.Errorf("failed to get load balancer: %w", err)
+			}
+			if current != nil && targetHealthy(current, server.ID) {
+				return nil
+			}
+		}
+	}
+}
+
+// HasServerTarget reports whether the server is one of the Load Balancer's
+// server targets
+func HasServerTarget(lb *hcloud.LoadBalancer, serverID int64) bool {
+	for _, t := range lb.Targets {
+		if t.Type == hcloud.LoadBalancerTargetTypeServer && t.Server.Server.ID == serverID {
+			return true
+		}
+	}
+	return false
+}
+
+// targetHealthy reports whether the server target is healthy on all services
+func targetHealthy(lb *hcloud.LoadBalancer, serverID int64) bool {
+	for _, t := range lb.Targets {
+		if t.Type != hcloud.LoadBalancerTargetTypeServer || t.Server.Server.ID != serverID {
+			continue
+		}
+		if len(t.HealthStatus) == 0 {
+			return false
+		}
+		for _, hs := range t.HealthStatus {
+			if hs.Status != hcloud.LoadBalancerTargetHealthStatusStatusHealthy {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// createLoadBalancer creates the Load Balancer with its services and targets
+func (c *Client) createLoadBalancer(ctx context.Context, cfg *config.LoadBalancerConfig, labels map[string]string, servers []*hcloud.Server, cert *hcloud.Certificate) (*hcloud.LoadBalancer, error) {
+	opts := hcloud.LoadBalancerCreateOpts{
+		Name:             cfg.Name,
+		LoadBalancerType: &hcloud.LoadBalancerType{Name: cfg.Type},
+		Algorithm:        &hcloud.LoadBalancerAlgorithm{Type: hcloud.LoadBalancerAlgorithmType(cfg.Algorithm)},
+		Location:         &hcloud.Location{Name: cfg.Location},
+		Labels:           labels,
+	}
+	for _, svc := range cfg.Services {
+		add := serviceOpts(svc, cert)
+		opts.Services = append(opts.Services, hcloud.LoadBalancerCreateOptsService{
+			Protocol:        add.Protocol,
+			ListenPort:      add.ListenPort,
+			DestinationPort: add.DestinationPort,
+			HTTP:            (*hcloud.LoadBalancerCreateOptsServiceHTTP)(add.HTTP),
+			HealthCheck: &hcloud.LoadBalancerCreateOptsServiceHealthCheck{
+				Protocol: add.HealthCheck.Protocol,
+				Port:     add.HealthCheck.Port,
+				Interval: add.HealthCheck.Interval,
+				Timeout:  add.HealthCheck.Timeout,
+				Retries:  add.HealthCheck.Retries,
+				HTTP:     (*hcloud.LoadBalancerCreateOptsServiceHealthCheckHTTP)(add.HealthCheck.HTTP),
+			},
+		})
+	}
+	if cfg.Selector != "" {
+		opts.Targets = append(opts.Targets, hcloud.LoadBalancerCreateOptsTarget{
+			Type:          hcloud.LoadBalancerTargetTypeLabelSelector,
+			LabelSelector: hcloud.LoadBalancerCreateOptsTargetLabelSelector{Selector: cfg.Selector},
+		})
+	} else {
+		for _, server := range servers {
+			opts.Targets = append(opts.Targets, hcloud.LoadBalancerCreateOptsTarget{
+				Type:   hcloud.LoadBalancerTargetTypeServer,
+				Server: hcloud.LoadBalancerCreateOptsTargetServer{Server: server},
+			})
+		}
+	}
+
+	result, _, err := c.client.LoadBalancer.Create(ctx, opts)
+	if err := c.waitFor(ctx, result.Action, err, "create load balancer"); err != nil {
+		return nil, err
+	}
+	return c.GetLoadBalancer(ctx, cfg.Name)
+}
+
+// reconcileServices adds, updates and deletes services by listen port
+func (c *Client) reconcileServices(ctx context.Context, lb *hcloud.LoadBalancer, cfg *config.LoadBalancerConfig, cert *hcloud.Certificate) ([]string, error) {
+	var changes []string
+	wanted := make(map[int]bool, len(cfg.Services))
+
+	for _, svc := range cfg.Services {
+		wanted[svc.ListenPort] = true
+
+		idx := slices.IndexFunc(lb.Services, func(s hcloud.LoadBalancerService) bool { return s.ListenPort == svc.ListenPort })
+		if idx < 0 {
+			action, _, err := c.client.LoadBalancer.AddService(ctx, lb, serviceOpts(svc, cert))
+			if err := c.waitFor(ctx, action, err, "add load balancer service"); err != nil {
+				return nil, err
+			}
+			changes = append(changes, fmt.Sprintf("added %s service on port %d", svc.Protocol, svc.ListenPort))
+			continue
+		}
+		if serviceMatches(lb.Services[idx], svc, cert) {
+			continue
+		}
+
+		add := serviceOpts(svc, cert)
+		action, _, err := c.client.LoadBalancer.UpdateService(ctx, lb, svc.ListenPort, hcloud.LoadBalancerUpdateServiceOpts{
+			Protocol:        add.Protocol,
+			DestinationPort: add.DestinationPort,
+			HTTP:            (*hcloud.LoadBalancerUpdateServiceOptsHTTP)(add.HTTP),
+			HealthCheck: &hcloud.LoadBalancerUpdateServiceOptsHealthCheck{
+				Protocol: add.HealthCheck.Protocol,
+				Port:     add.HealthCheck.Port,
+				Interval: add.HealthCheck.Interval,
+				Timeout:  add.HealthCheck.Timeout,
+				Retries:  add.HealthCheck.Retries,
+				HTTP:     (*hcloud.LoadBalancerUpdateServiceOptsHealthCheckHTTP)(add.HealthCheck.HTTP),
+			},
+		})
+		if err := c.waitFor(ctx, action, err, "update load balancer service"); err != nil {
+			return nil, err
+		}
+		changes = append(changes, fmt.Sprintf("updated %s service on port %d", svc.Protocol, svc.ListenPort))
+	}
+
+	for _, s := range lb.Services {
+		if wanted[s.ListenPort] {
+			continue
+		}
+		action, _, err := c.client.LoadBalancer.DeleteService(ctx, lb, s.ListenPort)
+		if err := c.waitFor(ctx, action, err, "delete load balancer service"); err != nil {
+			return nil, err
+		}
+		changes = append(changes, fmt.Sprintf("deleted %s service on port %d", s.Protocol, s.ListenPort))
+	}
+	return changes, nil
+}
+
+// reconcileTargets makes the server and label selector targets match the
+// configuration. IP targets are left alone.
+func (c *Client) reconcileTargets(ctx context.Context, lb *hcloud.LoadBalancer, cfg *config.LoadBalancerConfig, servers []*hcloud.Server) ([]string, error) {
+	var changes []string
+	wantedServers := make(map[int64]bool, len(servers))
+	if cfg.Selector == "" {
+		for _, server := range servers {
+			wantedServers[server.ID] = true
+			if HasServerTarget(lb, server.ID) {
+				continue
+			}
+			if err := c.AddLoadBalancerTarget(ctx, lb, server); err != nil {
+				return nil, err
+			}
+			changes = append(changes, fmt.Sprintf("added target %s", server.Name))
+		}
+	} else if !slices.ContainsFunc(lb.Targets, func(t hcloud.LoadBalancerTarget) bool {
+		return t.Type == hcloud.LoadBalancerTargetTypeLabelSelector && t.LabelSelector.Selector == cfg.Selector
+	}) {
+		action, _, err := c.client.LoadBalancer.AddLabelSelectorTarget(ctx, lb, hcloud.LoadBalancerAddLabelSelectorTargetOpts{Selector: cfg.Selector})
+		if err := c.waitFor(ctx, action, err, "add load balancer target"); err != nil {
+			return nil, err
+		}
+		changes = append(changes, fmt.Sprintf("added targets %s", cfg.Selector))
+	}
+
+	for _, t := range lb.Targets {
+		switch t.Type {
+		case hcloud.LoadBalancerTargetTypeServer:
+			if wantedServers[t.Server.Server.ID] {
+				continue
+			}
+			if err := c.RemoveLoadBalancerTarget(ctx, lb, t.Server.Server); err != nil {
+				return nil, err
+			}
+			changes = append(changes, fmt.Sprintf("removed target %s", t.Server.Server.Name))
+		case hcloud.LoadBalancerTargetTypeLabelSelector:
+			if t.LabelSelector.Selector == cfg.Selector {
+				continue
+			}
+			action, _, err := c.client.LoadBalancer.RemoveLabelSelectorTarget(ctx, lb, t.LabelSelector.Selector)
+			if err := c.waitFor(ctx, action, err, "remove load balancer target"); err != nil {
+				return nil, err
+			}
+			changes = append(changes, fmt.Sprintf("removed targets %s", t.LabelSelector.Selector))
+		}
+	}
+	return changes, nil
+}
+
+// ensureCertificate returns the managed certificate for the domains,
+// requesting it if needed. Its name is derived from the domains, so changing
+// them requests a new certificate.
+func (c *Client) ensureCertificate(ctx context.Context, cfg *config.LoadBalancerConfig, labels map[string]string) (*hcloud.Certificate, bool, error) {
+	domains := slices.Clone(cfg.Domains)
+	sort.Strings(domains)
+	sum := sha256.Sum256([]byte(strings.Join(domains, ",")))
+	name := fmt.Sprintf("%s-%x", cfg.Name, sum[:4])
+
+	cert, _, err := c.client.Certificate.GetByName(ctx, name)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get certificate: %w", err)
+	}
+	if cert != nil {
+		return cert, false, nil
+	}
+
+	certLabels := map[string]string{"gotzer/lb": cfg.Name}
+	for k, v := range labels {
+		certLabels[k] = v
+	}
+	// Issuance completes once the domains point at the load balancer, so the
+	// action is not waited for
+	result, _, err := c.client.Certificate.CreateCertificate(ctx, hcloud.CertificateCreateOpts{
+		Name:        name,
+		Type:        hcloud.CertificateTypeManaged,
+		DomainNames: domains,
+		Labels:      certLabels,
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create certificate: %w", err)
+	}
+	return result.Certificate, true, nil
+}
+
+// deleteUnusedCertificates deletes the load balancer's earlier certificates
+// that are no longer attached to anything
+func (c *Client) deleteUnusedCertificates(ctx context.Context, lbName string, keep *hcloud.Certificate) error {
+	certs, err := c.client.Certificate.AllWithOpts(ctx, hcloud.CertificateListOpts{
+		ListOpts: hcloud.ListOpts{LabelSelector: "gotzer/lb=" + lbName},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list certificates: %w", err)
+	}
+	for _, cert := range certs {
+		if (keep != nil && cert.ID == keep.ID) || len(cert.UsedBy) > 0 {
+			continue
+		}
+		if _, err := c.client.Certificate.Delete(ctx, cert); err != nil {
+			return fmt.Errorf("failed to delete certificate %s: %w", cert.Name, err)
+		}
+	}
+	return nil
+}
+
+// serviceOpts converts a configured service to the API's options
+func serviceOpts(svc config.LoadBalancerServiceConfig, cert *hcloud.Certificate) hcloud.LoadBalancerAddServiceOpts {
+	opts := hcloud.LoadBalancerAddServiceOpts{
+		Protocol:        hcloud.LoadBalancerServiceProtocol(svc.Protocol),
+		ListenPort:      hcloud.Ptr(svc.ListenPort),
+		DestinationPort: hcloud.Ptr(svc.DestinationPort),
+		HealthCheck: &hcloud.LoadBalancerAddServiceOptsHealthCheck{
+			Protocol: hcloud.LoadBalancerServiceProtocol(svc.HealthCheck.Protocol),
+			Port:     hcloud.Ptr(svc.HealthCheck.Port),
+			Interval: hcloud.Ptr(svc.HealthCheck.Interval),
+			Timeout:  hcloud.Ptr(svc.HealthCheck.Timeout),
+			Retries:  hcloud.Ptr(svc.HealthCheck.Retries),
+		},
+	}
+	if svc.Protocol != "tcp" {
+		opts.HTTP = &hcloud.LoadBalancerAddServiceOptsHTTP{StickySessions: hcloud.Ptr(svc.StickySessions)}
+		if svc.Protocol == "https" {
+			opts.HTTP.RedirectHTTP = hcloud.Ptr(svc.RedirectHTTP)
+			if cert != nil {
+				opts.HTTP.Certificates = []*hcloud.Certificate{cert}
+			}
+		}
+	}
+	if svc.HealthCheck.Protocol == "http" {
+		opts.HealthCheck.HTTP = &hcloud.LoadBalancerAddServiceOptsHealthCheckHTTP{Path: hcloud.Ptr(svc.HealthCheck.Path)}
+	}
+	return opts
+}
+
+// serviceMatches reports whether an existing service is configured as desired
+func serviceMatches(s hcloud.LoadBalancerService, svc config.LoadBalancerServiceConfig, cert *hcloud.Certificate) bool {
+	hc := s.HealthCheck
+	if string(s.Protocol) != svc.Protocol || s.DestinationPort != svc.DestinationPort ||
+		string(hc.Protocol) != svc.HealthCheck.Protocol || hc.Port != svc.HealthCheck.Port ||
+		hc.Interval != svc.HealthCheck.Interval || hc.Timeout != svc.HealthCheck.Timeout || hc.Retries != svc.HealthCheck.Retries {
+		return false
+	}
+	if svc.HealthCheck.Protocol == "http" && (hc.HTTP == nil || hc.HTTP.Path != svc.HealthCheck.Path) {
+		return false
+	}
+	if svc.Protocol != "tcp" && s.HTTP.StickySessions != svc.StickySessions {
+		return false
+	}
+	if svc.Protocol == "https" {
+		if s.HTTP.RedirectHTTP != svc.RedirectHTTP {
+			return false
+		}
+		if cert != nil && (len(s.HTTP.Certificates) != 1 || s.HTTP.Certificates[0].ID != cert.ID) {
+			return false
+		}
+	}
+	return true
+}
+
+// waitFor waits for the action of an API call that returned err
+func (c *Client) waitFor(ctx context.Context, action *hcloud.Action, err error, what string) error {
+	if err != nil {
+		return fmt.Errorf("failed to %s: %w", what, err)
+	}
+	if err := c.waitForAction(ctx, action); err != nil {
+		return fmt.Errorf("failed waiting to %s: %w", what, err)
+	}
+	return nil
+}
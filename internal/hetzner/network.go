@@ -0,0 +1,138 @@
+package hetzner
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// GetNetwork retrieves a private network by name
+func (c *Client) GetNetwork(ctx context.Context, name string) (*hcloud.Network, error) {
+	network, _, err := c.client.Network.GetByName(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network: %w", err)
+	}
+	return network, nil
+}
+
+// EnsureNetwork creates the private network described by cfg, adds its subnet
+// to an existing network and attaches the servers to it. The network's IP
+// range is never changed. It returns a description of every change.
+func (c *Client) EnsureNetwork(ctx context.Context, cfg *config.NetworkConfig, labels map[string]string, servers []*hcloud.Server) (*hcloud.Network, []string, error) {
+	_, ipRange, err := net.ParseCIDR(cfg.IPRange)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid network IP range %q: %w", cfg.IPRange, err)
+	}
+	_, subnetRange, err := net.ParseCIDR(cfg.Subnet)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid network subnet %q: %w", cfg.Subnet, err)
+	}
+	subnet := hcloud.NetworkSubnet{
+		Type:        hcloud.NetworkSubnetTypeCloud,
+		IPRange:     subnetRange,
+		NetworkZone: hcloud.NetworkZone(cfg.Zone),
+	}
+
+	network, err := c.GetNetwork(ctx, cfg.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var changes []string
+	if network == nil {
+		network, _, err = c.client.Network.Create(ctx, hcloud.NetworkCreateOpts{
+			Name:    cfg.Name,
+			IPRange: ipRange,
+			Subnets: []hcloud.NetworkSubnet{subnet},
+			Labels:  labels,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create network: %w", err)
+		}
+		changes = append(changes, fmt.Sprintf("created network %s (%s)", cfg.Name, cfg.IPRange))
+	} else {
+		if network.IPRange.String() != ipRange.String() {
+			return nil, nil, fmt.Errorf("network %s has IP range %s, not %s; IP ranges are not changed", cfg.Name, network.IPRange, cfg.IPRange)
+		}
+		if !hasSubnet(network, subnetRange) {
+			action, _, err := c.client.Network.AddSubnet(ctx, network, hcloud.NetworkAddSubnetOpts{Subnet: subnet})
+			if err := c.waitFor(ctx, action, err, "add subnet "+cfg.Subnet); err != nil {
+				return nil, nil, err
+			}
+			changes = append(changes, fmt.Sprintf("added subnet %s", cfg.Subnet))
+		}
+	}
+
+	for _, server := range servers {
+		if PrivateIP(server, network.ID) != "" {
+			continue
+		}
+		action, _, err := c.client.Server.AttachToNetwork(ctx, server, hcloud.ServerAttachToNetworkOpts{
+			Network: network,
+			IPRange: subnetRange,
+		})
+		if err := c.waitFor(ctx, action, err, fmt.Sprintf("attach %s to network %s", server.Name, cfg.Name)); err != nil {
+			return nil, nil, err
+		}
+		changes = append(changes, fmt.Sprintf("attached %s", server.Name))
+	}
+
+	network, err = c.GetNetwork(ctx, cfg.Name)
+	return network, changes, err
+}
+
+// DeleteNetwork deletes a private network unless servers are still attached
+// to it, e.g. those of another project sharing it. It reports whether the
+// network was deleted; a missing network is not an error.
+func (c *Client) DeleteNetwork(ctx context.Context, name string) (bool, error) {
+	network, err := c.GetNetwork(ctx, name)
+	if err != nil || network == nil {
+		return false, err
+	}
+	if len(network.Servers) > 0 {
+		return false, nil
+	}
+	if _, err := c.client.Network.Delete(ctx, network); err != nil {
+		return false, fmt.Errorf("failed to delete network: %w", err)
+	}
+	return true, nil
+}
+
+// PrivateIPs returns the private IPs of all servers attached to the network
+// by server name
+func (c *Client) PrivateIPs(ctx context.Context, network *hcloud.Network) (map[string]string, error) {
+	servers, err := c.ListServers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ips := make(map[string]string)
+	for _, server := range servers {
+		if ip := PrivateIP(server, network.ID); ip != "" {
+			ips[server.Name] = ip
+		}
+	}
+	return ips, nil
+}
+
+// PrivateIP returns the server's IP in the network, or "" if it is not attached
+func PrivateIP(server *hcloud.Server, networkID int64) string {
+	for _, pn := range server.PrivateNet {
+		if pn.Network != nil && pn.Network.ID == networkID {
+			return pn.IP.String()
+		}
+	}
+	return ""
+}
+
+// hasSubnet reports whether the network has a subnet with the given range
+func hasSubnet(network *hcloud.Network, ipRange *net.IPNet) bool {
+	for _, s := range network.Subnets {
+		if s.IPRange != nil && s.IPRange.String() == ipRange.String() {
+			return true
+		}
+	}
+	return false
+}
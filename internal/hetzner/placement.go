@@ -0,0 +1,58 @@
+package hetzner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// GetPlacementGroup retrieves a placement group by name
+func (c *Client) GetPlacementGroup(ctx context.Context, name string) (*hcloud.PlacementGroup, error) {
+	pg, _, err := c.client.PlacementGroup.GetByName(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get placement group: %w", err)
+	}
+	return pg, nil
+}
+
+// EnsurePlacementGroup creates the named spread placement group, or adopts an
+// existing one with that name
+func (c *Client) EnsurePlacementGroup(ctx context.Context, name string, labels map[string]string) (*hcloud.PlacementGroup, []string, error) {
+	pg, err := c.GetPlacementGroup(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pg != nil {
+		if pg.Type != hcloud.PlacementGroupTypeSpread {
+			return nil, nil, fmt.Errorf("placement group %s is %s, expected spread", name, pg.Type)
+		}
+		return pg, nil, nil
+	}
+
+	result, _, err := c.client.PlacementGroup.Create(ctx, hcloud.PlacementGroupCreateOpts{
+		Name:   name,
+		Labels: labels,
+		Type:   hcloud.PlacementGroupTypeSpread,
+	})
+	if err := c.waitFor(ctx, result.Action, err, "create placement group "+name); err != nil {
+		return nil, nil, err
+	}
+	return result.PlacementGroup, []string{fmt.Sprintf("created placement group %s", name)}, nil
+}
+
+// DeletePlacementGroup deletes the named placement group if no servers are in
+// it. It reports whether the group was deleted.
+func (c *Client) DeletePlacementGroup(ctx context.Context, name string) (bool, error) {
+	pg, err := c.GetPlacementGroup(ctx, name)
+	if err != nil || pg == nil {
+		return false, err
+	}
+	if len(pg.Servers) > 0 {
+		return false, nil
+	}
+	if _, err := c.client.PlacementGroup.Delete(ctx, pg); err != nil {
+		return false, fmt.Errorf("failed to delete placement group: %w", err)
+	}
+	return true, nil
+}
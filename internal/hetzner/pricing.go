@@ -0,0 +1,270 @@
+package hetzner
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// hoursPerMonth converts monthly prices without an hourly rate, as Hetzner does
+const hoursPerMonth = 730
+
+// Cost lists billed resources with their net prices, excluding VAT
+type Cost struct {
+	Currency string     `json:"currency"`
+	Items    []CostItem `json:"items"`
+	Hourly   float64    `json:"hourly"`
+	Monthly  float64    `json:"monthly"`
+	Notes    []string   `json:"notes,omitempty"` // what could not be priced
+}
+
+// CostItem is a single billed resource
+type CostItem struct {
+	Resource string  `json:"resource"`
+	Hourly   float64 `json:"hourly"`
+	Monthly  float64 `json:"monthly"`
+}
+
+func (c *Cost) add(resource string, hourly, monthly float64) {
+	c.Items = append(c.Items, CostItem{Resource: resource, Hourly: hourly, Monthly: monthly})
+	c.Hourly += hourly
+	c.Monthly += monthly
+}
+
+// Prices looks up the prices of the resources gotzer manages
+type Prices struct {
+	pricing hcloud.Pricing
+}
+
+// GetPrices fetches the current price list
+func (c *Client) GetPrices(ctx context.Context) (*Prices, error) {
+	pricing, _, err := c.client.Pricing.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pricing: %w", err)
+	}
+	return &Prices{pricing: pricing}, nil
+}
+
+// Server returns the hourly and monthly price of a server type in a location
+func (p *Prices) Server(serverType, location string) (float64, float64, error) {
+	for _, st := range p.pricing.ServerTypes {
+		if st.ServerType.Name != serverType {
+			continue
+		}
+		for _, lp := range st.Pricings {
+			if lp.Location.Name == location {
+				return parsePrice(lp.Hourly), parsePrice(lp.Monthly), nil
+			}
+		}
+		return 0, 0, fmt.Errorf("server type %s is not available in %s", serverType, location)
+	}
+	return 0, 0, fmt.Errorf("unknown server type %s", serverType)
+}
+
+// LoadBalancer returns the hourly and monthly price of a load balancer type in a location
+func (p *Prices) LoadBalancer(lbType, location string) (float64, float64, error) {
+	for _, lt := range p.pricing.LoadBalancerTypes {
+		if lt.LoadBalancerType.Name != lbType {
+			continue
+		}
+		for _, lp := range lt.Pricings {
+			if lp.Location.Name == location {
+				return parsePrice(lp.Hourly), parsePrice(lp.Monthly), nil
+			}
+		}
+		return 0, 0, fmt.Errorf("load balancer type %s is not available in %s", lbType, location)
+	}
+	return 0, 0, fmt.Errorf("unknown load balancer type %s", lbType)
+}
+
+// PrimaryIPv4 returns the hourly and monthly price of a server's public IPv4 address
+func (p *Prices) PrimaryIPv4(location string) (float64, float64) {
+	for _, ip := range p.pricing.PrimaryIPs {
+		if ip.Type != string(hcloud.PrimaryIPTypeIPv4) {
+			continue
+		}
+		for _, lp := range ip.Pricings {
+			if lp.Location == location {
+				return parseIPPrice(lp.Hourly), parseIPPrice(lp.Monthly)
+			}
+		}
+	}
+	return 0, 0
+}
+
+// FloatingIP returns the monthly price of a floating IP in a location
+func (p *Prices) FloatingIP(ipType hcloud.FloatingIPType, location string) float64 {
+	for _, ft := range p.pricing.FloatingIPs {
+		if ft.Type != ipType {
+			continue
+		}
+		for _, lp := range ft.Pricings {
+			if lp.Location.Name == location {
+				return parsePrice(lp.Monthly)
+			}
+		}
+	}
+	return 0
+}
+
+// Volume returns the monthly price of a volume of size GB
+func (p *Prices) Volume(size int) float64 {
+	return float64(size) * parsePrice(p.pricing.Volume.PerGBMonthly)
+}
+
+// Snapshot returns the monthly price of storing a snapshot of size GB
+func (p *Prices) Snapshot(size float64) float64 {
+	return size * parsePrice(p.pricing.Image.PerGBMonth)
+}
+
+// BackupShare returns backups' share of the server price, e.g. 0.2
+func (p *Prices) BackupShare() float64 {
+	pct, _ := strconv.ParseFloat(p.pricing.ServerBackup.Percentage, 64)
+	return pct / 100
+}
+
+// EstimateCost prices everything the config describes. Servers found through
+// server.selector are not created by gotzer and not included.
+func EstimateCost(cfg *config.Config, prices *Prices) (*Cost, error) {
+	cost := &Cost{Currency: prices.pricing.Currency}
+	location := cfg.Server.Location
+
+	names := cfg.Server.ServerNames()
+	if cfg.Server.Selector != "" {
+		cost.Notes = append(cost.Notes, fmt.Sprintf("servers matching %q are not included", cfg.Server.Selector))
+	}
+	for _, name := range names {
+		location := cfg.Server.ServerLocation(name)
+		hourly, monthly, err := prices.Server(cfg.Server.Type, location)
+		if err != nil {
+			return nil, err
+		}
+		cost.add(fmt.Sprintf("server %s (%s)", name, cfg.Server.Type), hourly, monthly)
+		if cfg.Server.BackupsEnabled() {
+			share := prices.BackupShare()
+			cost.add(fmt.Sprintf("backups %s", name), hourly*share, monthly*share)
+		}
+		if cfg.Server.IPv4Enabled() {
+			hourly, monthly = prices.PrimaryIPv4(location)
+			cost.add(fmt.Sprintf("IPv4 %s", name), hourly, monthly)
+		}
+		for _, v := range cfg.Server.Volumes {
+			monthly := prices.Volume(v.Size)
+			cost.add(fmt.Sprintf("volume %s (%d GB)", v.VolumeName(name), v.Size), monthly/hoursPerMonth, monthly)
+		}
+	}
+
+	if name := cfg.Server.FloatingIP; name != "" {
+		monthly := prices.FloatingIP(hcloud.FloatingIPTypeIPv4, location)
+		cost.add(fmt.Sprintf("floating IP %s", name), monthly/hoursPerMonth, monthly)
+	}
+
+	if lb := cfg.LoadBalancer; lb != nil {
+		hourly, monthly, err := prices.LoadBalancer(lb.Type, lb.Location)
+		if err != nil {
+			return nil, err
+		}
+		cost.add(fmt.Sprintf("load balancer %s (%s)", lb.Name, lb.Type), hourly, monthly)
+	}
+	return cost, nil
+}
+
+// RunningCost prices the resources matching a label selector as they run now
+func (c *Client) RunningCost(ctx context.Context, selector string, prices *Prices) (*Cost, error) {
+	cost := &Cost{Currency: prices.pricing.Currency}
+	opts := hcloud.ListOpts{LabelSelector: selector}
+
+	servers, err := c.ListServersBySelector(ctx, selector)
+	if err != nil {
+		return nil, err
+	}
+	for _, server := range servers {
+		location := server.Datacenter.Location.Name
+		hourly, monthly, err := prices.Server(server.ServerType.Name, location)
+		if err != nil {
+			cost.Notes = append(cost.Notes, fmt.Sprintf("server %s: %v", server.Name, err))
+			continue
+		}
+		cost.add(fmt.Sprintf("server %s (%s)", server.Name, server.ServerType.Name), hourly, monthly)
+		if server.BackupWindow != "" {
+			share := prices.BackupShare()
+			cost.add(fmt.Sprintf("backups %s", server.Name), hourly*share, monthly*share)
+		}
+		if !server.PublicNet.IPv4.IsUnspecified() {
+			hourly, monthly := prices.PrimaryIPv4(location)
+			cost.add(fmt.Sprintf("IPv4 %s", server.Name), hourly, monthly)
+		}
+	}
+
+	volumes, err := c.client.Volume.AllWithOpts(ctx, hcloud.VolumeListOpts{ListOpts: opts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
+	}
+	for _, v := range volumes {
+		monthly := prices.Volume(v.Size)
+		cost.add(fmt.Sprintf("volume %s (%d GB)", v.Name, v.Size), monthly/hoursPerMonth, monthly)
+	}
+
+	lbs, err := c.client.LoadBalancer.AllWithOpts(ctx, hcloud.LoadBalancerListOpts{ListOpts: opts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list load balancers: %w", err)
+	}
+	for _, lb := range lbs {
+		hourly, monthly, err := prices.LoadBalancer(lb.LoadBalancerType.Name, lb.Location.Name)
+		if err != nil {
+			cost.Notes = append(cost.Notes, fmt.Sprintf("load balancer %s: %v", lb.Name, err))
+			continue
+		}
+		cost.add(fmt.Sprintf("load balancer %s (%s)", lb.Name, lb.LoadBalancerType.Name), hourly, monthly)
+	}
+
+	ips, err := c.client.FloatingIP.AllWithOpts(ctx, hcloud.FloatingIPListOpts{ListOpts: opts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list floating IPs: %w", err)
+	}
+	for _, ip := range ips {
+		if ip.HomeLocation == nil {
+			continue
+		}
+		monthly := prices.FloatingIP(ip.Type, ip.HomeLocation.Name)
+		cost.add(fmt.Sprintf("floating IP %s", ip.IP), monthly/hoursPerMonth, monthly)
+	}
+
+	// Assigned primary IPs are priced with their server
+	primaryIPs, err := c.client.PrimaryIP.AllWithOpts(ctx, hcloud.PrimaryIPListOpts{ListOpts: opts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list primary IPs: %w", err)
+	}
+	for _, ip := range primaryIPs {
+		if ip.AssigneeID != 0 || ip.Type != hcloud.PrimaryIPTypeIPv4 || ip.Location == nil {
+			continue
+		}
+		hourly, monthly := prices.PrimaryIPv4(ip.Location.Name)
+		cost.add(fmt.Sprintf("primary IP %s (unassigned)", ip.IP), hourly, monthly)
+	}
+
+	images, err := c.ListSnapshots(ctx, selector)
+	if err != nil {
+		return nil, err
+	}
+	for _, image := range images {
+		monthly := prices.Snapshot(float64(image.ImageSize))
+		cost.add(fmt.Sprintf("snapshot %d (%.1f GB)", image.ID, image.ImageSize), monthly/hoursPerMonth, monthly)
+	}
+	return cost, nil
+}
+
+// parsePrice converts a net price string like "3.7900000000" to a number
+func parsePrice(p hcloud.Price) float64 {
+	v, _ := strconv.ParseFloat(p.Net, 64)
+	return v
+}
+
+// parseIPPrice converts a net primary IP price string to a number
+func parseIPPrice(p hcloud.PrimaryIPPrice) float64 {
+	v, _ := strconv.ParseFloat(p.Net, 64)
+	return v
+}
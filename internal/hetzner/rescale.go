@@ -0,0 +1,82 @@
+package hetzner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// CheckServerType checks that the server can be changed to the given type
+// before any downtime: the type must exist, have the server's architecture
+// and, as disks never shrink, a disk at least as large as the server's.
+func (c *Client) CheckServerType(ctx context.Context, server *hcloud.Server, serverType string) (*hcloud.ServerType, error) {
+	st, _, err := c.client.ServerType.GetByName(ctx, serverType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get server type: %w", err)
+	}
+	if st == nil {
+		return nil, fmt.Errorf("server type %s not found", serverType)
+	}
+	if st.Architecture != server.ServerType.Architecture {
+		return nil, fmt.Errorf("server type %s is %s but %s runs on %s; the architecture cannot be changed",
+			st.Name, st.Architecture, server.Name, server.ServerType.Architecture)
+	}
+	if st.Disk < server.PrimaryDiskSize {
+		return nil, fmt.Errorf("server type %s has a %d GB disk but %s has %d GB; a server whose disk was upgraded cannot be downgraded",
+			st.Name, st.Disk, server.Name, server.PrimaryDiskSize)
+	}
+	return st, nil
+}
+
+// ShutdownServer shuts the server down gracefully and waits until it is off.
+// A server still running after timeout is powered off.
+func (c *Client) ShutdownServer(ctx context.Context, server *hcloud.Server, timeout time.Duration) error {
+	if server.Status == hcloud.ServerStatusOff {
+		return nil
+	}
+	action, _, err := c.client.Server.Shutdown(ctx, server)
+	if err := c.waitFor(ctx, action, err, "shut down "+server.Name); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		s, _, err := c.client.Server.GetByID(ctx, server.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get server: %w", err)
+		}
+		if s == nil {
+			return fmt.Errorf("server %s no longer exists", server.Name)
+		}
+		if s.Status == hcloud.ServerStatusOff {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+
+	action, _, err = c.client.Server.Poweroff(ctx, server)
+	return c.waitFor(ctx, action, err, "power off "+server.Name)
+}
+
+// ChangeServerType changes the type of a stopped server. With upgradeDisk
+// the disk grows to the new type's size, which rules out going back to a
+// smaller type later.
+func (c *Client) ChangeServerType(ctx context.Context, server *hcloud.Server, serverType *hcloud.ServerType, upgradeDisk bool) error {
+	action, _, err := c.client.Server.ChangeType(ctx, server, hcloud.ServerChangeTypeOpts{
+		ServerType:  serverType,
+		UpgradeDisk: upgradeDisk,
+	})
+	return c.waitFor(ctx, action, err, fmt.Sprintf("change %s to %s", server.Name, serverType.Name))
+}
+
+// PowerOnServer starts a stopped server
+func (c *Client) PowerOnServer(ctx context.Context, server *hcloud.Server) error {
+	action, _, err := c.client.Server.Poweron(ctx, server)
+	return c.waitFor(ctx, action, err, "power on "+server.Name)
+}
@@ -0,0 +1,145 @@
+package hetzner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// Resource is a Hetzner resource labelled as belonging to a gotzer app
+type Resource struct {
+	App    string `json:"app"`
+	Env    string `json:"environment,omitempty"`
+	Kind   string `json:"kind"`
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// ListResources returns every resource matching the label selector, sorted
+// by app, environment and kind
+func (c *Client) ListResources(ctx context.Context, selector string) ([]Resource, error) {
+	opts := hcloud.ListOpts{LabelSelector: selector}
+	var out []Resource
+	add := func(kind string, id int64, name string, labels map[string]string, detail string) {
+		out = append(out, Resource{
+			App:    labels["gotzer/app"],
+			Env:    labels["gotzer/env"],
+			Kind:   kind,
+			ID:     id,
+			Name:   name,
+			Detail: detail,
+		})
+	}
+
+	servers, err := c.client.Server.AllWithOpts(ctx, hcloud.ServerListOpts{ListOpts: opts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list servers: %w", err)
+	}
+	for _, s := range servers {
+		ip := s.PublicNet.IPv4.IP
+		if s.PublicNet.IPv4.IsUnspecified() {
+			ip = ServerIPv6(s)
+		}
+		add("server", s.ID, s.Name, s.Labels, fmt.Sprintf("%s, %s, %s, %s", s.ServerType.Name, s.Datacenter.Location.Name, s.Status, ip))
+	}
+
+	volumes, err := c.client.Volume.AllWithOpts(ctx, hcloud.VolumeListOpts{ListOpts: opts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
+	}
+	for _, v := range volumes {
+		attached := "detached"
+		if v.Server != nil {
+			attached = "attached"
+		}
+		add("volume", v.ID, v.Name, v.Labels, fmt.Sprintf("%d GB, %s", v.Size, attached))
+	}
+
+	lbs, err := c.client.LoadBalancer.AllWithOpts(ctx, hcloud.LoadBalancerListOpts{ListOpts: opts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list load balancers: %w", err)
+	}
+	for _, lb := range lbs {
+		add("load_balancer", lb.ID, lb.Name, lb.Labels, fmt.Sprintf("%s, %s", lb.LoadBalancerType.Name, lb.PublicNet.IPv4.IP))
+	}
+
+	firewalls, err := c.client.Firewall.AllWithOpts(ctx, hcloud.FirewallListOpts{ListOpts: opts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list firewalls: %w", err)
+	}
+	for _, fw := range firewalls {
+		add("firewall", fw.ID, fw.Name, fw.Labels, fmt.Sprintf("%d rules", len(fw.Rules)))
+	}
+
+	networks, err := c.client.Network.AllWithOpts(ctx, hcloud.NetworkListOpts{ListOpts: opts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list networks: %w", err)
+	}
+	for _, n := range networks {
+		add("network", n.ID, n.Name, n.Labels, n.IPRange.String())
+	}
+
+	placementGroups, err := c.client.PlacementGroup.AllWithOpts(ctx, hcloud.PlacementGroupListOpts{ListOpts: opts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list placement groups: %w", err)
+	}
+	for _, pg := range placementGroups {
+		add("placement_group", pg.ID, pg.Name, pg.Labels, fmt.Sprintf("%s, %d servers", pg.Type, len(pg.Servers)))
+	}
+
+	ips, err := c.client.FloatingIP.AllWithOpts(ctx, hcloud.FloatingIPListOpts{ListOpts: opts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list floating IPs: %w", err)
+	}
+	for _, ip := range ips {
+		add("floating_ip", ip.ID, ip.Name, ip.Labels, ip.IP.String())
+	}
+
+	primaryIPs, err := c.client.PrimaryIP.AllWithOpts(ctx, hcloud.PrimaryIPListOpts{ListOpts: opts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list primary IPs: %w", err)
+	}
+	for _, ip := range primaryIPs {
+		assigned := "unassigned"
+		if ip.AssigneeID != 0 {
+			assigned = fmt.Sprintf("server %d", ip.AssigneeID)
+		}
+		add("primary_ip", ip.ID, ip.Name, ip.Labels, fmt.Sprintf("%s, %s", ip.IP, assigned))
+	}
+
+	images, err := c.ListSnapshots(ctx, selector)
+	if err != nil {
+		return nil, err
+	}
+	for _, image := range images {
+		add("snapshot", image.ID, strconv.FormatInt(image.ID, 10), image.Labels, fmt.Sprintf("%.1f GB, %s", image.ImageSize, image.Description))
+	}
+
+	keys, err := c.client.SSHKey.AllWithOpts(ctx, hcloud.SSHKeyListOpts{ListOpts: opts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list SSH keys: %w", err)
+	}
+	for _, key := range keys {
+		add("ssh_key", key.ID, key.Name, key.Labels, key.Fingerprint)
+	}
+
+	certs, err := c.client.Certificate.AllWithOpts(ctx, hcloud.CertificateListOpts{ListOpts: opts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list certificates: %w", err)
+	}
+	for _, cert := range certs {
+		add("certificate", cert.ID, cert.Name, cert.Labels, fmt.Sprintf("%v", cert.DomainNames))
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].App != out[j].App {
+			return out[i].App < out[j].App
+		}
+		return out[i].Env < out[j].Env
+	})
+	return out, nil
+}
@@ -0,0 +1,148 @@
+package hetzner
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy decides how often and how long failed API requests are retried.
+// Requests the API rejected without acting on them (rate limited, resource
+// locked or in conflict) are always retried; server errors and network
+// failures only for requests that can safely be repeated.
+type RetryPolicy struct {
+	MaxRetries int           // retries after the first attempt, 0 disables retries
+	BaseDelay  time.Duration // backoff before the first retry, doubled for each retry
+	MaxDelay   time.Duration // upper bound of a single backoff, also when rate limited
+}
+
+// DefaultRetryPolicy retries five times within about half a minute
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 5,
+	BaseDelay:  time.Second,
+	MaxDelay:   time.Minute,
+}
+
+// backoff returns the wait before retry number retries (0 for the first),
+// exponential with jitter and capped at MaxDelay
+func (p RetryPolicy) backoff(retries int) time.Duration {
+	d := p.BaseDelay << retries
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= p.BaseDelay {
+		return d
+	}
+	return p.BaseDelay + rand.N(d-p.BaseDelay)
+}
+
+// wait returns how long to wait before retrying a response. A rate-limited
+// request waits until RateLimit-Reset, when the limit is refilled.
+func (p RetryPolicy) wait(resp *http.Response, retries int) time.Duration {
+	d := p.backoff(retries)
+	if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		return d
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return d
+	}
+	if until := time.Until(time.Unix(reset, 0)); until > d {
+		d = until
+	}
+	return min(d, p.MaxDelay)
+}
+
+// retryable reports whether the request is worth sending again
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		return req.Context().Err() == nil && idempotent(req)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusLocked:
+		return true
+	case http.StatusConflict:
+		// Names that are taken are conflicts too, but retrying does not help
+		return errorCode(resp) == "conflict"
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent(req)
+	}
+	return false
+}
+
+// idempotent reports whether sending the request twice has the same effect as
+// sending it once. Actions and creations are POSTs and are not repeated after
+// the API may have acted on them.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// errorCode returns the code of an API error response, keeping the body
+// readable for the caller
+func errorCode(resp *http.Response) string {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+	var apiErr struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &apiErr) != nil {
+		return ""
+	}
+	return apiErr.Error.Code
+}
+
+// retryTransport sends API requests again according to the retry policy
+type retryTransport struct {
+	policy RetryPolicy
+	next   http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for retries := 0; ; retries++ {
+		attempt := req
+		if retries > 0 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attempt = req.Clone(req.Context())
+			attempt.Body = body
+		}
+
+		resp, err := t.next.RoundTrip(attempt)
+		if retries >= t.policy.MaxRetries || !retryable(req, resp, err) {
+			return resp, err
+		}
+		// Without GetBody the request cannot be sent again
+		if req.Body != nil && req.GetBody == nil {
+			return resp, err
+		}
+
+		wait := t.policy.wait(resp, retries)
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package hetzner
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testRetryPolicy retries twice with delays short enough for tests
+var testRetryPolicy = RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+func TestRetryTransportAttempts(t *testing.T) {
+	tests := []struct {
+		method   string
+		status   int
+		code     string // API error code in the response body
+		attempts int
+	}{
+		{http.MethodGet, http.StatusOK, "", 1},
+		{http.MethodGet, http.StatusNotFound, "not_found", 1},
+		{http.MethodGet, http.StatusTooManyRequests, "rate_limit_exceeded", 3},
+		{http.MethodGet, http.StatusServiceUnavailable, "", 3},
+		{http.MethodPut, http.StatusBadGateway, "", 3},
+		{http.MethodDelete, http.StatusInternalServerError, "", 3},
+		{http.MethodPost, http.StatusCreated, "", 1},
+		{http.MethodPost, http.StatusBadRequest, "invalid_input", 1},
+		{http.MethodPost, http.StatusTooManyRequests, "rate_limit_exceeded", 3},
+		{http.MethodPost, http.StatusLocked, "locked", 3},
+		{http.MethodPost, http.StatusConflict, "conflict", 3},
+		{http.MethodPost, http.StatusConflict, "uniqueness_error", 1},
+		{http.MethodPost, http.StatusInternalServerError, "", 1},
+		{http.MethodPost, http.StatusServiceUnavailable, "", 1},
+		{http.MethodPost, http.StatusGatewayTimeout, "", 1},
+	}
+	for _, tt := range tests {
+		name := tt.method + " " + strconv.Itoa(tt.status)
+		if tt.code != "" {
+			name += " " + tt.code
+		}
+		t.Run(name, func(t *testing.T) {
+			var attempts atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				if body, _ := io.ReadAll(r.Body); r.Method == http.MethodPost && string(body) != `{"name":"web"}` {
+					t.Errorf("attempt %d sent body %q", attempts.Load(), body)
+				}
+				if tt.code == "" {
+					w.WriteHeader(tt.status)
+					return
+				}
+				writeJSON(w, tt.status, errorBody(tt.code))
+			}))
+			defer srv.Close()
+
+			var body io.Reader
+			if tt.method == http.MethodPost {
+				body = strings.NewReader(`{"name":"web"}`)
+			}
+			req, err := http.NewRequest(tt.method, srv.URL+"/servers", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := &http.Client{Transport: &retryTransport{policy: testRetryPolicy, next: http.DefaultTransport}}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			// The caller still reads the API error after errorCode looked at it
+			if tt.code != "" && tt.status >= 400 {
+				if b, _ := io.ReadAll(resp.Body); !strings.Contains(string(b), tt.code) {
+					t.Errorf("body = %q, want the error code %s", b, tt.code)
+				}
+			}
+			if got := int(attempts.Load()); got != tt.attempts {
+				t.Errorf("attempts = %d, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+// roundTripFunc is a transport failing every request without a network
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestRetryTransportNetworkErrors(t *testing.T) {
+	for _, tt := range []struct {
+		method   string
+		attempts int
+	}{
+		{http.MethodGet, 3},
+		{http.MethodDelete, 3},
+		{http.MethodPost, 1},
+	} {
+		t.Run(tt.method, func(t *testing.T) {
+			attempts := 0
+			transport := &retryTransport{policy: testRetryPolicy, next: roundTripFunc(func(*http.Request) (*http.Response, error) {
+				attempts++
+				return nil, errors.New("connection reset by peer")
+			})}
+			req, err := http.NewRequest(tt.method, "http://api.invalid/servers", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := transport.RoundTrip(req); err == nil {
+				t.Error("expected the network error")
+			}
+			if attempts != tt.attempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyWait(t *testing.T) {
+	p := RetryPolicy{MaxRetries: 5, BaseDelay: time.Second, MaxDelay: time.Minute}
+	response := func(status int, reset string) *http.Response {
+		resp := &http.Response{StatusCode: status, Header: http.Header{}}
+		if reset != "" {
+			resp.Header.Set("RateLimit-Reset", reset)
+		}
+		return resp
+	}
+	in := func(d time.Duration) string {
+		return strconv.FormatInt(time.Now().Add(d).Unix(), 10)
+	}
+
+	tests := []struct {
+		name     string
+		resp     *http.Response
+		retries  int
+		min, max time.Duration
+	}{
+		{"first backoff", nil, 0, time.Second, time.Second},
+		{"backoff doubles", nil, 3, time.Second, 8 * time.Second},
+		{"backoff capped", nil, 20, time.Second, time.Minute},
+		{"until reset", response(http.StatusTooManyRequests, in(30*time.Second)), 0, 28 * time.Second, 30 * time.Second},
+		{"reset capped", response(http.StatusTooManyRequests, in(10*time.Minute)), 0, time.Minute, time.Minute},
+		{"reset passed", response(http.StatusTooManyRequests, in(-time.Minute)), 0, time.Second, time.Second},
+		{"reset missing", response(http.StatusTooManyRequests, ""), 0, time.Second, time.Second},
+		{"reset malformed", response(http.StatusTooManyRequests, "soon"), 0, time.Second, time.Second},
+		{"reset only for 429", response(http.StatusServiceUnavailable, in(30*time.Second)), 0, time.Second, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Backoff is jittered, so sample it a few times
+			for range 20 {
+				if got := p.wait(tt.resp, tt.retries); got < tt.min || got > tt.max {
+					t.Fatalf("wait = %s, want between %s and %s", got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package hetzner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// CreateSnapshot creates a snapshot image of the server's disk and waits for
+// it to finish. Attached volumes are not part of the snapshot.
+func (c *Client) CreateSnapshot(ctx context.Context, server *hcloud.Server, description string, labels map[string]string) (*hcloud.Image, error) {
+	result, _, err := c.client.Server.CreateImage(ctx, server, &hcloud.ServerCreateImageOpts{
+		Type:        hcloud.ImageTypeSnapshot,
+		Description: hcloud.Ptr(description),
+		Labels:      labels,
+	})
+	if err := c.waitFor(ctx, result.Action, err, "create snapshot of "+server.Name); err != nil {
+		return nil, err
+	}
+	return c.GetSnapshot(ctx, result.Image.ID)
+}
+
+// GetSnapshot retrieves a snapshot by ID. It returns nil if there is no
+// snapshot with that ID.
+func (c *Client) GetSnapshot(ctx context.Context, id int64) (*hcloud.Image, error) {
+	image, _, err := c.client.Image.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snapshot: %w", err)
+	}
+	if image == nil || image.Type != hcloud.ImageTypeSnapshot {
+		return nil, nil
+	}
+	return image, nil
+}
+
+// ListSnapshots returns the snapshots matching a label selector, newest first
+func (c *Client) ListSnapshots(ctx context.Context, selector string) ([]*hcloud.Image, error) {
+	images, err := c.client.Image.AllWithOpts(ctx, hcloud.ImageListOpts{
+		ListOpts: hcloud.ListOpts{LabelSelector: selector},
+		Type:     []hcloud.ImageType{hcloud.ImageTypeSnapshot},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].Created.After(images[j].Created) })
+	return images, nil
+}
+
+// DeleteSnapshot deletes a snapshot image
+func (c *Client) DeleteSnapshot(ctx context.Context, image *hcloud.Image) error {
+	if _, err := c.client.Image.Delete(ctx, image); err != nil {
+		return fmt.Errorf("failed to delete snapshot %d: %w", image.ID, err)
+	}
+	return nil
+}
+
+// EnableBackups turns on Hetzner's automatic daily backups for the server.
+// Servers that already have them are left alone.
+func (c *Client) EnableBackups(ctx context.Context, server *hcloud.Server) error {
+	if server.BackupWindow != "" {
+		return nil
+	}
+	action, _, err := c.client.Server.EnableBackup(ctx, server, "")
+	return c.waitFor(ctx, action, err, "enable backups for "+server.Name)
+}
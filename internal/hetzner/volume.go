@@ -0,0 +1,107 @@
+package hetzner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// GetVolume retrieves a volume by name
+func (c *Client) GetVolume(ctx context.Context, name string) (*hcloud.Volume, error) {
+	volume, _, err := c.client.Volume.GetByName(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get volume: %w", err)
+	}
+	return volume, nil
+}
+
+// EnsureVolume creates the named volume attached to the server, attaches an
+// existing detached one, or grows it to size GB. Volumes are never shrunk or
+// formatted here; the returned volume's LinuxDevice is what to format and mount.
+func (c *Client) EnsureVolume(ctx context.Context, name string, size int, server *hcloud.Server, labels map[string]string) (*hcloud.Volume, []string, error) {
+	volume, err := c.GetVolume(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if volume == nil {
+		result, _, err := c.client.Volume.Create(ctx, hcloud.VolumeCreateOpts{
+			Name:      name,
+			Size:      size,
+			Server:    server,
+			Labels:    labels,
+			Automount: hcloud.Ptr(false),
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create volume %s: %w", name, err)
+		}
+		if err := c.waitForActions(ctx, append([]*hcloud.Action{result.Action}, result.NextActions...)); err != nil {
+			return nil, nil, fmt.Errorf("failed waiting for volume %s: %w", name, err)
+		}
+		volume, err = c.GetVolume(ctx, name)
+		return volume, []string{fmt.Sprintf("created volume %s (%d GB)", name, size)}, err
+	}
+
+	var changes []string
+	switch {
+	case volume.Server == nil:
+		if volume.Location.Name != server.Datacenter.Location.Name {
+			return nil, nil, fmt.Errorf("volume %s is in %s but server %s is in %s", name, volume.Location.Name, server.Name, server.Datacenter.Location.Name)
+		}
+		action, _, err := c.client.Volume.AttachWithOpts(ctx, volume, hcloud.VolumeAttachOpts{Server: server, Automount: hcloud.Ptr(false)})
+		if err := c.waitFor(ctx, action, err, "attach volume "+name); err != nil {
+			return nil, nil, err
+		}
+		changes = append(changes, fmt.Sprintf("attached volume %s", name))
+	case volume.Server.ID != server.ID:
+		return nil, nil, fmt.Errorf("volume %s is attached to another server (ID %d)", name, volume.Server.ID)
+	}
+
+	if volume.Size < size {
+		action, _, err := c.client.Volume.Resize(ctx, volume, size)
+		if err := c.waitFor(ctx, action, err, "resize volume "+name); err != nil {
+			return nil, nil, err
+		}
+		changes = append(changes, fmt.Sprintf("resized volume %s %d → %d GB", name, volume.Size, size))
+	}
+
+	volume, err = c.GetVolume(ctx, name)
+	return volume, changes, err
+}
+
+// RenameVolume renames a volume. A missing volume is not an error.
+func (c *Client) RenameVolume(ctx context.Context, name, newName string) error {
+	volume, err := c.GetVolume(ctx, name)
+	if err != nil || volume == nil {
+		return err
+	}
+	if _, _, err := c.client.Volume.Update(ctx, volume, hcloud.VolumeUpdateOpts{Name: newName}); err != nil {
+		return fmt.Errorf("failed to rename volume %s: %w", name, err)
+	}
+	return nil
+}
+
+// DetachVolume detaches the named volume from its server, keeping its data.
+// A missing or detached volume is not an error.
+func (c *Client) DetachVolume(ctx context.Context, name string) error {
+	volume, err := c.GetVolume(ctx, name)
+	if err != nil || volume == nil || volume.Server == nil {
+		return err
+	}
+	action, _, err := c.client.Volume.Detach(ctx, volume)
+	return c.waitFor(ctx, action, err, "detach volume "+name)
+}
+
+// DeleteVolume deletes the named volume and its data. A missing volume is not
+// an error.
+func (c *Client) DeleteVolume(ctx context.Context, name string) error {
+	volume, err := c.GetVolume(ctx, name)
+	if err != nil || volume == nil {
+		return err
+	}
+	if _, err := c.client.Volume.Delete(ctx, volume); err != nil {
+		return fmt.Errorf("failed to delete volume %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/deploy"
+	"github.com/DawnKosmos/gotzer/internal/docker"
+	"github.com/DawnKosmos/gotzer/internal/provision"
+	"github.com/DawnKosmos/gotzer/internal/proxy"
+	"github.com/DawnKosmos/gotzer/internal/secrets"
+	"github.com/DawnKosmos/gotzer/internal/ssh"
+	"github.com/DawnKosmos/gotzer/internal/systemd"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// Scope selects which resources a plan compares
+type Scope int
+
+const (
+	// ScopeDeploy covers what `gotzer deploy` writes
+	ScopeDeploy Scope = 1 << iota
+	// ScopeProvision covers what `gotzer provision` writes
+	ScopeProvision
+
+	// ScopeAll covers everything gotzer manages
+	ScopeAll = ScopeDeploy | ScopeProvision
+)
+
+// Change is a single managed resource with its current and desired state
+type Change struct {
+	Name    string
+	Current string
+	Desired string
+}
+
+// Diff returns the unified diff of the change, or "" if nothing would change
+func (c Change) Diff() string {
+	return UnifiedDiff(c.Name+" (current)", c.Name+" (gotzer)", c.Current, c.Desired)
+}
+
+// Plan is the set of resources compared against the server
+type Plan struct {
+	Changes []Change
+}
+
+// HasChanges reports whether applying the plan would change anything
+func (p *Plan) HasChanges() bool {
+	for _, c := range p.Changes {
+		if c.Diff() != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Print writes a diff for every resource that would change
+func (p *Plan) Print(w io.Writer) {
+	pending := 0
+	for _, c := range p.Changes {
+		diff := c.Diff()
+		if diff == "" {
+			fmt.Fprintf(w, "  ✓ %s is up to date\n", c.Name)
+			continue
+		}
+		pending++
+		fmt.Fprintf(w, "\n  ~ %s\n%s\n", c.Name, diff)
+	}
+
+	if pending == 0 {
+		fmt.Fprintln(w, "\nNo changes. The server matches the configuration.")
+		return
+	}
+	fmt.Fprintf(w, "\n%d resource(s) would change.\n", pending)
+}
+
+// Compute compares the server against what gotzer would write. server may be
+// nil if it does not exist yet, in which case sc must be nil too and every
+// resource is shown as new.
+func Compute(ctx context.Context, cfg *config.Config, server *hcloud.Server, sc *ssh.Client, s *secrets.Secrets, scope Scope) (*Plan, error) {
+	p := &Plan{}
+
+	if scope&ScopeProvision != 0 {
+		p.Changes = append(p.Changes, Change{
+			Name:    "hetzner server " + cfg.Server.Name,
+			Current: renderServer(cfg, server),
+			Desired: renderServerConfig(cfg, server),
+		})
+	}
+
+	read := func(path string) (string, error) {
+		if sc == nil {
+			return "", nil
+		}
+		return sc.ReadFile(ctx, path)
+	}
+
+	if scope&ScopeProvision != 0 && provision.HasDockerServices(cfg) {
+		current, err := read(docker.ComposePath(cfg))
+		if err != nil {
+			return nil, err
+		}
+		p.Changes = append(p.Changes, Change{
+			Name:    docker.ComposePath(cfg),
+			Current: current,
+			Desired: docker.GenerateCompose(cfg),
+		})
+	}
+
+	if scope&ScopeProvision != 0 {
+		current := ""
+		if sc != nil {
+			output, err := sc.Run(ctx, "sudo ufw status 2>/dev/null || true")
+			if err != nil {
+				return nil, fmt.Errorf("failed to read UFW status: %w", err)
+			}
+			current = normalizeUFW(output)
+		}
+		p.Changes = append(p.Changes, Change{
+			Name:    "ufw rules",
+			Current: current,
+			Desired: renderUFW(cfg),
+		})
+	}
+
+	if cfg.Deploy.Type != "static" {
+		unitPath, unit := systemd.UnitPath(cfg), systemd.RenderUnit(cfg)
+		if cfg.Deploy.IsBlueGreen() {
+			unitPath, unit = systemd.TemplateUnitPath(cfg), systemd.RenderTemplateUnit(cfg)
+		}
+		current, err := read(unitPath)
+		if err != nil {
+			return nil, err
+		}
+		p.Changes = append(p.Changes, Change{Name: unitPath, Current: current, Desired: unit})
+
+		// Values are masked so secrets never end up in plan output
+		current, err = read(systemd.EnvFilePath(cfg))
+		if err != nil {
+			return nil, err
+		}
+		maskedCurrent, maskedDesired := maskEnvFiles(current, secrets.FormatEnvFile(systemd.AppEnv(cfg, s)))
+		p.Changes = append(p.Changes, Change{
+			Name:    systemd.EnvFilePath(cfg),
+			Current: maskedCurrent,
+			Desired: maskedDesired,
+		})
+	}
+
+	if proxy.Enabled(cfg) {
+		desired := proxy.Render(cfg)
+		if cfg.Deploy.IsBlueGreen() && sc != nil {
+			color, err := deploy.ActiveColor(ctx, sc, cfg)
+			if err != nil {
+				return nil, err
+			}
+			if color != "" {
+				desired = proxy.RenderCaddyfile(cfg, cfg.Deploy.ColorPort(color))
+			}
+		}
+		current, err := read(proxy.CaddyfilePath)
+		if err != nil {
+			return nil, err
+		}
+		p.Changes = append(p.Changes, Change{Name: proxy.CaddyfilePath, Current: current, Desired: desired})
+	}
+
+	return p, nil
+}
+
+// renderServer describes the live server's attributes gotzer manages
+func renderServer(cfg *config.Config, server *hcloud.Server) string {
+	if server == nil {
+		return ""
+	}
+	out := fmt.Sprintf("name: %s\ntype: %s\nlocation: %s\n",
+		server.Name, server.ServerType.Name, server.Datacenter.Location.Name)
+	if compareImage(server) {
+		out += fmt.Sprintf("image: %s\n", server.Image.Name)
+	}
+	// Provision only turns backups on, so they are only compared then
+	if cfg.Server.BackupsEnabled() {
+		out += fmt.Sprintf("backups: %t\n", server.BackupWindow != "")
+	}
+	return out
+}
+
+// renderServerConfig describes the configured server attributes, for the
+// live server or a new one if server is nil
+func renderServerConfig(cfg *config.Config, server *hcloud.Server) string {
+	out := fmt.Sprintf("name: %s\ntype: %s\nlocation: %s\n",
+		cfg.Server.Name, cfg.Server.Type, cfg.Server.Location)
+	if server == nil || compareImage(server) {
+		out += fmt.Sprintf("image: %s\n", cfg.Server.Image)
+	}
+	if cfg.Server.BackupsEnabled() {
+		out += "backups: true\n"
+	}
+	return out
+}
+
+// compareImage reports whether the server's image can be compared with
+// server.image. Servers built from a snapshot have no image name, and a
+// deprecated image may be gone; either way the image cannot change after the
+// server is created.
+func compareImage(server *hcloud.Server) bool {
+	return server.Image != nil && server.Image.Type == hcloud.ImageTypeSystem
+}
+
+// renderUFW returns the expected `ufw status` output in normalized form. UFW
+// lists the IPv4 rules first; rules open to anywhere appear in both lists.
+func renderUFW(cfg *config.Config) string {
+	lines := []string{"Status: active"}
+	rules := provision.FirewallRules(cfg)
+	for _, rule := range rules {
+		switch {
+		case rule.Source == "":
+			lines = append(lines, fmt.Sprintf("%s ALLOW Anywhere", rule.Port))
+		case !strings.Contains(rule.Source, ":"):
+			lines = append(lines, fmt.Sprintf("%s ALLOW %s", rule.Port, strings.Replace(rule.Source, "0.0.0.0/0", "Anywhere", 1)))
+		}
+	}
+	for _, rule := range rules {
+		switch {
+		case rule.Source == "":
+			lines = append(lines, fmt.Sprintf("%s (v6) ALLOW Anywhere (v6)", rule.Port))
+		case strings.Contains(rule.Source, ":"):
+			lines = append(lines, fmt.Sprintf("%s (v6) ALLOW %s", rule.Port, strings.Replace(rule.Source, "::/0", "Anywhere (v6)", 1)))
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// normalizeUFW collapses the column layout of `ufw status` and drops its headers
+func normalizeUFW(output string) string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] == "To" || fields[0] == "--" {
+			continue
+		}
+		lines = append(lines, strings.Join(fields, " "))
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// maskEnvFiles replaces the values of two env files with markers found by
+// comparing them locally, so the diff shows which keys change but nothing
+// about their values: <unchanged>, <previous> and <changed> for keys in both
+// files, <set> for keys in only one of them
+func maskEnvFiles(current, desired string) (string, string) {
+	currentVars, desiredVars := parseEnvFile(current), parseEnvFile(desired)
+	mask := func(vars, other map[string]string, keys []string, differs string) string {
+		var builder strings.Builder
+		for _, key := range keys {
+			marker := "<set>"
+			if otherValue, ok := other[key]; ok {
+				marker = "<unchanged>"
+				if otherValue != vars[key] {
+					marker = differs
+				}
+			}
+			builder.WriteString(fmt.Sprintf("%s=%s\n", key, marker))
+		}
+		return builder.String()
+	}
+	return mask(currentVars, desiredVars, envFileKeys(current), "<previous>"),
+		mask(desiredVars, currentVars, envFileKeys(desired), "<changed>")
+}
+
+// parseEnvFile returns the raw values of a KEY=value file by key
+func parseEnvFile(content string) map[string]string {
+	vars := map[string]string{}
+	for _, line := range strings.Split(content, "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			vars[key] = value
+		}
+	}
+	return vars
+}
+
+// envFileKeys returns the keys of a KEY=value file in file order
+func envFileKeys(content string) []string {
+	var keys []string
+	for _, line := range strings.Split(content, "\n") {
+		if key, _, ok := strings.Cut(line, "="); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,58 @@
+package plan
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+func testServer(image *hcloud.Image) *hcloud.Server {
+	return &hcloud.Server{
+		Name:       "shop",
+		ServerType: &hcloud.ServerType{Name: "cax11"},
+		Datacenter: &hcloud.Datacenter{Location: &hcloud.Location{Name: "nbg1"}},
+		Image:      image,
+	}
+}
+
+func TestServerImage(t *testing.T) {
+	cfg := &config.Config{Server: config.ServerConfig{Name: "shop", Type: "cax11", Location: "nbg1", Image: "ubuntu-24.04"}}
+
+	tests := []struct {
+		name    string
+		server  *hcloud.Server
+		changed bool
+	}{
+		{"same system image", testServer(&hcloud.Image{Type: hcloud.ImageTypeSystem, Name: "ubuntu-24.04"}), false},
+		{"other system image", testServer(&hcloud.Image{Type: hcloud.ImageTypeSystem, Name: "ubuntu-22.04"}), true},
+		{"from snapshot", testServer(&hcloud.Image{Type: hcloud.ImageTypeSnapshot, Description: "shop-2026-01-01"}), false},
+		{"deprecated image", testServer(nil), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Change{Name: "server", Current: renderServer(cfg, tt.server), Desired: renderServerConfig(cfg, tt.server)}
+			if diff := c.Diff(); (diff != "") != tt.changed {
+				t.Errorf("diff = %q, want changed=%t", diff, tt.changed)
+			}
+		})
+	}
+
+	if desired := renderServerConfig(cfg, nil); !strings.Contains(desired, "image: ubuntu-24.04\n") {
+		t.Errorf("new server is missing its image:\n%s", desired)
+	}
+}
+
+func TestMaskEnvFiles(t *testing.T) {
+	current := "API_KEY=\"old-secret\"\nPIN=\"1234\"\nREMOVED=\"x\"\n"
+	desired := "API_KEY=\"new-secret\"\nNEW=\"y\"\nPIN=\"1234\"\n"
+
+	gotCurrent, gotDesired := maskEnvFiles(current, desired)
+	if want := "API_KEY=<previous>\nPIN=<unchanged>\nREMOVED=<set>\n"; gotCurrent != want {
+		t.Errorf("current = %q, want %q", gotCurrent, want)
+	}
+	if want := "API_KEY=<changed>\nNEW=<set>\nPIN=<unchanged>\n"; gotDesired != want {
+		t.Errorf("desired = %q, want %q", gotDesired, want)
+	}
+}
@@ -0,0 +1,86 @@
+package provision
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/proxy"
+	"github.com/DawnKosmos/gotzer/internal/report"
+	"gopkg.in/yaml.v3"
+)
+
+// cloudConfig is the subset of cloud-init's #cloud-config format gotzer uses
+type cloudConfig struct {
+	PackageUpdate  bool     `yaml:"package_update"`
+	PackageUpgrade bool     `yaml:"package_upgrade"`
+	Packages       []string `yaml:"packages"`
+	Runcmd         []string `yaml:"runcmd"`
+}
+
+// UserData renders the cloud-init document that sets up a new server on its
+// first boot: system updates, Docker, the app user and directory, and UFW.
+// Secrets and app configuration are not part of it, as user data can be
+// read back from the Hetzner API; they are written over SSH afterwards.
+func UserData(cfg *config.Config) (string, error) {
+	cc := cloudConfig{
+		PackageUpdate:  true,
+		PackageUpgrade: true,
+		Packages:       []string{"libcap2-bin", "ufw"},
+	}
+	for _, v := range cfg.Server.Volumes {
+		if v.Filesystem == "xfs" {
+			cc.Packages = append(cc.Packages, "xfsprogs")
+			break
+		}
+	}
+	if proxy.Enabled(cfg) {
+		cc.Packages = append(cc.Packages, "caddy")
+	}
+
+	user := cfg.Deploy.User
+	cc.Runcmd = []string{
+		"curl -fsSL https://get.docker.com | sh",
+		"systemctl enable --now docker",
+		fmt.Sprintf("id -u %s >/dev/null 2>&1 || useradd -m -s /bin/bash %s", user, user),
+		fmt.Sprintf("usermod -aG docker %s", user),
+		fmt.Sprintf("mkdir -p %s", cfg.Deploy.RemotePath),
+		fmt.Sprintf("chown -R %s:%s %s", user, user, cfg.Deploy.RemotePath),
+		"sed -i 's/^IPV6=.*/IPV6=yes/' /etc/default/ufw",
+		"ufw default deny incoming",
+		"ufw default allow outgoing",
+	}
+	for _, rule := range FirewallRules(cfg) {
+		cc.Runcmd = append(cc.Runcmd, "ufw "+rule.Args())
+	}
+	cc.Runcmd = append(cc.Runcmd, "ufw --force enable")
+
+	out, err := yaml.Marshal(cc)
+	if err != nil {
+		return "", fmt.Errorf("failed to render cloud-init user data: %w", err)
+	}
+	return "#cloud-config\n" + string(out), nil
+}
+
+// waitForCloudInit streams the cloud-init output log until first-boot setup
+// has finished and fails if cloud-init reported an error
+func (p *Provisioner) waitForCloudInit(ctx context.Context) error {
+	// tail follows the log for as long as cloud-init status --wait runs
+	script := `sudo cloud-init status --wait >/dev/null 2>&1 &
+WAIT=$!
+sudo tail -n +1 -F --pid=$WAIT /var/log/cloud-init-output.log 2>/dev/null
+wait $WAIT`
+	err := p.SSHClient.RunStream(ctx, script, report.Writer(p.Reporter, report.SourceRemote))
+	if err == nil {
+		return nil
+	}
+
+	// Exit status 2 means cloud-init finished with recoverable errors
+	status, _ := p.SSHClient.Run(ctx, "sudo cloud-init status --long")
+	if strings.Contains(status, "status: done") || strings.Contains(status, "status: degraded done") {
+		report.Warn(p.Reporter, "cloud-init finished with warnings; see /var/log/cloud-init.log on the server")
+		return nil
+	}
+	return fmt.Errorf("cloud-init failed: %w\n%s", err, strings.TrimSpace(status))
+}
@@ -4,17 +4,94 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/DawnKosmos/gotzer/internal/config"
 	"github.com/DawnKosmos/gotzer/internal/docker"
+	"github.com/DawnKosmos/gotzer/internal/proxy"
+	"github.com/DawnKosmos/gotzer/internal/report"
+	"github.com/DawnKosmos/gotzer/internal/secrets"
 	"github.com/DawnKosmos/gotzer/internal/ssh"
 	"github.com/DawnKosmos/gotzer/internal/systemd"
 )
 
+// UFWRule opens a port, in the form shown by `ufw status` (e.g. "22/tcp"), to
+// a source CIDR, or to anywhere when Source is empty
+type UFWRule struct {
+	Port   string
+	Source string
+}
+
+// Args returns the `ufw` arguments that add the rule
+func (r UFWRule) Args() string {
+	if r.Source == "" {
+		return "allow " + r.Port
+	}
+	port, proto, _ := strings.Cut(r.Port, "/")
+	return fmt.Sprintf("allow from %s to any port %s proto %s", r.Source, port, proto)
+}
+
+// FirewallRules returns the rules added to UFW. The cloud firewall rules keep
+// their sources; SSH, HTTP(S) and the ports a load balancer forwards to are
+// open to anywhere unless a cloud firewall rule covers them.
+func FirewallRules(cfg *config.Config) []UFWRule {
+	var rules []UFWRule
+	add := func(rule UFWRule) {
+		if !slices.Contains(rules, rule) {
+			rules = append(rules, rule)
+		}
+	}
+	covered := map[string]bool{}
+	if fw := cfg.Firewall; fw != nil {
+		for _, r := range fw.Rules {
+			if r.Protocol == "icmp" {
+				continue
+			}
+			port := strings.Replace(r.Port, "-", ":", 1) + "/" + r.Protocol
+			covered[port] = true
+			if slices.Contains(r.Sources, "0.0.0.0/0") && slices.Contains(r.Sources, "::/0") {
+				add(UFWRule{Port: port})
+				continue
+			}
+			for _, src := range r.Sources {
+				add(UFWRule{Port: port, Source: src})
+			}
+		}
+	}
+
+	ports := []string{"22/tcp", "80/tcp", "443/tcp"}
+	if lb := cfg.LoadBalancer; lb != nil {
+		for _, svc := range lb.Services {
+			ports = append(ports, fmt.Sprintf("%d/tcp", svc.DestinationPort), fmt.Sprintf("%d/tcp", svc.HealthCheck.Port))
+		}
+	}
+	for _, port := range ports {
+		if !covered[port] {
+			add(UFWRule{Port: port})
+		}
+	}
+	return rules
+}
+
 // Provisioner handles server setup
 type Provisioner struct {
 	Config    *config.Config
 	SSHClient *ssh.Client
+	Secrets   *secrets.Secrets // decrypted secrets, may be nil
+	Reporter  report.Reporter
+
+	// Volumes maps server.volumes names to the Linux devices of the attached
+	// Hetzner volumes
+	Volumes map[string]string
+
+	// CloudInit is set for servers created with UserData. Setup then waits
+	// for cloud-init instead of installing the base system over SSH.
+	CloudInit bool
+
+	// FloatingIP is the address of server.floating_ip, configured on the
+	// host so the server accepts traffic routed to it
+	FloatingIP string
 }
 
 // NewProvisioner creates a new provisioner
@@ -22,98 +99,237 @@ func NewProvisioner(cfg *config.Config, sshClient *ssh.Client) *Provisioner {
 	return &Provisioner{
 		Config:    cfg,
 		SSHClient: sshClient,
+		Reporter:  report.Terminal(),
 	}
 }
 
 // Setup configures a new server
 func (p *Provisioner) Setup(ctx context.Context) error {
 	cfg := p.Config
+	r := p.Reporter
 
-	fmt.Println("\n🔧 Setting up server...")
+	report.Info(r, "Setting up server...")
 
 	// Step 0: Check free ports
 	if len(cfg.Server.FreePorts) > 0 {
 		p.checkFreePorts(ctx)
 	}
 
+	if p.CloudInit {
+		step := report.Start(r, "cloud_init", "☁️", "Waiting for cloud-init to set up the server...")
+		if err := p.waitForCloudInit(ctx); err != nil {
+			return step.Fail(err)
+		}
+		step.Done()
+	} else if err := p.setupBase(ctx); err != nil {
+		return err
+	}
+
+	if p.FloatingIP != "" {
+		step := report.Start(r, "floating_ip", "📌", fmt.Sprintf("Configuring floating IP %s...", p.FloatingIP))
+		if err := ConfigureFloatingIP(ctx, p.SSHClient, p.FloatingIP); err != nil {
+			return step.Fail(err)
+		}
+		step.Done()
+	}
+
+	// Mount volumes before services write to them
+	if len(cfg.Server.Volumes) > 0 {
+		step := report.Start(r, "volumes", "💽", "Mounting volumes...")
+		if err := p.mountVolumes(ctx); err != nil {
+			return step.Fail(fmt.Errorf("failed to mount volumes: %w", err))
+		}
+		step.Done()
+	}
+
+	// Create systemd service
+	step := report.Start(r, "systemd", "⚙️", "Creating systemd service...")
+	if err := p.createSystemdService(ctx); err != nil {
+		return step.Fail(fmt.Errorf("failed to create systemd service: %w", err))
+	}
+	step.Done()
+
+	// Setup Docker services
+	if p.hasDockerServices() {
+		step = report.Start(r, "docker_services", "🐳", "Setting up Docker services...")
+		if err := p.setupDockerServices(ctx); err != nil {
+			return step.Fail(fmt.Errorf("failed to setup Docker services: %w", err))
+		}
+		step.Done()
+	}
+
+	// Install the reverse proxy
+	if proxy.Enabled(cfg) {
+		step = report.Start(r, "proxy", "🔁", "Setting up Caddy reverse proxy...")
+		if err := proxy.Install(ctx, p.SSHClient); err != nil {
+			return step.Fail(err)
+		}
+		// Blue-green deploys write the Caddyfile once an instance is healthy
+		if !cfg.Deploy.IsBlueGreen() {
+			if err := proxy.Apply(ctx, p.SSHClient, proxy.Render(cfg)); err != nil {
+				return step.Fail(err)
+			}
+		}
+		step.Done()
+	}
+
+	// cloud-init enabled UFW on the first boot
+	if !p.CloudInit {
+		p.configureFirewall(ctx)
+	}
+
+	report.Success(r, "✅", "Server setup complete!")
+	return nil
+}
+
+// setupBase updates the system, installs Docker and creates the app user and
+// directory over SSH, for servers that were not set up by cloud-init
+func (p *Provisioner) setupBase(ctx context.Context) error {
+	cfg := p.Config
+	r := p.Reporter
+
 	// Step 1: Update system
-	fmt.Println("\n📦 Updating system packages...")
-	if _, err := p.SSHClient.Run(ctx, "sudo apt-get update && sudo DEBIAN_FRONTEND=noninteractive apt-get upgrade -y && sudo apt-get install -y libcap2-bin"); err != nil {
-		return fmt.Errorf("failed to update system: %w", err)
+	step := report.Start(r, "update_packages", "📦", "Updating system packages...")
+	if _, err := p.run(ctx, "sudo apt-get update && sudo DEBIAN_FRONTEND=noninteractive apt-get upgrade -y && sudo apt-get install -y libcap2-bin"); err != nil {
+		return step.Fail(fmt.Errorf("failed to update system: %w", err))
 	}
+	step.Done()
 
 	// Step 2: Install Docker
-	fmt.Println("\n🐳 Installing Docker...")
+	step = report.Start(r, "install_docker", "🐳", "Installing Docker...")
 	dockerScript := `
 curl -fsSL https://get.docker.com -o get-docker.sh && sudo sh get-docker.sh
 sudo systemctl enable docker
 sudo systemctl start docker
 `
-	if _, err := p.SSHClient.Run(ctx, dockerScript); err != nil {
-		return fmt.Errorf("failed to install Docker: %w", err)
+	if _, err := p.run(ctx, dockerScript); err != nil {
+		return step.Fail(fmt.Errorf("failed to install Docker: %w", err))
 	}
+	step.Done()
 
 	// Step 3: Create app user
-	fmt.Println("\n👤 Creating app user...")
+	step = report.Start(r, "create_user", "👤", "Creating app user...")
 	userScript := fmt.Sprintf(`
 sudo useradd -m -s /bin/bash %s 2>/dev/null || true
 sudo usermod -aG docker %s
 `, cfg.Deploy.User, cfg.Deploy.User)
-	if _, err := p.SSHClient.Run(ctx, userScript); err != nil {
-		return fmt.Errorf("failed to create user: %w", err)
+	if _, err := p.run(ctx, userScript); err != nil {
+		return step.Fail(fmt.Errorf("failed to create user: %w", err))
 	}
+	step.Done()
 
 	// Step 4: Create app directory
-	fmt.Println("\n📁 Creating application directory...")
+	step = report.Start(r, "create_directory", "📁", "Creating application directory...")
 	dirScript := fmt.Sprintf(`
 sudo mkdir -p %s
 sudo chown -R %s:%s %s
 `, cfg.Deploy.RemotePath, cfg.Deploy.User, cfg.Deploy.User, cfg.Deploy.RemotePath)
-	if _, err := p.SSHClient.Run(ctx, dirScript); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
+	if _, err := p.run(ctx, dirScript); err != nil {
+		return step.Fail(fmt.Errorf("failed to create directory: %w", err))
 	}
+	step.Done()
+	return nil
+}
 
-	// Step 5: Create systemd service
-	fmt.Println("\n⚙️ Creating systemd service...")
-	if err := p.createSystemdService(ctx); err != nil {
-		return fmt.Errorf("failed to create systemd service: %w", err)
+// configureFirewall enables UFW with exactly the rules of FirewallRules, so
+// rules dropped from the config are removed on the next provision
+func (p *Provisioner) configureFirewall(ctx context.Context) {
+	step := report.Start(p.Reporter, "firewall", "🔒", "Configuring firewall...")
+	var firewallScript strings.Builder
+	firewallScript.WriteString("sudo apt-get install -y ufw\n")
+	firewallScript.WriteString("sudo ufw --force reset >/dev/null\n")
+	firewallScript.WriteString("sudo sed -i 's/^IPV6=.*/IPV6=yes/' /etc/default/ufw\n")
+	firewallScript.WriteString("sudo ufw default deny incoming\n")
+	firewallScript.WriteString("sudo ufw default allow outgoing\n")
+	for _, rule := range FirewallRules(p.Config) {
+		firewallScript.WriteString(fmt.Sprintf("sudo ufw %s\n", rule.Args()))
 	}
-
-	// Step 6: Setup Docker services
-	if p.hasDockerServices() {
-		fmt.Println("\n🐳 Setting up Docker services...")
-		if err := p.setupDockerServices(ctx); err != nil {
-			return fmt.Errorf("failed to setup Docker services: %w", err)
-		}
+	firewallScript.WriteString("echo \"y\" | sudo ufw enable\n")
+	if _, err := p.run(ctx, firewallScript.String()); err != nil {
+		report.Warn(p.Reporter, "Firewall setup warning: %v", err)
 	}
+	step.Done()
+}
 
-	// Step 7: Configure firewall
-	fmt.Println("\n🔒 Configuring firewall...")
-	firewallScript := `
-sudo apt-get install -y ufw
-sudo ufw default deny incoming
-sudo ufw default allow outgoing
-sudo ufw allow ssh
-sudo ufw allow http
-sudo ufw allow https
-echo "y" | sudo ufw enable
-`
-	if _, err := p.SSHClient.Run(ctx, firewallScript); err != nil {
-		fmt.Printf("  ⚠ Firewall setup warning: %v\n", err)
+// ConfigureFloatingIP adds a Floating IP to the host's public interface with
+// netplan, so that it persists across reboots. Hetzner routes the address to
+// whichever server it is assigned to; configuring it on the others is harmless.
+func ConfigureFloatingIP(ctx context.Context, sc *ssh.Client, ip string) error {
+	script := fmt.Sprintf(`set -e
+command -v netplan >/dev/null || { echo "netplan is required to configure floating IPs" >&2; exit 1; }
+sudo tee /etc/netplan/60-gotzer-floating-ip.yaml >/dev/null <<'EOF'
+network:
+  version: 2
+  renderer: networkd
+  ethernets:
+    eth0:
+      addresses:
+        - %s/32
+EOF
+sudo chmod 600 /etc/netplan/60-gotzer-floating-ip.yaml
+sudo netplan apply
+`, ip)
+	if _, err := sc.Run(ctx, script); err != nil {
+		return fmt.Errorf("failed to configure floating IP %s: %w", ip, err)
 	}
+	return nil
+}
 
-	fmt.Println("\n✅ Server setup complete!")
+// run executes a setup script and reports its output
+func (p *Provisioner) run(ctx context.Context, cmd string) (string, error) {
+	output, err := p.SSHClient.Run(ctx, cmd)
+	report.Output(p.Reporter, report.SourceRemote, strings.TrimRight(output, "\n"))
+	return output, err
+}
+
+// mountVolumes formats each attached volume if it has no filesystem yet,
+// mounts it through /etc/fstab and grows the filesystem after a resize
+func (p *Provisioner) mountVolumes(ctx context.Context) error {
+	for _, v := range p.Config.Server.Volumes {
+		device, ok := p.Volumes[v.Name]
+		if !ok {
+			report.Warn(p.Reporter, "Volume %s is not attached; skipping", v.Name)
+			continue
+		}
+
+		mkfs := "sudo mkfs.ext4 -F -q \"$DEV\""
+		if v.Filesystem == "xfs" {
+			mkfs = "sudo apt-get install -y xfsprogs && sudo mkfs.xfs -q \"$DEV\""
+		}
+		script := fmt.Sprintf(`set -e
+DEV=%s
+MP=%s
+if ! sudo blkid "$DEV" >/dev/null 2>&1; then %s; fi
+FS=$(sudo blkid -o value -s TYPE "$DEV")
+sudo mkdir -p "$MP"
+grep -qs " $MP " /etc/fstab || echo "$DEV $MP $FS discard,nofail,defaults 0 2" | sudo tee -a /etc/fstab >/dev/null
+mountpoint -q "$MP" || sudo mount "$MP"
+if [ "$FS" = xfs ]; then sudo xfs_growfs "$MP" >/dev/null; else sudo resize2fs "$DEV" >/dev/null 2>&1; fi || true
+`, device, v.MountPoint, mkfs)
+		if _, err := p.run(ctx, script); err != nil {
+			return fmt.Errorf("volume %s: %w", v.Name, err)
+		}
+		report.Info(p.Reporter, "%s mounted at %s", v.Name, v.MountPoint)
+	}
 	return nil
 }
 
-// createSystemdService creates the systemd unit file
+// createSystemdService creates the environment and systemd unit files
 func (p *Provisioner) createSystemdService(ctx context.Context) error {
+	if err := systemd.WriteEnvFile(ctx, p.SSHClient, p.Config, p.Secrets); err != nil {
+		return err
+	}
 	return systemd.Configure(ctx, p.SSHClient, p.Config)
 }
 
 // hasDockerServices checks if any Docker services are enabled
 func (p *Provisioner) hasDockerServices() bool {
-	services := p.Config.Services
+	return HasDockerServices(p.Config)
+}
+
+// HasDockerServices checks if any Docker services are enabled in the config
+func HasDockerServices(cfg *config.Config) bool {
+	services := cfg.Services
 	if services.Postgres != nil && services.Postgres.Enabled {
 		return true
 	}
@@ -136,20 +352,25 @@ func (p *Provisioner) setupDockerServices(ctx context.Context) error {
 	}
 
 	// Create services directory
-	servicesDir := fmt.Sprintf("%s/services", cfg.Deploy.RemotePath)
+	servicesDir := docker.ServicesDir(cfg)
 	if _, err := p.SSHClient.Run(ctx, fmt.Sprintf("sudo mkdir -p %s", servicesDir)); err != nil {
 		return fmt.Errorf("failed to create services directory: %w", err)
 	}
 
 	// Write docker-compose.yml
-	composePath := fmt.Sprintf("%s/docker-compose.yml", servicesDir)
+	composePath := docker.ComposePath(cfg)
 	cmd := fmt.Sprintf(`echo '%s' | sudo tee %s > /dev/null`, composeContent, composePath)
 	if _, err := p.SSHClient.Run(ctx, cmd); err != nil {
 		return fmt.Errorf("failed to write docker-compose.yml: %w", err)
 	}
 
+	// Write root-only env files with service secrets
+	if _, err := docker.WriteEnvFiles(ctx, p.SSHClient, cfg, p.Secrets); err != nil {
+		return err
+	}
+
 	// Start services
-	if _, err := p.SSHClient.Run(ctx, fmt.Sprintf("cd %s && sudo docker compose up -d", servicesDir)); err != nil {
+	if _, err := p.run(ctx, fmt.Sprintf("cd %s && sudo docker compose up -d", servicesDir)); err != nil {
 		return fmt.Errorf("failed to start Docker services: %w", err)
 	}
 
@@ -157,17 +378,19 @@ func (p *Provisioner) setupDockerServices(ctx context.Context) error {
 }
 
 func (p *Provisioner) checkFreePorts(ctx context.Context) {
-	fmt.Println("\n🔍 Checking free ports...")
+	step := report.Start(p.Reporter, "check_ports", "🔍", "Checking free ports...")
+	defer step.Done()
+
 	out, err := p.SSHClient.Run(ctx, "ss -tuln")
 	if err != nil {
-		fmt.Printf("  ⚠ Could not check free ports: %v\n", err)
+		report.Warn(p.Reporter, "Could not check free ports: %v", err)
 		return
 	}
 
 	for _, port := range p.Config.Server.FreePorts {
 		re := regexp.MustCompile(fmt.Sprintf(":%d(\\s|$)", port))
 		if re.MatchString(out) {
-			fmt.Printf("  ⚠ Warning: Port %d is already in use!\n", port)
+			report.Warn(p.Reporter, "Port %d is already in use!", port)
 		}
 	}
 }
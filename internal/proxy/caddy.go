@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/ssh"
+)
+
+// CaddyfilePath is where the rendered Caddy configuration is installed
+const CaddyfilePath = "/etc/caddy/Caddyfile"
+
+// Install installs Caddy from the distribution packages and enables it
+func Install(ctx context.Context, sc *ssh.Client) error {
+	script := `
+sudo DEBIAN_FRONTEND=noninteractive apt-get install -y caddy
+sudo systemctl enable caddy
+sudo systemctl start caddy
+`
+	if _, err := sc.Run(ctx, script); err != nil {
+		return fmt.Errorf("failed to install Caddy: %w", err)
+	}
+	return nil
+}
+
+// Enabled reports whether gotzer manages a Caddy proxy for this config
+func Enabled(cfg *config.Config) bool {
+	return cfg.Proxy != nil || cfg.Deploy.IsBlueGreen()
+}
+
+// Render returns the Caddyfile for restart and static deploys. Blue-green
+// deploys render with the port of the active instance instead.
+func Render(cfg *config.Config) string {
+	port := 0
+	if cfg.Proxy != nil {
+		port = cfg.Proxy.UpstreamPort
+	}
+	return RenderCaddyfile(cfg, port)
+}
+
+// RenderCaddyfile returns the Caddy configuration proxying to the app on
+// upstreamPort, or serving the current release for static deploys
+func RenderCaddyfile(cfg *config.Config, upstreamPort int) string {
+	var builder strings.Builder
+	p := cfg.Proxy
+	if p == nil {
+		p = &config.ProxyConfig{}
+	}
+
+	builder.WriteString("# Managed by gotzer. Changes will be overwritten.\n")
+
+	if p.Email != "" {
+		builder.WriteString(fmt.Sprintf("{\n\temail %s\n}\n", p.Email))
+	}
+
+	// Whole-host redirects get their own site blocks
+	var pathRedirects []config.RedirectConfig
+	for _, r := range p.Redirects {
+		if strings.HasPrefix(r.From, "/") {
+			pathRedirects = append(pathRedirects, r)
+			continue
+		}
+		builder.WriteString(fmt.Sprintf("\n%s {\n\tredir %s{uri} %d\n}\n", r.From, strings.TrimSuffix(r.To, "/"), r.Code))
+	}
+
+	builder.WriteString(fmt.Sprintf("\n%s {\n", siteAddress(cfg)))
+
+	if len(p.Headers) > 0 {
+		names := make([]string, 0, len(p.Headers))
+		for name := range p.Headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		builder.WriteString("\theader {\n")
+		for _, name := range names {
+			builder.WriteString(fmt.Sprintf("\t\t%s %s\n", name, strconv.Quote(p.Headers[name])))
+		}
+		builder.WriteString("\t}\n")
+	}
+
+	for _, r := range pathRedirects {
+		builder.WriteString(fmt.Sprintf("\tredir %s %s %d\n", r.From, r.To, r.Code))
+	}
+
+	builder.WriteString("\tencode zstd gzip\n")
+
+	if cfg.Deploy.Type == "static" {
+		// Unknown paths fall back to index.html so client-side routing works
+		builder.WriteString(fmt.Sprintf("\troot * %s\n", p.Root))
+		builder.WriteString("\ttry_files {path} /index.html\n")
+		builder.WriteString("\tfile_server\n")
+	} else {
+		builder.WriteString(fmt.Sprintf("\treverse_proxy 127.0.0.1:%d\n", upstreamPort))
+	}
+
+	builder.WriteString("}\n")
+
+	return builder.String()
+}
+
+// siteAddress returns the Caddy site address: the configured domains, or a
+// plain HTTP listener when there are none
+func siteAddress(cfg *config.Config) string {
+	if cfg.Proxy != nil && len(cfg.Proxy.Domains) > 0 {
+		return strings.Join(cfg.Proxy.Domains, ", ")
+	}
+	if cfg.Deploy.IsBlueGreen() {
+		return cfg.Deploy.BlueGreen.Listen
+	}
+	return ":80"
+}
+
+// Apply validates and installs the Caddyfile, then reloads Caddy without dropping connections
+func Apply(ctx context.Context, sc *ssh.Client, content string) error {
+	// Sent over stdin, since header values may contain quotes
+	tmpPath := CaddyfilePath + ".gotzer"
+	if err := sc.WriteFile(ctx, tmpPath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write Caddyfile: %w", err)
+	}
+
+	if _, err := sc.Run(ctx, fmt.Sprintf("sudo caddy validate --adapter caddyfile --config %s", tmpPath)); err != nil {
+		return fmt.Errorf("invalid Caddyfile: %w", err)
+	}
+
+	if _, err := sc.Run(ctx, fmt.Sprintf("sudo mv %s %s && sudo systemctl reload caddy", tmpPath, CaddyfilePath)); err != nil {
+		return fmt.Errorf("failed to reload Caddy: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Human renders events as the emoji-prefixed text gotzer prints by default
+type Human struct {
+	mu      sync.Mutex
+	out     io.Writer
+	err     io.Writer
+	verbose bool
+	inStep  map[string]bool // per server
+}
+
+// NewHuman creates a human renderer. Remote command output is only shown when verbose.
+func NewHuman(out, err io.Writer, verbose bool) *Human {
+	return &Human{out: out, err: err, verbose: verbose, inStep: map[string]bool{}}
+}
+
+// Report renders a single event
+func (h *Human) Report(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Details inside a step are indented under its heading; events of
+	// concurrent deploys are prefixed with their server
+	indent := ""
+	if h.inStep[e.Server] {
+		indent = "  "
+	}
+	prefix := ""
+	if e.Server != "" {
+		prefix = "[" + e.Server + "] "
+	}
+
+	switch e.Kind {
+	case KindStepStarted:
+		h.inStep[e.Server] = true
+		fmt.Fprintf(h.out, "\n%s%s %s\n", prefix, e.Icon, e.Message)
+	case KindStepFinished:
+		h.inStep[e.Server] = false
+		if h.verbose {
+			fmt.Fprintf(h.out, "%s  → done in %v\n", prefix, e.Duration.Round(time.Millisecond))
+		}
+	case KindInfo:
+		fmt.Fprintf(h.out, "%s%s→ %s\n", prefix, indent, e.Message)
+	case KindWarning:
+		fmt.Fprintf(h.out, "%s%s⚠ %s\n", prefix, indent, e.Message)
+	case KindSuccess:
+		h.inStep[e.Server] = false
+		if e.Icon != "" {
+			fmt.Fprintf(h.out, "\n%s%s %s\n", prefix, e.Icon, e.Message)
+		} else {
+			fmt.Fprintf(h.out, "%s✓ %s\n", prefix, e.Message)
+		}
+	case KindError:
+		h.inStep[e.Server] = false
+		// Step failures are returned as errors and printed by the CLI
+		if e.Step == "" {
+			fmt.Fprintf(h.err, "%s✗ %s\n", prefix, e.Message)
+		}
+	case KindOutput:
+		if e.Source == SourceRemote && !h.verbose {
+			return
+		}
+		fmt.Fprintf(h.out, "%s%s\n", prefix, e.Message)
+	case KindResult:
+		// Commands print their own human summary
+	}
+}
+
+// JSON renders events as newline-delimited JSON objects
+type JSON struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSON creates a JSON renderer writing to w
+func NewJSON(w io.Writer) *JSON {
+	return &JSON{enc: json.NewEncoder(w)}
+}
+
+type jsonEvent struct {
+	Type       Kind      `json:"type"`
+	Time       time.Time `json:"time"`
+	Step       string    `json:"step,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	DurationMS int64     `json:"duration_ms,omitempty"`
+	Source     string    `json:"source,omitempty"`
+	Server     string    `json:"server,omitempty"`
+	Data       any       `json:"data,omitempty"`
+}
+
+// Report encodes a single event
+func (j *JSON) Report(e Event) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.enc.Encode(jsonEvent{
+		Type:       e.Kind,
+		Time:       e.Time.UTC(),
+		Step:       e.Step,
+		Message:    e.Message,
+		DurationMS: e.Duration.Milliseconds(),
+		Source:     e.Source,
+		Server:     e.Server,
+		Data:       e.Data,
+	})
+}
+
+// Terminal returns a human renderer writing to stdout and stderr
+func Terminal() Reporter {
+	return NewHuman(os.Stdout, os.Stderr, false)
+}
@@ -0,0 +1,162 @@
+// Package report carries progress events from gotzer's subsystems to a
+// renderer: human-readable text for the terminal, newline-delimited JSON for
+// CI, or a callback for library users.
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Kind identifies the type of an event
+type Kind string
+
+const (
+	KindStepStarted  Kind = "step_started"
+	KindStepFinished Kind = "step_finished"
+	KindInfo         Kind = "info"
+	KindSuccess      Kind = "success"
+	KindWarning      Kind = "warning"
+	KindError        Kind = "error"
+	KindOutput       Kind = "output"
+	KindResult       Kind = "result"
+)
+
+// Output sources
+const (
+	SourceLocal  = "local"
+	SourceRemote = "remote"
+)
+
+// Event is a single progress event
+type Event struct {
+	Kind     Kind
+	Time     time.Time
+	Step     string        // machine-readable step ID, e.g. "build"
+	Message  string        // human-readable text
+	Icon     string        // emoji used by the human renderer
+	Duration time.Duration // set on KindStepFinished and KindError of a step
+	Source   string        // KindOutput: SourceLocal or SourceRemote
+	Server   string        // server the event concerns when deploying to several
+	Data     any           // KindResult: the command's structured result
+}
+
+// Reporter receives events
+type Reporter interface {
+	Report(Event)
+}
+
+// Func adapts a function to a Reporter
+type Func func(Event)
+
+// Report calls f(e)
+func (f Func) Report(e Event) {
+	f(e)
+}
+
+// WithServer returns a Reporter that marks every event with the server name
+func WithServer(r Reporter, server string) Reporter {
+	return Func(func(e Event) {
+		e.Server = server
+		r.Report(e)
+	})
+}
+
+// Discard drops all events
+var Discard Reporter = Func(func(Event) {})
+
+// emit stamps the event time and sends it
+func emit(r Reporter, e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	r.Report(e)
+}
+
+// Step is a running step started with Start
+type Step struct {
+	r     Reporter
+	id    string
+	start time.Time
+}
+
+// Start reports the start of a step and returns a handle to finish it
+func Start(r Reporter, id, icon, message string) *Step {
+	emit(r, Event{Kind: KindStepStarted, Step: id, Icon: icon, Message: message})
+	return &Step{r: r, id: id, start: time.Now()}
+}
+
+// Done reports that the step finished successfully
+func (s *Step) Done() {
+	emit(s.r, Event{Kind: KindStepFinished, Step: s.id, Duration: time.Since(s.start)})
+}
+
+// Fail reports that the step failed and returns err unchanged
+func (s *Step) Fail(err error) error {
+	emit(s.r, Event{Kind: KindError, Step: s.id, Message: err.Error(), Duration: time.Since(s.start)})
+	return err
+}
+
+// Info reports a detail line
+func Info(r Reporter, format string, args ...any) {
+	emit(r, Event{Kind: KindInfo, Message: fmt.Sprintf(format, args...)})
+}
+
+// Warn reports a non-fatal problem
+func Warn(r Reporter, format string, args ...any) {
+	emit(r, Event{Kind: KindWarning, Message: fmt.Sprintf(format, args...)})
+}
+
+// Error reports a failure outside of a step
+func Error(r Reporter, format string, args ...any) {
+	emit(r, Event{Kind: KindError, Message: fmt.Sprintf(format, args...)})
+}
+
+// Success reports a completed operation. The icon may be empty.
+func Success(r Reporter, icon, format string, args ...any) {
+	emit(r, Event{Kind: KindSuccess, Icon: icon, Message: fmt.Sprintf(format, args...)})
+}
+
+// Output reports command output from the local machine or the server
+func Output(r Reporter, source, text string) {
+	if text == "" {
+		return
+	}
+	emit(r, Event{Kind: KindOutput, Source: source, Message: text})
+}
+
+// Result reports the final structured result of a command
+func Result(r Reporter, data any) {
+	emit(r, Event{Kind: KindResult, Data: data})
+}
+
+// Writer returns an io.Writer that reports each written line as output
+func Writer(r Reporter, source string) io.Writer {
+	return &lineWriter{r: r, source: source}
+}
+
+type lineWriter struct {
+	mu     sync.Mutex
+	r      Reporter
+	source string
+	buf    bytes.Buffer
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		line := string(w.buf.Next(i + 1))
+		Output(w.r, w.source, line[:len(line)-1])
+	}
+	return len(p), nil
+}
@@ -0,0 +1,111 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// IdentityPath returns the age identity file: $GOTZER_AGE_KEY_FILE or ~/.gotzer/age.key
+func IdentityPath() (string, error) {
+	if path := os.Getenv("GOTZER_AGE_KEY_FILE"); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".gotzer", "age.key"), nil
+}
+
+// LoadIdentity reads the age identity used to decrypt secrets.
+// $GOTZER_AGE_KEY may hold the key itself, which is convenient in CI.
+func LoadIdentity() (*age.X25519Identity, error) {
+	if key := os.Getenv("GOTZER_AGE_KEY"); key != "" {
+		identity, err := age.ParseX25519Identity(strings.TrimSpace(key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid GOTZER_AGE_KEY: %w", err)
+		}
+		return identity, nil
+	}
+
+	path, err := IdentityPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no age key at %s. Run 'gotzer secrets set' to create one or set GOTZER_AGE_KEY", path)
+		}
+		return nil, fmt.Errorf("failed to read age key: %w", err)
+	}
+	return parseIdentityFile(path, string(data))
+}
+
+// LoadOrCreateIdentity reads the age identity, generating one on first use
+func LoadOrCreateIdentity() (*age.X25519Identity, bool, error) {
+	if os.Getenv("GOTZER_AGE_KEY") != "" {
+		identity, err := LoadIdentity()
+		return identity, false, err
+	}
+
+	path, err := IdentityPath()
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		identity, err := LoadIdentity()
+		return identity, false, err
+	}
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to generate age key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, false, fmt.Errorf("failed to create key directory: %w", err)
+	}
+	content := fmt.Sprintf("# public key: %s\n%s\n", identity.Recipient(), identity)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		return nil, false, fmt.Errorf("failed to write age key: %w", err)
+	}
+	return identity, true, nil
+}
+
+// Recipients parses the configured recipients, always including the local identity
+// so the file stays readable by whoever writes it
+func Recipients(configured []string, identity *age.X25519Identity) ([]age.Recipient, error) {
+	own := identity.Recipient().String()
+	recipients := []age.Recipient{identity.Recipient()}
+	for _, r := range configured {
+		if r == own {
+			continue
+		}
+		recipient, err := age.ParseX25519Recipient(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secrets recipient %q: %w", r, err)
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, nil
+}
+
+// parseIdentityFile reads the first identity from an age-keygen style file
+func parseIdentityFile(path, data string) (*age.X25519Identity, error) {
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		identity, err := age.ParseX25519Identity(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid age key in %s: %w", path, err)
+		}
+		return identity, nil
+	}
+	return nil, fmt.Errorf("no age key found in %s", path)
+}
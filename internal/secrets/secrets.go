@@ -0,0 +1,158 @@
+package secrets
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"gopkg.in/yaml.v3"
+)
+
+// Secrets is the decrypted content of the secrets file. The file itself is an
+// ASCII-armored age document, so it can also be read with `age -d -i <key>`.
+type Secrets struct {
+	Deploy   map[string]string            `yaml:"deploy,omitempty"`
+	Services map[string]map[string]string `yaml:"services,omitempty"`
+}
+
+// Scope returns the variables for "deploy" or a service name, creating the map if needed
+func (s *Secrets) Scope(scope string) map[string]string {
+	if scope == "" || scope == "deploy" {
+		if s.Deploy == nil {
+			s.Deploy = map[string]string{}
+		}
+		return s.Deploy
+	}
+	if s.Services == nil {
+		s.Services = map[string]map[string]string{}
+	}
+	if s.Services[scope] == nil {
+		s.Services[scope] = map[string]string{}
+	}
+	return s.Services[scope]
+}
+
+// Load decrypts and parses the secrets file. A missing file yields empty secrets.
+func Load(path string, identity age.Identity) (*Secrets, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Secrets{}, nil
+		}
+		return nil, fmt.Errorf("failed to read secrets: %w", err)
+	}
+
+	plain, err := Decrypt(data, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	var s Secrets
+	if err := yaml.Unmarshal(plain, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse secrets: %w", err)
+	}
+	return &s, nil
+}
+
+// Save encrypts the secrets for the recipients and writes them to path
+func Save(path string, s *Secrets, recipients []age.Recipient) error {
+	plain, err := yaml.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to marshal secrets: %w", err)
+	}
+	return SaveRaw(path, plain, recipients)
+}
+
+// SaveRaw validates plaintext YAML, encrypts it for the recipients and writes it to path
+func SaveRaw(path string, plain []byte, recipients []age.Recipient) error {
+	var s Secrets
+	if err := yaml.Unmarshal(plain, &s); err != nil {
+		return fmt.Errorf("invalid secrets YAML: %w", err)
+	}
+
+	encrypted, err := Encrypt(plain, recipients)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+	if err := os.WriteFile(path, encrypted, 0600); err != nil {
+		return fmt.Errorf("failed to write secrets: %w", err)
+	}
+	return nil
+}
+
+// Encrypt returns plain encrypted to the recipients as an armored age document
+func Encrypt(plain []byte, recipients []age.Recipient) ([]byte, error) {
+	var buf bytes.Buffer
+	armored := armor.NewWriter(&buf)
+
+	w, err := age.Encrypt(armored, recipients...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt secrets: %w", err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		return nil, fmt.Errorf("failed to encrypt secrets: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encrypt secrets: %w", err)
+	}
+	if err := armored.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encrypt secrets: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Decrypt returns the plaintext of an armored or binary age document
+func Decrypt(data []byte, identity age.Identity) ([]byte, error) {
+	var src io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(armor.Header)) {
+		src = armor.NewReader(src)
+	}
+
+	r, err := age.Decrypt(src, identity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secrets: %w", err)
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secrets: %w", err)
+	}
+	return plain, nil
+}
+
+// FormatEnvFile renders variables as a KEY="value" file for systemd's EnvironmentFile=
+func FormatEnvFile(vars map[string]string) string {
+	return formatEnvFile(vars, strconv.Quote)
+}
+
+// FormatComposeEnvFile renders variables for Docker Compose's env_file. Compose
+// interpolates $ in values, so it is escaped as $$.
+func FormatComposeEnvFile(vars map[string]string) string {
+	return formatEnvFile(vars, func(v string) string {
+		return strconv.Quote(strings.ReplaceAll(v, "$", "$$"))
+	})
+}
+
+func formatEnvFile(vars map[string]string, quote func(string) string) string {
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var builder strings.Builder
+	for _, k := range keys {
+		builder.WriteString(fmt.Sprintf("%s=%s\n", k, quote(vars[k])))
+	}
+	return builder.String()
+}
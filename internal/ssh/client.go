@@ -2,6 +2,7 @@ package ssh
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/gzip"
 	"context"
 	"fmt"
@@ -16,22 +17,35 @@ import (
 
 // Client handles SSH connections and file transfers
 type Client struct {
-	host      string
-	user      string
-	keyPath   string
-	sshClient *ssh.Client
-	connected bool
+	host            string
+	user            string
+	keyPath         string
+	hostKeyCallback ssh.HostKeyCallback
+	sshClient       *ssh.Client
+	connected       bool
 }
 
-// NewClient creates a new SSH client
+// NewClient creates a new SSH client. Host keys are verified against
+// ~/.gotzer/known_hosts by IP; use SetHostKeyCallback to key them by server.
 func NewClient(host, user, keyPath string) *Client {
 	return &Client{
-		host:    host,
-		user:    user,
-		keyPath: keyPath,
+		host:            host,
+		user:            user,
+		keyPath:         keyPath,
+		hostKeyCallback: DefaultKnownHosts().HostKeyCallback(0),
 	}
 }
 
+// SetHostKeyCallback replaces the host key verification used by Connect
+func (c *Client) SetHostKeyCallback(callback ssh.HostKeyCallback) {
+	c.hostKeyCallback = callback
+}
+
+// Host returns the address the client connects to
+func (c *Client) Host() string {
+	return c.host
+}
+
 // Connect establishes an SSH connection
 func (c *Client) Connect(ctx context.Context) error {
 	keyPath := expandPath(c.keyPath)
@@ -50,11 +64,11 @@ func (c *Client) Connect(ctx context.Context) error {
 		Auth: []ssh.AuthMethod{
 			ssh.PublicKeys(signer),
 		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // TODO: proper host key verification
+		HostKeyCallback: c.hostKeyCallback,
 		Timeout:         30 * time.Second,
 	}
 
-	addr := fmt.Sprintf("%s:22", c.host)
+	addr := net.JoinHostPort(c.host, "22")
 	conn, err := ssh.Dial("tcp", addr, config)
 	if err != nil {
 		return fmt.Errorf("failed to connect to %s: %w", addr, err)
@@ -116,6 +130,28 @@ func (c *Client) RunInteractive(ctx context.Context, cmd string) error {
 	return nil
 }
 
+// RunStream runs a command and copies its stdout and stderr to w as it is produced
+func (c *Client) RunStream(ctx context.Context, cmd string, w io.Writer) error {
+	if !c.connected {
+		return fmt.Errorf("not connected")
+	}
+
+	session, err := c.sshClient.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	defer session.Close()
+
+	session.Stdout = w
+	session.Stderr = w
+
+	if err := session.Run(cmd); err != nil {
+		return fmt.Errorf("command failed: %w", err)
+	}
+
+	return nil
+}
+
 // Upload copies a local file to the remote server via SCP
 func (c *Client) Upload(ctx context.Context, localPath, remotePath string) error {
 	if !c.connected {
@@ -169,6 +205,38 @@ func (c *Client) Upload(ctx context.Context, localPath, remotePath string) error
 	return nil
 }
 
+// ReadFile returns the content of a file on the server, or "" if it does not exist
+func (c *Client) ReadFile(ctx context.Context, remotePath string) (string, error) {
+	output, err := c.Run(ctx, fmt.Sprintf("sudo cat %s 2>/dev/null || true", remotePath))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", remotePath, err)
+	}
+	return output, nil
+}
+
+// WriteFile writes content to a root-owned file on the server with the given mode.
+// The content is streamed over stdin so it never appears on a command line.
+func (c *Client) WriteFile(ctx context.Context, remotePath string, content []byte, mode os.FileMode) error {
+	if !c.connected {
+		return fmt.Errorf("not connected")
+	}
+
+	session, err := c.sshClient.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	defer session.Close()
+
+	session.Stdin = bytes.NewReader(content)
+	cmd := fmt.Sprintf("sudo mkdir -p %s && sudo sh -c 'umask 077 && cat > %s.tmp' && sudo chmod %o %s.tmp && sudo mv %s.tmp %s",
+		filepath.Dir(remotePath), remotePath, mode.Perm(), remotePath, remotePath, remotePath)
+	if output, err := session.CombinedOutput(cmd); err != nil {
+		return fmt.Errorf("failed to write %s: %w\nOutput: %s", remotePath, err, output)
+	}
+
+	return nil
+}
+
 // UploadDir copies a local directory to the remote server via tar+gzip
 func (c *Client) UploadDir(ctx context.Context, localPath, remotePath string) error {
 	if !c.connected {
@@ -242,7 +310,7 @@ func (c *Client) UploadDir(ctx context.Context, localPath, remotePath string) er
 		})
 		if err != nil {
 			// Note: This error handling is simple; in a production app we might want to signal this error via a channel.
-			fmt.Printf("Warning: error walking path for UploadDir: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Warning: error walking path for UploadDir: %v\n", err)
 		}
 	}()
 
@@ -294,7 +362,7 @@ func WaitForSSH(ctx context.Context, host string, timeout time.Duration) error {
 	deadline := time.Now().Add(timeout)
 
 	for time.Now().Before(deadline) {
-		conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:22", host), 5*time.Second)
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, "22"), 5*time.Second)
 		if err == nil {
 			conn.Close()
 			return nil
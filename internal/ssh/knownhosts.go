@@ -0,0 +1,258 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// KnownHosts is gotzer's host key store. Each line records the Hetzner server ID,
+// the IP the key was seen on, and the key itself:
+//
+//	<server-id> <ip> <key-type> <base64-key>
+//
+// Unknown hosts are trusted on first use and recorded; later connects must
+// present the same key.
+type KnownHosts struct {
+	Path string
+
+	// Fallback is an OpenSSH known_hosts file consulted when gotzer has no
+	// entry for a host. Hetzner reuses IPs, so a different key there only
+	// causes a warning. Empty disables the fallback.
+	Fallback string
+
+	// Notify receives a message when a new host key is trusted or differs
+	// from the fallback. Nil prints it to stderr, keeping stdout for command
+	// output such as --output json.
+	Notify func(msg string)
+}
+
+// HostKeyEntry is a single record in the gotzer known_hosts file
+type HostKeyEntry struct {
+	ServerID int64
+	IP       string
+	Key      ssh.PublicKey
+}
+
+// HostKeyMismatchError is returned when a server presents a key that differs
+// from the recorded one
+type HostKeyMismatchError struct {
+	ServerID int64
+	Host     string
+	Want     ssh.PublicKey
+	Got      ssh.PublicKey
+	Source   string
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	// The server ID is unknown when connecting by IP only
+	host := e.Host
+	if e.ServerID != 0 {
+		host = fmt.Sprintf("%s (server %d)", e.Host, e.ServerID)
+	}
+	return fmt.Sprintf(`REMOTE HOST IDENTIFICATION HAS CHANGED for %s
+  expected %s %s (from %s)
+  received %s %s
+This can mean someone is intercepting the connection. If the server was
+legitimately rebuilt, run 'gotzer ssh trust --reset'`,
+		host,
+		e.Want.Type(), ssh.FingerprintSHA256(e.Want), e.Source,
+		e.Got.Type(), ssh.FingerprintSHA256(e.Got))
+}
+
+// DefaultKnownHosts returns the store at ~/.gotzer/known_hosts with the user's
+// ~/.ssh/known_hosts as fallback
+func DefaultKnownHosts() *KnownHosts {
+	home, _ := os.UserHomeDir()
+	return &KnownHosts{
+		Path:     filepath.Join(home, ".gotzer", "known_hosts"),
+		Fallback: filepath.Join(home, ".ssh", "known_hosts"),
+	}
+}
+
+// Entries reads all records from the store
+func (k *KnownHosts) Entries() ([]HostKeyEntry, error) {
+	data, err := os.ReadFile(k.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", k.Path, err)
+	}
+
+	var entries []HostKeyEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: malformed entry", k.Path, lineNum)
+		}
+		id, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid server ID: %w", k.Path, lineNum, err)
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(fields[2]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid key: %w", k.Path, lineNum, err)
+		}
+		entries = append(entries, HostKeyEntry{ServerID: id, IP: fields[1], Key: key})
+	}
+	return entries, scanner.Err()
+}
+
+// Add records a host key for the given server
+func (k *KnownHosts) Add(serverID int64, ip string, key ssh.PublicKey) error {
+	if err := os.MkdirAll(filepath.Dir(k.Path), 0700); err != nil {
+		return fmt.Errorf("failed to create known_hosts directory: %w", err)
+	}
+
+	f, err := os.OpenFile(k.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", k.Path, err)
+	}
+	defer f.Close()
+
+	line := fmt.Sprintf("%d %s %s", serverID, ip, ssh.MarshalAuthorizedKey(key))
+	if _, err := f.WriteString(line); err != nil {
+		return fmt.Errorf("failed to write %s: %w", k.Path, err)
+	}
+	return nil
+}
+
+// Remove deletes every record matching the server ID or the IP.
+// A zero server ID or empty IP matches nothing.
+func (k *KnownHosts) Remove(serverID int64, ip string) (int, error) {
+	entries, err := k.Entries()
+	if err != nil {
+		return 0, err
+	}
+
+	var kept []HostKeyEntry
+	for _, e := range entries {
+		if (serverID != 0 && e.ServerID == serverID) || (ip != "" && e.IP == ip) {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	removed := len(entries) - len(kept)
+	if removed == 0 {
+		return 0, nil
+	}
+
+	var buf bytes.Buffer
+	for _, e := range kept {
+		fmt.Fprintf(&buf, "%d %s %s", e.ServerID, e.IP, ssh.MarshalAuthorizedKey(e.Key))
+	}
+	if err := os.WriteFile(k.Path, buf.Bytes(), 0600); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", k.Path, err)
+	}
+	return removed, nil
+}
+
+// HostKeyCallback returns a callback that verifies the server's key against the
+// store, trusting and recording it on first use. A serverID of 0 matches by IP only.
+func (k *KnownHosts) HostKeyCallback(serverID int64) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		ip := hostOnly(hostname)
+
+		entries, err := k.Entries()
+		if err != nil {
+			return err
+		}
+
+		var candidates []HostKeyEntry
+		for _, e := range entries {
+			if (serverID != 0 && e.ServerID == serverID) || e.IP == ip {
+				candidates = append(candidates, e)
+			}
+		}
+		for _, e := range candidates {
+			if bytes.Equal(e.Key.Marshal(), key.Marshal()) {
+				return nil
+			}
+		}
+		if len(candidates) > 0 {
+			return &HostKeyMismatchError{
+				ServerID: serverID,
+				Host:     ip,
+				Want:     candidates[0].Key,
+				Got:      key,
+				Source:   k.Path,
+			}
+		}
+
+		warning, err := k.checkFallback(hostname, remote, key)
+		if err != nil {
+			return err
+		}
+		if warning != "" {
+			k.notify(warning)
+		}
+
+		if err := k.Add(serverID, ip, key); err != nil {
+			return err
+		}
+		k.notify(fmt.Sprintf("Trusting new host key for %s: %s %s", ip, key.Type(), ssh.FingerprintSHA256(key)))
+		return nil
+	}
+}
+
+func (k *KnownHosts) notify(msg string) {
+	if k.Notify != nil {
+		k.Notify(msg)
+	} else {
+		fmt.Fprintf(os.Stderr, "  → %s\n", msg)
+	}
+}
+
+// checkFallback compares the key with the OpenSSH known_hosts file, if any.
+// Hosts missing from the fallback are fine; a different key there returns a
+// warning, since the address most likely belonged to an earlier server.
+func (k *KnownHosts) checkFallback(hostname string, remote net.Addr, key ssh.PublicKey) (string, error) {
+	if k.Fallback == "" {
+		return "", nil
+	}
+	if _, err := os.Stat(k.Fallback); err != nil {
+		return "", nil
+	}
+
+	callback, err := knownhosts.New(k.Fallback)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", k.Fallback, err)
+	}
+
+	err = callback(hostname, remote, key)
+	var keyErr *knownhosts.KeyError
+	if errors.As(err, &keyErr) {
+		if len(keyErr.Want) == 0 {
+			return "", nil
+		}
+		want := keyErr.Want[0].Key
+		return fmt.Sprintf("%s has a different host key in %s (%s %s), likely from an earlier server on this IP; ignoring it",
+			hostOnly(hostname), k.Fallback, want.Type(), ssh.FingerprintSHA256(want)), nil
+	}
+	return "", err
+}
+
+// hostOnly strips the port from a host:port address
+func hostOnly(hostname string) string {
+	host, _, err := net.SplitHostPort(hostname)
+	if err != nil {
+		return hostname
+	}
+	return host
+}
@@ -6,25 +6,61 @@ import (
 	"strings"
 
 	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/secrets"
 	"github.com/DawnKosmos/gotzer/internal/ssh"
 )
 
-// Configure updates or creates the systemd service file and reloads systemd
-func Configure(ctx context.Context, sc *ssh.Client, cfg *config.Config) error {
-	// Build environment string
-	var envLines []string
-	for k, v := range cfg.Deploy.Env {
-		envLines = append(envLines, fmt.Sprintf("Environment=%s=%s", k, v))
+// UnitPath returns the path of the app's systemd unit file
+func UnitPath(cfg *config.Config) string {
+	return fmt.Sprintf("/etc/systemd/system/%s.service", cfg.Deploy.ServiceName)
+}
+
+// TemplateUnitPath returns the path of the app's templated unit used by blue-green deploys
+func TemplateUnitPath(cfg *config.Config) string {
+	return fmt.Sprintf("/etc/systemd/system/%s@.service", cfg.Deploy.ServiceName)
+}
+
+// EnvFilePath returns the root-only environment file read by the app's units
+func EnvFilePath(cfg *config.Config) string {
+	return fmt.Sprintf("/etc/gotzer/%s.env", cfg.Deploy.ServiceName)
+}
+
+// InstanceName returns the unit name of a blue-green instance
+func InstanceName(cfg *config.Config, color string) string {
+	return fmt.Sprintf("%s@%s", cfg.Deploy.ServiceName, color)
+}
+
+// RenderUnit returns the systemd unit file content for the app
+func RenderUnit(cfg *config.Config) string {
+	// ExecStart goes through the current release symlink
+	return renderUnit(cfg, cfg.Name, cfg.Deploy.CurrentPath(), "")
+}
+
+// RenderTemplateUnit returns the templated unit for blue-green deploys.
+// Each instance runs the release linked at <remote_path>/<color> and reads
+// its PORT from <remote_path>/<color>.env.
+func RenderTemplateUnit(cfg *config.Config) string {
+	return renderUnit(cfg,
+		fmt.Sprintf("%s (%%i)", cfg.Name),
+		fmt.Sprintf("%s/%%i", cfg.Deploy.RemotePath),
+		fmt.Sprintf("EnvironmentFile=%s/%%i.env", cfg.Deploy.RemotePath))
+}
+
+func renderUnit(cfg *config.Config, description, releasePath, extra string) string {
+	// Variables live in a root-only file so they don't show up in `systemctl show`
+	envLines := []string{fmt.Sprintf("EnvironmentFile=-%s", EnvFilePath(cfg))}
+	if extra != "" {
+		envLines = append(envLines, extra)
 	}
 	envSection := strings.Join(envLines, "\n")
 
 	// Build command string
-	execCmd := fmt.Sprintf("%s/%s", cfg.Deploy.RemotePath, cfg.Build.Output)
+	execCmd := fmt.Sprintf("%s/%s", releasePath, cfg.Build.Output)
 	if len(cfg.Deploy.Command) > 0 {
 		execCmd = fmt.Sprintf("%s %s", execCmd, strings.Join(cfg.Deploy.Command, " "))
 	}
 
-	serviceContent := fmt.Sprintf(`[Unit]
+	return fmt.Sprintf(`[Unit]
 Description=%s
 After=network.target docker.service
 
@@ -36,18 +72,68 @@ WorkingDirectory=%s
 ExecStart=%s
 Restart=always
 RestartSec=5
-%%s
+%s
 
 [Install]
 WantedBy=multi-user.target
-`, cfg.Name, cfg.Deploy.User, cfg.Deploy.User, cfg.Deploy.RemotePath, execCmd)
+`, description, cfg.Deploy.User, cfg.Deploy.User, cfg.Deploy.RemotePath, execCmd, envSection)
+}
+
+// Configure updates or creates the systemd service file and reloads systemd.
+// For blue-green deploys only the template unit is written; instances are
+// enabled by the deployer.
+func Configure(ctx context.Context, sc *ssh.Client, cfg *config.Config) error {
+	if cfg.Deploy.IsBlueGreen() {
+		return WriteUnit(ctx, sc, TemplateUnitPath(cfg), RenderTemplateUnit(cfg))
+	}
+
+	if err := WriteUnit(ctx, sc, UnitPath(cfg), RenderUnit(cfg)); err != nil {
+		return err
+	}
+
+	// Enable service
+	if _, err := sc.Run(ctx, fmt.Sprintf("sudo systemctl enable %s", cfg.Deploy.ServiceName)); err != nil {
+		return fmt.Errorf("failed to enable service: %w", err)
+	}
+
+	return nil
+}
+
+// AppEnv returns deploy.env merged with the deploy secrets. Secrets win over plain values.
+func AppEnv(cfg *config.Config, s *secrets.Secrets) map[string]string {
+	vars := make(map[string]string, len(cfg.Deploy.Env))
+	for k, v := range cfg.Deploy.Env {
+		vars[k] = v
+	}
+	if s != nil {
+		for k, v := range s.Deploy {
+			vars[k] = v
+		}
+	}
+	return vars
+}
 
-	// Since we use fmt.Sprintf above, we need to handle the %s for envSection separately or escape it
-	serviceContent = fmt.Sprintf(serviceContent, envSection)
+// WriteEnvFile installs the app's variables as its root-only environment file
+func WriteEnvFile(ctx context.Context, sc *ssh.Client, cfg *config.Config, s *secrets.Secrets) error {
+	content := secrets.FormatEnvFile(AppEnv(cfg, s))
+	if err := sc.WriteFile(ctx, EnvFilePath(cfg), []byte(content), 0600); err != nil {
+		return fmt.Errorf("failed to write environment file: %w", err)
+	}
+	return nil
+}
+
+// ReadUnit returns the unit file installed at path, or "" if there is none
+func ReadUnit(ctx context.Context, sc *ssh.Client, path string) (string, error) {
+	output, err := sc.Run(ctx, fmt.Sprintf("sudo cat %s 2>/dev/null || true", path))
+	if err != nil {
+		return "", fmt.Errorf("failed to read service file: %w", err)
+	}
+	return output, nil
+}
 
-	// Write service file
-	servicePath := fmt.Sprintf("/etc/systemd/system/%s.service", cfg.Deploy.ServiceName)
-	cmd := fmt.Sprintf(`echo '%s' | sudo tee %s > /dev/null`, serviceContent, servicePath)
+// WriteUnit writes the given unit file content and reloads systemd
+func WriteUnit(ctx context.Context, sc *ssh.Client, path, content string) error {
+	cmd := fmt.Sprintf(`echo '%s' | sudo tee %s > /dev/null`, content, path)
 	if _, err := sc.Run(ctx, cmd); err != nil {
 		return fmt.Errorf("failed to write service file: %w", err)
 	}
@@ -57,10 +143,5 @@ WantedBy=multi-user.target
 		return fmt.Errorf("failed to reload systemd: %w", err)
 	}
 
-	// Enable service
-	if _, err := sc.Run(ctx, fmt.Sprintf("sudo systemctl enable %s", cfg.Deploy.ServiceName)); err != nil {
-		return fmt.Errorf("failed to enable service: %w", err)
-	}
-
 	return nil
 }
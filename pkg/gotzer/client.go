@@ -0,0 +1,193 @@
+// Package gotzer provisions Hetzner Cloud servers and deploys Go applications
+// and static sites to them. It is the library behind the gotzer CLI.
+//
+//	client := gotzer.NewClient(gotzer.WithToken(os.Getenv("HETZNER_TOKEN")))
+//	server, err := client.Provision(ctx, gotzer.ProvisionOpts{Name: "my-server"})
+//	result, err := client.Deploy(ctx, gotzer.DeployOpts{ServerIP: server.IP, ...})
+package gotzer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/hetzner"
+	"github.com/DawnKosmos/gotzer/internal/report"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// Client provisions servers and deploys applications
+type Client struct {
+	token      string
+	sshKeyPath string
+	sshUser    string
+	progress   func(Event)
+	hetzner    *hetzner.Client
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithToken sets the Hetzner Cloud API token
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithSSHKey sets the private key used to connect to servers (default ~/.ssh/id_ed25519)
+func WithSSHKey(path string) Option {
+	return func(c *Client) {
+		c.sshKeyPath = path
+	}
+}
+
+// WithSSHUser sets the user gotzer connects as (default root)
+func WithSSHUser(user string) Option {
+	return func(c *Client) {
+		c.sshUser = user
+	}
+}
+
+// WithProgress registers a callback receiving progress events. Without it the
+// client reports nothing.
+func WithProgress(fn func(Event)) Option {
+	return func(c *Client) {
+		c.progress = fn
+	}
+}
+
+// NewClient creates a new client
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		sshKeyPath: "~/.ssh/id_ed25519",
+		sshUser:    "root",
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.hetzner = hetzner.NewClient(c.token, hetzner.WithReporter(c.reporter()))
+	return c
+}
+
+// EventType identifies the kind of progress event
+type EventType string
+
+const (
+	EventStepStarted  EventType = EventType(report.KindStepStarted)
+	EventStepFinished EventType = EventType(report.KindStepFinished)
+	EventInfo         EventType = EventType(report.KindInfo)
+	EventSuccess      EventType = EventType(report.KindSuccess)
+	EventWarning      EventType = EventType(report.KindWarning)
+	EventError        EventType = EventType(report.KindError)
+	EventOutput       EventType = EventType(report.KindOutput)
+)
+
+// Event reports progress of a long-running operation
+type Event struct {
+	Type     EventType
+	Step     string
+	Message  string
+	Duration time.Duration // set on EventStepFinished and EventError of a step
+	Source   string        // EventOutput: "local" (build) or "remote" (server)
+	Time     time.Time
+}
+
+// Server describes a Hetzner Cloud server
+type Server struct {
+	ID       int64
+	Name     string
+	IP       string
+	IPv6     string
+	Status   string
+	Type     string
+	Location string
+
+	// Architecture is "arm64" or "amd64", for DeployOpts.Architecture
+	Architecture string
+}
+
+// GetServer returns the server with the given name, or nil if it does not exist
+func (c *Client) GetServer(ctx context.Context, name string) (*Server, error) {
+	server, err := c.hetzner.GetServer(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if server == nil {
+		return nil, nil
+	}
+	return newServer(server), nil
+}
+
+// DeleteServer destroys the server with the given name
+func (c *Client) DeleteServer(ctx context.Context, name string) error {
+	return c.step("delete server", func() error {
+		return c.hetzner.DeleteServer(ctx, name)
+	})
+}
+
+// step runs fn and reports its start, end and failure
+func (c *Client) step(name string, fn func() error) error {
+	s := report.Start(c.reporter(), name, "", name)
+	if err := fn(); err != nil {
+		return s.Fail(err)
+	}
+	s.Done()
+	return nil
+}
+
+// reporter forwards internal progress events to the WithProgress callback
+func (c *Client) reporter() report.Reporter {
+	if c.progress == nil {
+		return report.Discard
+	}
+	return report.Func(func(e report.Event) {
+		if e.Kind == report.KindResult {
+			return
+		}
+		c.progress(Event{
+			Type:     EventType(e.Kind),
+			Step:     e.Step,
+			Message:  e.Message,
+			Duration: e.Duration,
+			Source:   e.Source,
+			Time:     e.Time,
+		})
+	})
+}
+
+// sshKey returns the expanded SSH key path
+func (c *Client) sshKey() string {
+	return config.ExpandPath(c.sshKeyPath)
+}
+
+func newServer(s *hcloud.Server) *Server {
+	server := &Server{
+		ID:     s.ID,
+		Name:   s.Name,
+		Status: string(s.Status),
+	}
+	if !s.PublicNet.IPv4.IsUnspecified() {
+		server.IP = s.PublicNet.IPv4.IP.String()
+	}
+	if !s.PublicNet.IPv6.IsUnspecified() {
+		server.IPv6 = s.PublicNet.IPv6.IP.String()
+	}
+	if s.ServerType != nil {
+		server.Type = s.ServerType.Name
+		server.Architecture = "amd64"
+		if s.ServerType.Architecture == hcloud.ArchitectureARM {
+			server.Architecture = "arm64"
+		}
+	}
+	if s.Datacenter != nil && s.Datacenter.Location != nil {
+		server.Location = s.Datacenter.Location.Name
+	}
+	return server
+}
+
+// errRequired reports a missing option
+func errRequired(field string) error {
+	return fmt.Errorf("gotzer: %s is required", field)
+}
@@ -0,0 +1,111 @@
+package gotzer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/deploy"
+)
+
+// DeployOpts describes what to build and where to deploy it
+type DeployOpts struct {
+	ServerIP string // required
+
+	Type         string // "service" (default) or "static"
+	MainPkg      string // Go main package, e.g. "./cmd/server"
+	BinaryName   string // default "app"
+	LDFlags      string // default "-s -w"
+	BuildCommand string // static builds, e.g. "npm run build"
+	BuildDir     string // static builds, e.g. "./dist"
+	Architecture string // "arm64" (default, like ProvisionOpts.ServerType) or "amd64"; see Server.Architecture
+
+	RemotePath   string            // required
+	ServiceName  string            // required for service deploys
+	User         string            // default "app"
+	Command      []string          // arguments for the binary
+	Env          map[string]string // written to the app's environment file
+	KeepReleases int               // default 5
+}
+
+// DeployResult describes a finished deployment
+type DeployResult struct {
+	ServerIP  string
+	ReleaseID string
+	Duration  time.Duration
+}
+
+// Deploy builds the application locally and deploys it as a new release
+func (c *Client) Deploy(ctx context.Context, opts DeployOpts) (*DeployResult, error) {
+	if opts.ServerIP == "" {
+		return nil, errRequired("DeployOpts.ServerIP")
+	}
+	if opts.RemotePath == "" {
+		return nil, errRequired("DeployOpts.RemotePath")
+	}
+	if opts.Type != "static" && opts.ServiceName == "" {
+		return nil, errRequired("DeployOpts.ServiceName")
+	}
+	cfg := opts.config()
+
+	start := time.Now()
+	sshClient := c.sshClient(opts.ServerIP, 0)
+	if err := sshClient.Connect(ctx); err != nil {
+		return nil, fmt.Errorf("SSH connection failed: %w", err)
+	}
+	defer sshClient.Close()
+
+	deployer := deploy.NewDeployer(cfg, sshClient)
+	deployer.Reporter = c.reporter()
+	if err := c.step("deploy", func() error {
+		return deployer.Deploy(ctx)
+	}); err != nil {
+		return nil, err
+	}
+
+	return &DeployResult{
+		ServerIP:  opts.ServerIP,
+		ReleaseID: deployer.ReleaseID,
+		Duration:  time.Since(start),
+	}, nil
+}
+
+// config converts the options to a project configuration with defaults applied
+func (o DeployOpts) config() *config.Config {
+	cfg := &config.Config{Name: firstNonEmpty(o.ServiceName, o.BinaryName, "app")}
+
+	arch := "arm64"
+	if o.Architecture == "amd64" {
+		arch = "x64"
+	}
+	cfg.Server.Architecture = arch
+
+	cfg.Build = config.BuildConfig{
+		Type:    "go",
+		Main:    o.MainPkg,
+		Output:  firstNonEmpty(o.BinaryName, "app"),
+		Command: o.BuildCommand,
+		Dir:     o.BuildDir,
+		LDFlags: firstNonEmpty(o.LDFlags, "-s -w"),
+	}
+	if o.Type == "static" {
+		cfg.Build.Type = "static"
+	}
+
+	keep := o.KeepReleases
+	if keep <= 0 {
+		keep = 5
+	}
+	cfg.Deploy = config.DeployConfig{
+		Type:         firstNonEmpty(o.Type, "service"),
+		RemotePath:   o.RemotePath,
+		ServiceName:  o.ServiceName,
+		User:         firstNonEmpty(o.User, "app"),
+		Command:      o.Command,
+		Env:          o.Env,
+		KeepReleases: keep,
+		Strategy:     "restart",
+	}
+	return cfg
+}
@@ -0,0 +1,159 @@
+package gotzer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/DawnKosmos/gotzer/internal/config"
+	"github.com/DawnKosmos/gotzer/internal/hetzner"
+	"github.com/DawnKosmos/gotzer/internal/provision"
+	"github.com/DawnKosmos/gotzer/internal/report"
+	"github.com/DawnKosmos/gotzer/internal/ssh"
+)
+
+// ProvisionOpts describes the server to create and how to set it up
+type ProvisionOpts struct {
+	Name        string   // required
+	Location    string   // default "nbg1"
+	ServerType  string   // default "cax11"
+	Image       string   // default "ubuntu-24.04"
+	SSHKeyNames []string // Hetzner SSH keys; default the first key in the project
+
+	AppName     string // default Name
+	RemotePath  string // default /opt/apps/<AppName>
+	ServiceName string // default AppName
+	BinaryName  string // default "app"
+	User        string // default "app"
+
+	// SkipSetup only creates the server, without installing Docker, the app
+	// user, the systemd unit and the firewall
+	SkipSetup bool
+}
+
+// Provision creates a server and sets it up for deployments
+func (c *Client) Provision(ctx context.Context, opts ProvisionOpts) (*Server, error) {
+	if opts.Name == "" {
+		return nil, errRequired("ProvisionOpts.Name")
+	}
+	cfg := opts.config()
+
+	existing, err := c.hetzner.GetServer(ctx, cfg.Server.Name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("server %s already exists", cfg.Server.Name)
+	}
+
+	sshKeys := opts.SSHKeyNames
+	if len(sshKeys) == 0 {
+		keys, err := c.hetzner.ListSSHKeys(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("no SSH keys found")
+		}
+		sshKeys = []string{keys[0].Name}
+	}
+
+	// Without setup the server is created as it comes
+	var userData string
+	if !opts.SkipSetup {
+		if userData, err = provision.UserData(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	var server *Server
+	err = c.step("create server", func() error {
+		created, err := c.hetzner.CreateServer(ctx, hetzner.ServerOpts{
+			Name:        cfg.Server.Name,
+			Location:    cfg.Server.Location,
+			ServerType:  cfg.Server.Type,
+			Image:       cfg.Server.Image,
+			SSHKeyNames: sshKeys,
+			Labels:      cfg.Labels(),
+			UserData:    userData,
+		})
+		if err != nil {
+			return err
+		}
+		server = newServer(created)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Hetzner reuses IPs, so forget keys recorded for previous servers on this address
+	if _, err := ssh.DefaultKnownHosts().Remove(0, server.IP); err != nil {
+		return server, err
+	}
+
+	if opts.SkipSetup {
+		return server, nil
+	}
+
+	err = c.step("wait for ssh", func() error {
+		return ssh.WaitForSSH(ctx, server.IP, 2*time.Minute)
+	})
+	if err != nil {
+		return server, err
+	}
+
+	sshClient := c.sshClient(server.IP, server.ID)
+	if err := sshClient.Connect(ctx); err != nil {
+		return server, fmt.Errorf("SSH connection failed: %w", err)
+	}
+	defer sshClient.Close()
+
+	err = c.step("setup server", func() error {
+		prov := provision.NewProvisioner(cfg, sshClient)
+		prov.Reporter = c.reporter()
+		prov.CloudInit = true
+		return prov.Setup(ctx)
+	})
+	return server, err
+}
+
+// sshClient creates an SSH client verifying host keys against gotzer's known_hosts
+func (c *Client) sshClient(ip string, serverID int64) *ssh.Client {
+	sshClient := ssh.NewClient(ip, c.sshUser, c.sshKey())
+	knownHosts := ssh.DefaultKnownHosts()
+	knownHosts.Notify = func(msg string) { report.Info(c.reporter(), "%s", msg) }
+	sshClient.SetHostKeyCallback(knownHosts.HostKeyCallback(serverID))
+	return sshClient
+}
+
+// config converts the options to a project configuration with defaults applied
+func (o ProvisionOpts) config() *config.Config {
+	cfg := &config.Config{
+		Name: firstNonEmpty(o.AppName, o.Name),
+		Server: config.ServerConfig{
+			Name:     o.Name,
+			Location: firstNonEmpty(o.Location, "nbg1"),
+			Type:     firstNonEmpty(o.ServerType, "cax11"),
+			Image:    firstNonEmpty(o.Image, "ubuntu-24.04"),
+		},
+	}
+	cfg.Build.Output = firstNonEmpty(o.BinaryName, "app")
+	cfg.Deploy = config.DeployConfig{
+		Type:        "service",
+		RemotePath:  firstNonEmpty(o.RemotePath, "/opt/apps/"+cfg.Name),
+		ServiceName: firstNonEmpty(o.ServiceName, cfg.Name),
+		User:        firstNonEmpty(o.User, "app"),
+		Strategy:    "restart",
+	}
+	return cfg
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}